@@ -0,0 +1,118 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+)
+
+const authenticateCommandName = "Authenticate"
+
+var authenticationSucceededEventDef = flyte.EventDef{Name: "AuthenticationSucceeded"}
+var authenticationFailedEventDef = flyte.EventDef{Name: "AuthenticationFailed"}
+var authenticationCheckErrorEventDef = flyte.EventDef{Name: "AuthenticationCheckError"}
+
+type AuthenticateInput struct {
+	UserName  string `json:"username"`
+	Password  string `json:"password"`
+	Directory string `json:"directory,omitempty"` // the directory to search, the default directory if empty
+}
+
+// authenticationPayload deliberately has no password field, so the password can never be echoed back.
+type authenticationPayload struct {
+	Username  string `json:"username,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Code      string `json:"code,omitempty"` // the Active Directory sub-code, e.g. '775'
+	ErrorText string `json:"error,omitempty"`
+}
+
+func AuthenticateCommand(directories *directory.Registry) flyte.Command {
+	return flyte.Command{
+		Name:    authenticateCommandName,
+		Handler: instrument(authenticateCommandName, authenticateHandler(directories)),
+		OutputEvents: []flyte.EventDef{
+			authenticationSucceededEventDef,
+			authenticationFailedEventDef,
+			userNotFoundEventDef,
+			ambiguousUserEventDef,
+			authenticationCheckErrorEventDef,
+		},
+	}
+}
+
+func authenticateHandler(directories *directory.Registry) flyte.CommandHandler {
+	return func(input json.RawMessage) flyte.Event {
+		// unmarshall input, not including the error as syntax errors quote the input
+		args := AuthenticateInput{}
+		if err := json.Unmarshal(input, &args); err != nil {
+			return flyte.NewFatalEvent(authenticationPayload{
+				ErrorText: "Json unmarshalling error",
+			})
+		}
+		if args.UserName == "" {
+			return newAuthenticationCheckErrorEvent("No Username provided.", "")
+		}
+		if args.Password == "" {
+			return newAuthenticationCheckErrorEvent("No Password provided.", args.UserName)
+		}
+
+		d, err := directories.Get(args.Directory)
+		if err != nil {
+			return newAuthenticationCheckErrorEvent(err.Error(), args.UserName)
+		}
+
+		// bind as the user
+		err = d.Authenticator.Authenticate(context.Background(), d.SearchDetails, args.UserName, args.Password)
+		if event, ok := userLookupErrorEvent(err, args.UserName); ok {
+			return event
+		}
+		var authErr *ldap.AuthenticationError
+		if errors.As(err, &authErr) {
+			return flyte.Event{
+				EventDef: authenticationFailedEventDef,
+				Payload: authenticationPayload{
+					Username: args.UserName,
+					Reason:   authErr.Reason,
+					Code:     authErr.Code,
+				},
+			}
+		}
+		if err != nil {
+			return newAuthenticationCheckErrorEvent(err.Error(), args.UserName)
+		}
+
+		return flyte.Event{
+			EventDef: authenticationSucceededEventDef,
+			Payload:  authenticationPayload{Username: args.UserName},
+		}
+	}
+}
+
+func newAuthenticationCheckErrorEvent(errorText, username string) flyte.Event {
+	return flyte.Event{
+		EventDef: authenticationCheckErrorEventDef,
+		Payload: authenticationPayload{
+			Username:  username,
+			ErrorText: errorText,
+		},
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticateCommand_shouldReturnAuthenticationSucceeded(t *testing.T) {
+	var usernamePassed, passwordPassed string
+	mockAuthenticator := &mockAuthenticator{
+		authenticate: func(sd *group.SearchDetails, username, password string) error {
+			usernamePassed, passwordPassed = username, password
+			return nil
+		},
+	}
+
+	command := AuthenticateCommand(directoriesWith(directory.Directory{Authenticator: mockAuthenticator, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "password": "s3cr3t"}`))
+
+	if event.EventDef != authenticationSucceededEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if usernamePassed != "carlos" || passwordPassed != "s3cr3t" {
+		t.Errorf("Credentials passed to authenticator are wrong: %s", usernamePassed)
+	}
+	if payload := event.Payload.(authenticationPayload); payload != (authenticationPayload{Username: "carlos"}) {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestAuthenticateCommand_shouldReturnAuthenticationFailedWithReason(t *testing.T) {
+	mockAuthenticator := &mockAuthenticator{
+		authenticate: func(sd *group.SearchDetails, username, password string) error {
+			return &ldap.AuthenticationError{Code: "532", Reason: "password expired"}
+		},
+	}
+
+	command := AuthenticateCommand(directoriesWith(directory.Directory{Authenticator: mockAuthenticator, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "password": "s3cr3t"}`))
+
+	if event.EventDef != authenticationFailedEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	expected := authenticationPayload{Username: "carlos", Reason: "password expired", Code: "532"}
+	if payload := event.Payload.(authenticationPayload); payload != expected {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestAuthenticateCommand_shouldReturnUserNotFound(t *testing.T) {
+	mockAuthenticator := &mockAuthenticator{
+		authenticate: func(sd *group.SearchDetails, username, password string) error {
+			return &group.UserNotFoundError{Username: username}
+		},
+	}
+
+	command := AuthenticateCommand(directoriesWith(directory.Directory{Authenticator: mockAuthenticator, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlso", "password": "s3cr3t"}`))
+
+	if event.EventDef != userNotFoundEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+func TestAuthenticateCommand_shouldReturnErrorEventIfAuthenticatorReturnsError(t *testing.T) {
+	mockAuthenticator := &mockAuthenticator{
+		authenticate: func(sd *group.SearchDetails, username, password string) error {
+			return errors.New("Cannot connect to LDAP: meh")
+		},
+	}
+
+	command := AuthenticateCommand(directoriesWith(directory.Directory{Authenticator: mockAuthenticator, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "password": "s3cr3t"}`))
+
+	if event.EventDef != authenticationCheckErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(authenticationPayload); payload.ErrorText != "Cannot connect to LDAP: meh" {
+		t.Errorf("Error text is wrong! Error text: %v", payload.ErrorText)
+	}
+}
+
+func TestAuthenticateCommand_shouldReturnErrorEventIfUsernameOrPasswordNotProvided(t *testing.T) {
+	command := AuthenticateCommand(directoriesWith(directory.Directory{Authenticator: &mockAuthenticator{}, SearchDetails: someSearchDetails()}))
+
+	for input, errorText := range map[string]string{
+		`{"password": "s3cr3t"}`:                 "No Username provided.",
+		`{"username": "carlos"}`:                 "No Password provided.",
+		`{"username": "carlos", "password": ""}`: "No Password provided.",
+	} {
+		event := command.Handler(json.RawMessage(input))
+
+		if event.EventDef != authenticationCheckErrorEventDef {
+			t.Errorf("EventDef is wrong for %s! EventDef: %v", input, event.EventDef)
+		}
+		if payload := event.Payload.(authenticationPayload); payload.ErrorText != errorText {
+			t.Errorf("Error is wrong for %s! Error: %v", input, payload.ErrorText)
+		}
+	}
+}
+
+func TestAuthenticateCommand_shouldNotEchoPasswordInFatalErrorEvent(t *testing.T) {
+	command := AuthenticateCommand(directoriesWith(directory.Directory{Authenticator: &mockAuthenticator{}, SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "password": s3cr3t}`))
+
+	if event.EventDef.Name != "FATAL" {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload, _ := json.Marshal(event.Payload); strings.Contains(string(payload), "s3cr3t") || strings.Contains(string(payload), "'s'") {
+		t.Errorf("Payload should not contain the password! Payload: %s", payload)
+	}
+}
+
+type mockAuthenticator struct {
+	authenticate func(*group.SearchDetails, string, string) error
+}
+
+func (a *mockAuthenticator) Authenticate(_ context.Context, sd *group.SearchDetails, username, password string) error {
+	return a.authenticate(sd, username, password)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"github.com/HotelsDotCom/flyte-client/flyte"
+	ldapClient "gopkg.in/ldap.v2"
+)
+
+var dryRunCompletedEventDef = flyte.EventDef{Name: "DryRunCompleted"}
+
+type dryRunPayload struct {
+	Operation string               `json:"operation,omitempty"`
+	Username  string               `json:"username,omitempty"`
+	Group     string               `json:"group,omitempty"`
+	Rule      string               `json:"rule,omitempty"` // the policy rule that allowed the change
+	Flow      map[string]string    `json:"flow,omitempty"`
+	Changed   bool                 `json:"changed"` // whether the request would have changed the directory
+	Request   modifyRequestPayload `json:"request"`
+}
+
+// modifyRequestPayload is the LDAP modify request a dry run would have sent.
+type modifyRequestPayload struct {
+	DN      string                `json:"dn"`
+	Changes []modificationPayload `json:"changes"`
+}
+
+type modificationPayload struct {
+	Operation string   `json:"operation"` // 'add', 'delete' or 'replace'
+	Attribute string   `json:"attribute"`
+	Values    []string `json:"values"`
+}
+
+func newModifyRequestPayload(mr *ldapClient.ModifyRequest) modifyRequestPayload {
+	payload := modifyRequestPayload{DN: mr.DN, Changes: []modificationPayload{}}
+	for _, changes := range []struct {
+		operation  string
+		attributes []ldapClient.PartialAttribute
+	}{
+		{"add", mr.AddAttributes},
+		{"delete", mr.DeleteAttributes},
+		{"replace", mr.ReplaceAttributes},
+	} {
+		for _, attribute := range changes.attributes {
+			payload.Changes = append(payload.Changes, modificationPayload{
+				Operation: changes.operation,
+				Attribute: attribute.Type,
+				Values:    attribute.Vals,
+			})
+		}
+	}
+	return payload
+}
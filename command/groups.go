@@ -17,7 +17,9 @@ limitations under the License.
 package command
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
 	"github.com/ExpediaGroup/flyte-ldap/group"
 	"github.com/HotelsDotCom/flyte-client/flyte"
 )
@@ -28,27 +30,33 @@ var getGroupsSuccessEventDef = flyte.EventDef{Name: "GroupsRetrieved"}
 var getGroupsErrorEventDef = flyte.EventDef{Name: "GroupsRetrievalError"}
 
 type GetGroupsInput struct {
-	UserName string `json:"username"`
+	UserName   string `json:"username"`
+	Transitive *bool  `json:"transitive,omitempty"` // overrides whether inherited groups are resolved
+	Directory  string `json:"directory,omitempty"`  // the directory to search, the default directory if empty
 }
 
 type userGroupsPayload struct {
-	Username   string   `json:"username,omitempty"`
-	UserGroups []string `json:"usergroups,omitempty"`
-	ErrorText  string   `json:"error,omitempty"`
+	Username        string   `json:"username,omitempty"`
+	UserGroups      []string `json:"usergroups,omitempty"`
+	InheritedGroups []string `json:"inheritedgroups,omitempty"`
+	Cached          bool     `json:"cached,omitempty"` // the groups were found by an earlier search
+	ErrorText       string   `json:"error,omitempty"`
 }
 
-func GetGroupsCommand(searcher group.Searcher, searchDetails *group.SearchDetails) flyte.Command {
+func GetGroupsCommand(directories *directory.Registry) flyte.Command {
 	return flyte.Command{
 		Name:    getGroupsCommandName,
-		Handler: getGroupsHandler(searcher, searchDetails),
+		Handler: instrument(getGroupsCommandName, getGroupsHandler(directories)),
 		OutputEvents: []flyte.EventDef{
 			getGroupsSuccessEventDef,
+			userNotFoundEventDef,
+			ambiguousUserEventDef,
 			getGroupsErrorEventDef,
 		},
 	}
 }
 
-func getGroupsHandler(searcher group.Searcher, searchDetails *group.SearchDetails) flyte.CommandHandler {
+func getGroupsHandler(directories *directory.Registry) flyte.CommandHandler {
 	return func(input json.RawMessage) flyte.Event {
 		// unmarshall input
 		args := GetGroupsInput{}
@@ -61,8 +69,16 @@ func getGroupsHandler(searcher group.Searcher, searchDetails *group.SearchDetail
 			return NewGetGroupsErrorEvent("No Username provided.", "")
 		}
 
+		d, err := directories.Get(args.Directory)
+		if err != nil {
+			return NewGetGroupsErrorEvent(err.Error(), args.UserName)
+		}
+
 		// group search
-		userGroups, err := searcher.GetGroupsFor(searchDetails, args.UserName)
+		userGroups, err := d.Groups.GetGroupsFor(context.Background(), withTransitive(d.SearchDetails, args.Transitive), args.UserName)
+		if event, ok := userLookupErrorEvent(err, args.UserName); ok {
+			return event
+		}
 		if err != nil {
 			return NewGetGroupsErrorEvent(err.Error(), args.UserName)
 		}
@@ -70,13 +86,25 @@ func getGroupsHandler(searcher group.Searcher, searchDetails *group.SearchDetail
 		return flyte.Event{
 			EventDef: getGroupsSuccessEventDef,
 			Payload: userGroupsPayload{
-				UserGroups: userGroups,
-				Username:   args.UserName,
+				UserGroups:      userGroups.Direct.Names(),
+				InheritedGroups: userGroups.Inherited.Names(),
+				Username:        args.UserName,
+				Cached:          userGroups.Cached,
 			},
 		}
 	}
 }
 
+// withTransitive returns the search details with transitive resolution overridden by the command input, if set.
+func withTransitive(searchDetails *group.SearchDetails, transitive *bool) *group.SearchDetails {
+	if transitive == nil || *transitive == searchDetails.Transitive {
+		return searchDetails
+	}
+	sd := *searchDetails
+	sd.Transitive = *transitive
+	return &sd
+}
+
 func NewGetGroupsErrorEvent(errorText, username string) flyte.Event {
 	return flyte.Event{
 		EventDef: getGroupsErrorEventDef,
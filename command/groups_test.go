@@ -17,8 +17,10 @@ limitations under the License.
 package command
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
 	"github.com/ExpediaGroup/flyte-ldap/group"
 	"reflect"
 	"strings"
@@ -27,12 +29,12 @@ import (
 
 func TestGetGroupsCommand_shouldReturnGroupsUserIsAMemberOf(t *testing.T) {
 	mockSearcher := &mockSearcher{
-		groupsToReturn: func(sd *group.SearchDetails, username string) ([]string, error) {
-			return []string{"group1", "group2"}, nil
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return someUserGroups("group1", "group2"), nil
 		},
 	}
 
-	command := GetGroupsCommand(mockSearcher, someSearchDetails())
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
 	event := command.Handler(json.RawMessage(`{"username": "carlos"}`))
 
 	if event.EventDef != getGroupsSuccessEventDef {
@@ -50,9 +52,9 @@ func TestGetGroupsCommand_shouldReturnGroupsUserIsAMemberOf(t *testing.T) {
 func TestGetGroupsCommand_shouldPassSearchDetailsDirectlyToTheSearcherWithoutModification(t *testing.T) {
 	var searchDetailsPassedToSearcher *group.SearchDetails
 	mockSearcher := &mockSearcher{
-		groupsToReturn: func(sd *group.SearchDetails, username string) ([]string, error) {
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
 			searchDetailsPassedToSearcher = sd
-			return []string{"group1", "group2"}, nil
+			return someUserGroups("group1", "group2"), nil
 		},
 	}
 	searchDetails := &group.SearchDetails{
@@ -63,7 +65,7 @@ func TestGetGroupsCommand_shouldPassSearchDetailsDirectlyToTheSearcherWithoutMod
 		SearchTimeout:  20,
 	}
 
-	command := GetGroupsCommand(mockSearcher, searchDetails)
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: searchDetails}))
 	command.Handler(json.RawMessage(`{"username": "carlos"}`))
 
 	if !reflect.DeepEqual(searchDetailsPassedToSearcher, searchDetails) {
@@ -71,9 +73,51 @@ func TestGetGroupsCommand_shouldPassSearchDetailsDirectlyToTheSearcherWithoutMod
 	}
 }
 
+func TestGetGroupsCommand_shouldReturnInheritedGroupsSeparately(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			userGroups := someUserGroups("group1")
+			userGroups.Inherited = group.Groups{{Name: "parent1", DN: "CN=parent1,OU=Groups,DC=com"}}
+			return userGroups, nil
+		},
+	}
+
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos"}`))
+
+	payload := event.Payload.(userGroupsPayload)
+	if !reflect.DeepEqual(payload.UserGroups, []string{"group1"}) {
+		t.Errorf("The groups returned are wrong! Usergroups: %v", payload.UserGroups)
+	}
+	if !reflect.DeepEqual(payload.InheritedGroups, []string{"parent1"}) {
+		t.Errorf("The inherited groups returned are wrong! Inherited groups: %v", payload.InheritedGroups)
+	}
+}
+
+func TestGetGroupsCommand_shouldOverrideTransitiveFromInputWithoutModifyingSearchDetails(t *testing.T) {
+	var searchDetailsPassedToSearcher *group.SearchDetails
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			searchDetailsPassedToSearcher = sd
+			return someUserGroups("group1"), nil
+		},
+	}
+	searchDetails := someSearchDetails()
+
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: searchDetails}))
+	command.Handler(json.RawMessage(`{"username": "carlos", "transitive": true}`))
+
+	if !searchDetailsPassedToSearcher.Transitive {
+		t.Error("Search details passed to searcher should be transitive")
+	}
+	if searchDetails.Transitive {
+		t.Error("Configured search details should not have been modified")
+	}
+}
+
 func TestGetGroupsCommand_shouldReturnFatalErrorEventForJsonUnmarshallingError(t *testing.T) {
 	mockSearcher := &mockSearcher{}
-	command := GetGroupsCommand(mockSearcher, someSearchDetails())
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
 	event := command.Handler(json.RawMessage(`{"dodgy-json`))
 
 	if event.EventDef.Name != "FATAL" {
@@ -87,7 +131,7 @@ func TestGetGroupsCommand_shouldReturnFatalErrorEventForJsonUnmarshallingError(t
 
 func TestGetGroupsCommand_shouldReturnErrorEventIfUsernameNotProvided(t *testing.T) {
 	mockSearcher := &mockSearcher{}
-	command := GetGroupsCommand(mockSearcher, someSearchDetails())
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
 	event := command.Handler(json.RawMessage(`{}`))
 
 	if event.EventDef != getGroupsErrorEventDef {
@@ -101,12 +145,12 @@ func TestGetGroupsCommand_shouldReturnErrorEventIfUsernameNotProvided(t *testing
 
 func TestGetGroupsCommand_shouldReturnErrorEventIfClientReturnsError(t *testing.T) {
 	mockSearcher := &mockSearcher{
-		groupsToReturn: func(sd *group.SearchDetails, username string) ([]string, error) {
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
 			return nil, errors.New("Search went wrong!!")
 		},
 	}
 
-	command := GetGroupsCommand(mockSearcher, someSearchDetails())
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
 	event := command.Handler(json.RawMessage(`{"username": "carlos"}`))
 
 	if event.EventDef != getGroupsErrorEventDef {
@@ -121,6 +165,127 @@ func TestGetGroupsCommand_shouldReturnErrorEventIfClientReturnsError(t *testing.
 	}
 }
 
+func TestGetGroupsCommand_shouldReturnUserNotFoundEventIfUserIsNotFound(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return nil, &group.UserNotFoundError{Username: username}
+		},
+	}
+
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlso"}`))
+
+	if event.EventDef != userNotFoundEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	payload := event.Payload.(userLookupErrorPayload)
+	if payload.Username != "carlso" || payload.ErrorText != `User "carlso" not found` {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestGetGroupsCommand_shouldSayWhenGroupsAreCached(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return &group.UserGroups{Direct: group.Groups{{Name: "London team"}}, Cached: true}, nil
+		},
+	}
+
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos"}`))
+
+	payload := event.Payload.(userGroupsPayload)
+	if !payload.Cached {
+		t.Errorf("Payload should say the groups are cached! Payload: %+v", payload)
+	}
+}
+
+func TestGetGroupsCommand_shouldSayWhenUserNotFoundIsCached(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return nil, &group.UserNotFoundError{Username: username, Cached: true}
+		},
+	}
+
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlso"}`))
+
+	payload := event.Payload.(userLookupErrorPayload)
+	if event.EventDef != userNotFoundEventDef || !payload.Cached {
+		t.Errorf("Event should say the user not found is cached! Event: %+v", event)
+	}
+}
+
+func TestGetGroupsCommand_shouldReturnAmbiguousUserEventIfSeveralUsersAreFound(t *testing.T) {
+	dns := []string{"CN=carlos,OU=London,DC=com", "CN=carlos,OU=Paris,DC=com"}
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return nil, &group.AmbiguousUserError{Username: username, DNs: dns}
+		},
+	}
+
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos"}`))
+
+	if event.EventDef != ambiguousUserEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	payload := event.Payload.(userLookupErrorPayload)
+	if payload.Username != "carlos" || !reflect.DeepEqual(payload.Matches, dns) {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestGetGroupsCommand_shouldSearchTheDirectoryNamedInTheInput(t *testing.T) {
+	searcherFor := func(groupName string) *mockSearcher {
+		return searcherReturning(someUserGroups(groupName))
+	}
+	directories, err := directory.NewRegistry("corp",
+		&directory.Directory{Name: "corp", Groups: searcherFor("corp-group"), SearchDetails: someSearchDetails()},
+		&directory.Directory{Name: "partner", Groups: searcherFor("partner-group"), SearchDetails: someSearchDetails()},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	command := GetGroupsCommand(directories)
+
+	for input, expected := range map[string]string{
+		`{"username": "carlos"}`:                         "corp-group",
+		`{"username": "carlos", "directory": "partner"}`: "partner-group",
+	} {
+		event := command.Handler(json.RawMessage(input))
+
+		if payload := event.Payload.(userGroupsPayload); !reflect.DeepEqual(payload.UserGroups, []string{expected}) {
+			t.Errorf("Groups are wrong for %s! Usergroups: %v", input, payload.UserGroups)
+		}
+	}
+}
+
+func TestGetGroupsCommand_shouldReturnErrorEventForUnknownDirectory(t *testing.T) {
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: &mockSearcher{}, SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "directory": "elsewhere"}`))
+
+	if event.EventDef != getGroupsErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(userGroupsPayload); payload.ErrorText != `Unknown directory "elsewhere"` {
+		t.Errorf("Error text is wrong! Error text: %v", payload.ErrorText)
+	}
+}
+
+// directoriesWith returns a registry holding just the given directory, named 'default' if it has no name.
+func directoriesWith(d directory.Directory) *directory.Registry {
+	if d.Name == "" {
+		d.Name = "default"
+	}
+	directories, err := directory.NewRegistry(d.Name, &d)
+	if err != nil {
+		panic(err)
+	}
+	return directories
+}
+
 func someSearchDetails() *group.SearchDetails {
 	return &group.SearchDetails{
 		Attributes:     []string{"memberOf"},
@@ -131,10 +296,34 @@ func someSearchDetails() *group.SearchDetails {
 	}
 }
 
+func someUserGroups(names ...string) *group.UserGroups {
+	userGroups := &group.UserGroups{Direct: group.Groups{}, Inherited: group.Groups{}}
+	for _, name := range names {
+		userGroups.Direct = append(userGroups.Direct, group.Group{Name: name, DN: "CN=" + name + ",OU=Groups,DC=com"})
+	}
+	return userGroups
+}
+
 type mockSearcher struct {
-	groupsToReturn func(*group.SearchDetails, string) ([]string, error)
+	groupsToReturn  func(*group.SearchDetails, string) (*group.UserGroups, error)
+	membersToReturn func(*group.SearchDetails, string) (group.Members, error)
+	groupDNToReturn func(*group.SearchDetails, string) (string, error) // a name is in 'OU=Groups,DC=com' if nil
 }
 
-func (c *mockSearcher) GetGroupsFor(sd *group.SearchDetails, username string) ([]string, error) {
+func (c *mockSearcher) GetGroupsFor(_ context.Context, sd *group.SearchDetails, username string) (*group.UserGroups, error) {
 	return c.groupsToReturn(sd, username)
 }
+
+func (c *mockSearcher) GetMembersOf(_ context.Context, sd *group.SearchDetails, nameOrDN string) (group.Members, error) {
+	return c.membersToReturn(sd, nameOrDN)
+}
+
+func (c *mockSearcher) GetGroupDN(_ context.Context, sd *group.SearchDetails, nameOrDN string) (string, error) {
+	if c.groupDNToReturn != nil {
+		return c.groupDNToReturn(sd, nameOrDN)
+	}
+	if dn, err := group.ParseDN(nameOrDN); err == nil && len(dn) > 0 {
+		return nameOrDN, nil
+	}
+	return "CN=" + nameOrDN + ",OU=Groups,DC=com", nil
+}
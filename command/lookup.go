@@ -0,0 +1,54 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+)
+
+var userNotFoundEventDef = flyte.EventDef{Name: "UserNotFound"}
+var ambiguousUserEventDef = flyte.EventDef{Name: "AmbiguousUser"}
+
+type userLookupErrorPayload struct {
+	Username  string   `json:"username,omitempty"`
+	Matches   []string `json:"matches,omitempty"` // the DNs of the users an ambiguous username matched
+	Cached    bool     `json:"cached,omitempty"`  // the user was found not to exist by an earlier search
+	ErrorText string   `json:"error,omitempty"`
+}
+
+// userLookupErrorEvent returns the UserNotFound or AmbiguousUser event for an error finding a user, so flows can tell
+// a username that matched no one, or several people, from a user with no groups. It returns false for other errors.
+func userLookupErrorEvent(err error, username string) (flyte.Event, bool) {
+	var notFound *group.UserNotFoundError
+	if errors.As(err, &notFound) {
+		return flyte.Event{
+			EventDef: userNotFoundEventDef,
+			Payload:  userLookupErrorPayload{Username: username, Cached: notFound.Cached, ErrorText: err.Error()},
+		}, true
+	}
+
+	var ambiguous *group.AmbiguousUserError
+	if errors.As(err, &ambiguous) {
+		return flyte.Event{
+			EventDef: ambiguousUserEventDef,
+			Payload:  userLookupErrorPayload{Username: username, Matches: ambiguous.DNs, ErrorText: err.Error()},
+		}, true
+	}
+	return flyte.Event{}, false
+}
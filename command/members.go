@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+)
+
+const getGroupMembersCommandName = "GetGroupMembers"
+
+var getGroupMembersSuccessEventDef = flyte.EventDef{Name: "GroupMembersRetrieved"}
+var getGroupMembersErrorEventDef = flyte.EventDef{Name: "GroupMembersRetrievalError"}
+
+type GetGroupMembersInput struct {
+	Group      string `json:"group"`                // the group name, e.g. 'London team', or its full DN
+	Transitive *bool  `json:"transitive,omitempty"` // overrides whether the members of nested groups are resolved
+	Directory  string `json:"directory,omitempty"`  // the directory to search, the default directory if empty
+}
+
+type groupMembersPayload struct {
+	Group     string          `json:"group,omitempty"`
+	Members   []memberPayload `json:"members,omitempty"`
+	ErrorText string          `json:"error,omitempty"`
+}
+
+type memberPayload struct {
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	Inherited  bool                `json:"inherited,omitempty"`
+	Unexpanded bool                `json:"unexpanded,omitempty"`
+}
+
+func GetGroupMembersCommand(directories *directory.Registry) flyte.Command {
+	return flyte.Command{
+		Name:    getGroupMembersCommandName,
+		Handler: instrument(getGroupMembersCommandName, getGroupMembersHandler(directories)),
+		OutputEvents: []flyte.EventDef{
+			getGroupMembersSuccessEventDef,
+			getGroupMembersErrorEventDef,
+		},
+	}
+}
+
+func getGroupMembersHandler(directories *directory.Registry) flyte.CommandHandler {
+	return func(input json.RawMessage) flyte.Event {
+		// unmarshall input
+		args := GetGroupMembersInput{}
+		if err := json.Unmarshal(input, &args); err != nil {
+			return flyte.NewFatalEvent(groupMembersPayload{
+				ErrorText: "Json unmarshalling error: " + err.Error(),
+			})
+		}
+		if args.Group == "" {
+			return newGetGroupMembersErrorEvent("No Group provided.", "")
+		}
+
+		d, err := directories.Get(args.Directory)
+		if err != nil {
+			return newGetGroupMembersErrorEvent(err.Error(), args.Group)
+		}
+
+		// member search
+		members, err := d.Groups.GetMembersOf(context.Background(), withTransitive(d.SearchDetails, args.Transitive), args.Group)
+		if err != nil {
+			return newGetGroupMembersErrorEvent(err.Error(), args.Group)
+		}
+
+		payload := groupMembersPayload{Group: args.Group, Members: make([]memberPayload, len(members))}
+		for i, member := range members {
+			payload.Members[i] = memberPayload{DN: member.DN, Attributes: member.Attributes, Inherited: member.Inherited, Unexpanded: member.Unexpanded}
+		}
+		return flyte.Event{
+			EventDef: getGroupMembersSuccessEventDef,
+			Payload:  payload,
+		}
+	}
+}
+
+func newGetGroupMembersErrorEvent(errorText, group string) flyte.Event {
+	return flyte.Event{
+		EventDef: getGroupMembersErrorEventDef,
+		Payload: groupMembersPayload{
+			Group:     group,
+			ErrorText: errorText,
+		},
+	}
+}
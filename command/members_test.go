@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"reflect"
+	"testing"
+)
+
+func TestGetGroupMembersCommand_shouldReturnMembersOfGroup(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		membersToReturn: func(sd *group.SearchDetails, nameOrDN string) (group.Members, error) {
+			return group.Members{
+				{DN: "CN=alice,OU=Users,DC=com", Attributes: map[string][]string{"mail": {"alice@example.com"}}},
+				{DN: "CN=bob,OU=Users,DC=com", Attributes: map[string][]string{}, Inherited: true},
+				{DN: "CN=deep,OU=Groups,DC=com", Attributes: map[string][]string{}, Inherited: true, Unexpanded: true},
+			}, nil
+		},
+	}
+
+	command := GetGroupMembersCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"group": "team"}`))
+
+	if event.EventDef != getGroupMembersSuccessEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	expected := groupMembersPayload{
+		Group: "team",
+		Members: []memberPayload{
+			{DN: "CN=alice,OU=Users,DC=com", Attributes: map[string][]string{"mail": {"alice@example.com"}}},
+			{DN: "CN=bob,OU=Users,DC=com", Attributes: map[string][]string{}, Inherited: true},
+			{DN: "CN=deep,OU=Groups,DC=com", Attributes: map[string][]string{}, Inherited: true, Unexpanded: true},
+		},
+	}
+	if payload := event.Payload.(groupMembersPayload); !reflect.DeepEqual(payload, expected) {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestGetGroupMembersCommand_shouldPassGroupAndTransitiveOverrideToTheSearcher(t *testing.T) {
+	var searchDetailsPassedToSearcher *group.SearchDetails
+	var groupPassedToSearcher string
+	mockSearcher := &mockSearcher{
+		membersToReturn: func(sd *group.SearchDetails, nameOrDN string) (group.Members, error) {
+			searchDetailsPassedToSearcher, groupPassedToSearcher = sd, nameOrDN
+			return group.Members{}, nil
+		},
+	}
+	searchDetails := someSearchDetails()
+
+	command := GetGroupMembersCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: searchDetails}))
+	command.Handler(json.RawMessage(`{"group": "CN=team,OU=Groups,DC=com", "transitive": true}`))
+
+	if groupPassedToSearcher != "CN=team,OU=Groups,DC=com" {
+		t.Errorf("Group passed to searcher is wrong: %v", groupPassedToSearcher)
+	}
+	if !searchDetailsPassedToSearcher.Transitive || searchDetails.Transitive {
+		t.Error("Only the search details passed to searcher should be transitive")
+	}
+}
+
+func TestGetGroupMembersCommand_shouldReturnErrorEventIfGroupNotProvided(t *testing.T) {
+	command := GetGroupMembersCommand(directoriesWith(directory.Directory{Groups: &mockSearcher{}, SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{}`))
+
+	if event.EventDef != getGroupMembersErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(groupMembersPayload); payload.ErrorText != "No Group provided." {
+		t.Errorf("Error text is wrong! Error text: %v", payload.ErrorText)
+	}
+}
+
+func TestGetGroupMembersCommand_shouldReturnErrorEventIfSearcherReturnsError(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		membersToReturn: func(sd *group.SearchDetails, nameOrDN string) (group.Members, error) {
+			return nil, errors.New("Search went wrong!!")
+		},
+	}
+
+	command := GetGroupMembersCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"group": "team"}`))
+
+	if event.EventDef != getGroupMembersErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	payload := event.Payload.(groupMembersPayload)
+	if payload.ErrorText != "Search went wrong!!" || payload.Group != "team" {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestGetGroupMembersCommand_shouldReturnFatalErrorEventForJsonUnmarshallingError(t *testing.T) {
+	command := GetGroupMembersCommand(directoriesWith(directory.Directory{Groups: &mockSearcher{}, SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"dodgy-json`))
+
+	if event.EventDef.Name != "FATAL" {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+)
+
+const isMemberOfCommandName = "IsMemberOf"
+
+var isMemberEventDef = flyte.EventDef{Name: "UserIsMember"}
+var isNotMemberEventDef = flyte.EventDef{Name: "UserIsNotMember"}
+var membershipCheckErrorEventDef = flyte.EventDef{Name: "MembershipCheckError"}
+
+type IsMemberOfInput struct {
+	UserName   string `json:"username"`
+	Group      string `json:"group"`                // the group name, e.g. 'London team', or its full DN
+	Transitive *bool  `json:"transitive,omitempty"` // overrides whether membership through nested groups counts
+	Directory  string `json:"directory,omitempty"`  // the directory to search, the default directory if empty
+}
+
+type membershipPayload struct {
+	Username  string `json:"username,omitempty"`
+	Group     string `json:"group,omitempty"`
+	GroupDN   string `json:"groupdn,omitempty"`
+	Inherited bool   `json:"inherited,omitempty"` // whether the user is only a member through nested groups
+	Cached    bool   `json:"cached,omitempty"`    // the user's groups were found by an earlier search
+	ErrorText string `json:"error,omitempty"`
+}
+
+func IsMemberOfCommand(directories *directory.Registry) flyte.Command {
+	return flyte.Command{
+		Name:    isMemberOfCommandName,
+		Handler: instrument(isMemberOfCommandName, isMemberOfHandler(directories)),
+		OutputEvents: []flyte.EventDef{
+			isMemberEventDef,
+			isNotMemberEventDef,
+			userNotFoundEventDef,
+			ambiguousUserEventDef,
+			membershipCheckErrorEventDef,
+		},
+	}
+}
+
+func isMemberOfHandler(directories *directory.Registry) flyte.CommandHandler {
+	return func(input json.RawMessage) flyte.Event {
+		// unmarshall input
+		args := IsMemberOfInput{}
+		if err := json.Unmarshal(input, &args); err != nil {
+			return flyte.NewFatalEvent(membershipPayload{
+				ErrorText: "Json unmarshalling error: " + err.Error(),
+			})
+		}
+		if args.UserName == "" {
+			return newMembershipCheckErrorEvent("No Username provided.", args)
+		}
+		if args.Group == "" {
+			return newMembershipCheckErrorEvent("No Group provided.", args)
+		}
+
+		d, err := directories.Get(args.Directory)
+		if err != nil {
+			return newMembershipCheckErrorEvent(err.Error(), args)
+		}
+
+		// group search
+		userGroups, err := d.Groups.GetGroupsFor(context.Background(), withTransitive(d.SearchDetails, args.Transitive), args.UserName)
+		if event, ok := userLookupErrorEvent(err, args.UserName); ok {
+			return event
+		}
+		if err != nil {
+			return newMembershipCheckErrorEvent(err.Error(), args)
+		}
+
+		// a name stands for the one group it finds under the group base DN, not any group of that name the user is in
+		groupDN, err := d.Groups.GetGroupDN(context.Background(), d.SearchDetails, args.Group)
+		if err != nil {
+			return newMembershipCheckErrorEvent(err.Error(), args)
+		}
+		if g, found := userGroups.Direct.Find(groupDN); found {
+			return newMembershipEvent(isMemberEventDef, args, g, false, userGroups.Cached)
+		}
+		if g, found := userGroups.Inherited.Find(groupDN); found {
+			return newMembershipEvent(isMemberEventDef, args, g, true, userGroups.Cached)
+		}
+		return newMembershipEvent(isNotMemberEventDef, args, group.Group{}, false, userGroups.Cached)
+	}
+}
+
+func newMembershipEvent(eventDef flyte.EventDef, args IsMemberOfInput, g group.Group, inherited, cached bool) flyte.Event {
+	return flyte.Event{
+		EventDef: eventDef,
+		Payload: membershipPayload{
+			Username:  args.UserName,
+			Group:     args.Group,
+			GroupDN:   g.DN,
+			Inherited: inherited,
+			Cached:    cached,
+		},
+	}
+}
+
+func newMembershipCheckErrorEvent(errorText string, args IsMemberOfInput) flyte.Event {
+	return flyte.Event{
+		EventDef: membershipCheckErrorEventDef,
+		Payload: membershipPayload{
+			Username:  args.UserName,
+			Group:     args.Group,
+			ErrorText: errorText,
+		},
+	}
+}
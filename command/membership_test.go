@@ -0,0 +1,195 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"testing"
+)
+
+func TestIsMemberOfCommand_shouldReturnUserIsMemberForGroupName(t *testing.T) {
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: searcherReturning(someUserGroups("group1", "group2")), SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "group": "GROUP2"}`))
+
+	if event.EventDef != isMemberEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	payload := event.Payload.(membershipPayload)
+	if payload.Username != "carlos" || payload.Group != "GROUP2" {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+	if payload.GroupDN != "CN=group2,OU=Groups,DC=com" || payload.Inherited {
+		t.Errorf("Matched group is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnUserIsMemberForGroupDN(t *testing.T) {
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: searcherReturning(someUserGroups("group1", "group2")), SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "group": "cn=group1,ou=groups,dc=com"}`))
+
+	if event.EventDef != isMemberEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnUserIsMemberThroughInheritedGroup(t *testing.T) {
+	userGroups := someUserGroups("group1")
+	userGroups.Inherited = group.Groups{{Name: "parent1", DN: "CN=parent1,OU=Groups,DC=com"}}
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: searcherReturning(userGroups), SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "group": "parent1", "transitive": true}`))
+
+	if event.EventDef != isMemberEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(membershipPayload); !payload.Inherited {
+		t.Errorf("Membership should be inherited! Payload: %+v", payload)
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnUserIsNotMember(t *testing.T) {
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: searcherReturning(someUserGroups("group1", "group2")), SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "group": "CN=group1,OU=Other,DC=com"}`))
+
+	if event.EventDef != isNotMemberEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(membershipPayload); payload.GroupDN != "" {
+		t.Errorf("No group should have matched! Payload: %+v", payload)
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnUserIsNotMemberOfGroupOfThatNameElsewhere(t *testing.T) {
+	userGroups := &group.UserGroups{Direct: group.Groups{{Name: "Admins", DN: "CN=Admins,OU=Sandbox,DC=com"}}, Inherited: group.Groups{}}
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: searcherReturning(userGroups), SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "group": "Admins"}`))
+
+	if event.EventDef != isNotMemberEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnErrorEventIfGroupNameIsNotFoundOrAmbiguous(t *testing.T) {
+	mockSearcher := searcherReturning(someUserGroups("group1"))
+	mockSearcher.groupDNToReturn = func(sd *group.SearchDetails, nameOrDN string) (string, error) {
+		return "", errors.New(`Group "group1" is ambiguous, 2 groups found`)
+	}
+
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "group": "group1"}`))
+
+	if event.EventDef != membershipCheckErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(membershipPayload); payload.ErrorText != `Group "group1" is ambiguous, 2 groups found` {
+		t.Errorf("Error is wrong! Error: %v", payload.ErrorText)
+	}
+}
+
+func TestIsMemberOfCommand_shouldPassTransitiveOverrideToTheSearcher(t *testing.T) {
+	var searchDetailsPassedToSearcher *group.SearchDetails
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			searchDetailsPassedToSearcher = sd
+			return someUserGroups(), nil
+		},
+	}
+
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	command.Handler(json.RawMessage(`{"username": "carlos", "group": "group1", "transitive": true}`))
+
+	if !searchDetailsPassedToSearcher.Transitive {
+		t.Error("Search details passed to searcher should be transitive")
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnErrorEventIfUsernameOrGroupNotProvided(t *testing.T) {
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: searcherReturning(someUserGroups()), SearchDetails: someSearchDetails()}))
+
+	for input, errorText := range map[string]string{
+		`{"group": "group1"}`:    "No Username provided.",
+		`{"username": "carlos"}`: "No Group provided.",
+	} {
+		event := command.Handler(json.RawMessage(input))
+
+		if event.EventDef != membershipCheckErrorEventDef {
+			t.Errorf("EventDef is wrong for %s! EventDef: %v", input, event.EventDef)
+		}
+		if payload := event.Payload.(membershipPayload); payload.ErrorText != errorText {
+			t.Errorf("Error is wrong for %s! Error: %v", input, payload.ErrorText)
+		}
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnErrorEventIfSearcherReturnsError(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return nil, errors.New("Search went wrong!!")
+		},
+	}
+
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "group": "group1"}`))
+
+	if event.EventDef != membershipCheckErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	payload := event.Payload.(membershipPayload)
+	if payload.ErrorText != "Search went wrong!!" || payload.Username != "carlos" || payload.Group != "group1" {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnUserNotFoundEventRatherThanUserIsNotMember(t *testing.T) {
+	mockSearcher := &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return nil, &group.UserNotFoundError{Username: username}
+		},
+	}
+
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: mockSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlso", "group": "group1"}`))
+
+	if event.EventDef != userNotFoundEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+func TestIsMemberOfCommand_shouldReturnFatalErrorEventForJsonUnmarshallingError(t *testing.T) {
+	command := IsMemberOfCommand(directoriesWith(directory.Directory{Groups: searcherReturning(someUserGroups()), SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"username": 1}`))
+
+	if event.EventDef.Name != "FATAL" {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+func searcherReturning(userGroups *group.UserGroups) *mockSearcher {
+	return &mockSearcher{
+		groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+			return userGroups, nil
+		},
+	}
+}
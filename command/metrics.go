@@ -0,0 +1,50 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"encoding/json"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var (
+	commandEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "flyte_ldap",
+		Name:      "command_events_total",
+		Help:      "Events returned by each command, by event name, e.g. 'GroupsRetrieved' or 'GroupsRetrievalError'.",
+	}, []string{"command", "event"})
+
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "flyte_ldap",
+		Name:      "command_duration_seconds",
+		Help:      "Time taken to handle each command.",
+	}, []string{"command"})
+)
+
+// instrument counts the events the command's handler returns, and times it.
+func instrument(commandName string, handler flyte.CommandHandler) flyte.CommandHandler {
+	return func(input json.RawMessage) flyte.Event {
+		start := time.Now()
+		event := handler(input)
+		commandDuration.WithLabelValues(commandName).Observe(time.Since(start).Seconds())
+		commandEvents.WithLabelValues(commandName, event.EventDef.Name).Inc()
+		return event
+	}
+}
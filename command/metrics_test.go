@@ -0,0 +1,36 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"encoding/json"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+func TestInstrument_shouldCountEventsByName(t *testing.T) {
+	counter := commandEvents.WithLabelValues(getGroupsCommandName, getGroupsErrorEventDef.Name)
+	before := testutil.ToFloat64(counter)
+
+	command := GetGroupsCommand(directoriesWith(directory.Directory{Groups: &mockSearcher{}, SearchDetails: someSearchDetails()}))
+	command.Handler(json.RawMessage(`{"username": ""}`))
+
+	if counted := testutil.ToFloat64(counter) - before; counted != 1 {
+		t.Errorf("Should've counted one %s event, counted: %v", getGroupsErrorEventDef.Name, counted)
+	}
+}
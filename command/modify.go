@@ -0,0 +1,173 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/policy"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+)
+
+const addUserToGroupCommandName = "AddUserToGroup"
+const removeUserFromGroupCommandName = "RemoveUserFromGroup"
+
+var membershipChangedEventDef = flyte.EventDef{Name: "GroupMembershipChanged"}
+var membershipChangeErrorEventDef = flyte.EventDef{Name: "GroupMembershipChangeError"}
+
+type ChangeGroupMembershipInput struct {
+	UserName  string            `json:"username"`
+	Group     string            `json:"group"`               // the group name, e.g. 'London team', or its full DN
+	Directory string            `json:"directory,omitempty"` // the directory to change, the default directory if empty
+	Flow      map[string]string `json:"flow,omitempty"`      // metadata of the requesting flow, for the policy's rules
+	DryRun    bool              `json:"dryRun,omitempty"`    // check the change, and return the request, without making it
+}
+
+type membershipChangePayload struct {
+	Username  string `json:"username,omitempty"`
+	Group     string `json:"group,omitempty"`
+	Action    string `json:"action,omitempty"` // 'add' or 'remove'
+	UserDN    string `json:"userdn,omitempty"`
+	GroupDN   string `json:"groupdn,omitempty"`
+	Changed   bool   `json:"changed"` // false if the user already was, or already was not, a member
+	ErrorText string `json:"error,omitempty"`
+}
+
+// AddUserToGroupCommand adds users to groups, only rehearsing each change if dryRun is set, whatever the input.
+func AddUserToGroupCommand(directories *directory.Registry, dryRun bool) flyte.Command {
+	return flyte.Command{
+		Name:    addUserToGroupCommandName,
+		Handler: instrument(addUserToGroupCommandName, changeMembershipHandler(directories, addUserToGroupCommandName, "add", dryRun)),
+		OutputEvents: []flyte.EventDef{
+			membershipChangedEventDef,
+			dryRunCompletedEventDef,
+			operationDeniedEventDef,
+			membershipChangeErrorEventDef,
+		},
+	}
+}
+
+// RemoveUserFromGroupCommand removes users from groups, only rehearsing each change if dryRun is set, whatever the
+// input.
+func RemoveUserFromGroupCommand(directories *directory.Registry, dryRun bool) flyte.Command {
+	return flyte.Command{
+		Name:    removeUserFromGroupCommandName,
+		Handler: instrument(removeUserFromGroupCommandName, changeMembershipHandler(directories, removeUserFromGroupCommandName, "remove", dryRun)),
+		OutputEvents: []flyte.EventDef{
+			membershipChangedEventDef,
+			dryRunCompletedEventDef,
+			operationDeniedEventDef,
+			membershipChangeErrorEventDef,
+		},
+	}
+}
+
+// changeMembershipHandler adds the user to, or removes the user from, the group, as action is 'add' or 'remove', if
+// the directory's policy allows the command to. A dry run, if dryRun or the input asks for one, finds the user and
+// group and checks the policy the same, but returns the request rather than sending it.
+func changeMembershipHandler(directories *directory.Registry, commandName, action string, dryRun bool) flyte.CommandHandler {
+	return func(input json.RawMessage) flyte.Event {
+		// unmarshall input
+		args := ChangeGroupMembershipInput{}
+		if err := json.Unmarshal(input, &args); err != nil {
+			return flyte.NewFatalEvent(membershipChangePayload{
+				Action:    action,
+				ErrorText: "Json unmarshalling error: " + err.Error(),
+			})
+		}
+		if args.UserName == "" {
+			return newMembershipChangeErrorEvent("No Username provided.", args, action)
+		}
+		if args.Group == "" {
+			return newMembershipChangeErrorEvent("No Group provided.", args, action)
+		}
+
+		d, err := directories.Get(args.Directory)
+		if err != nil {
+			return newMembershipChangeErrorEvent(err.Error(), args, action)
+		}
+
+		// membership change
+		change := d.Members.AddMember
+		if action == "remove" {
+			change = d.Members.RemoveMember
+		}
+		var decision policy.Decision
+		authorize := func(change *group.MembershipChange) error {
+			var err error
+			decision, err = d.Policy.Authorize(policy.Request{
+				Operation:  commandName,
+				Target:     change.Group.DN,
+				Attributes: []string{change.Attribute},
+				Flow:       args.Flow,
+			})
+			return err
+		}
+		options := group.ModifyOptions{ModifiableGroups: d.ModifiableGroups, Authorize: authorize, DryRun: dryRun || args.DryRun}
+		membershipChange, err := change(context.Background(), d.SearchDetails, args.UserName, args.Group, options)
+		denied := operationDeniedPayload{Operation: commandName, Username: args.UserName, Group: args.Group, Flow: args.Flow}
+		if event, ok := operationDeniedEvent(err, denied); ok {
+			return event
+		}
+		if err != nil {
+			return newMembershipChangeErrorEvent(err.Error(), args, action)
+		}
+		if options.DryRun {
+			return flyte.Event{
+				EventDef: dryRunCompletedEventDef,
+				Payload: dryRunPayload{
+					Operation: commandName,
+					Username:  args.UserName,
+					Group:     args.Group,
+					Rule:      decision.Rule,
+					Flow:      args.Flow,
+					Changed:   membershipChange.Changed,
+					Request:   newModifyRequestPayload(membershipChange.Request),
+				},
+			}
+		}
+		if membershipChange.Changed {
+			group.Forget(d.Groups, args.UserName)
+		}
+
+		return flyte.Event{
+			EventDef: membershipChangedEventDef,
+			Payload: membershipChangePayload{
+				Username: args.UserName,
+				Group:    args.Group,
+				Action:   action,
+				UserDN:   membershipChange.UserDN,
+				GroupDN:  membershipChange.Group.DN,
+				Changed:  membershipChange.Changed,
+			},
+		}
+	}
+}
+
+func newMembershipChangeErrorEvent(errorText string, args ChangeGroupMembershipInput, action string) flyte.Event {
+	return flyte.Event{
+		EventDef: membershipChangeErrorEventDef,
+		Payload: membershipChangePayload{
+			Username:  args.UserName,
+			Group:     args.Group,
+			Action:    action,
+			ErrorText: errorText,
+		},
+	}
+}
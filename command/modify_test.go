@@ -0,0 +1,313 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/policy"
+	ldapClient "gopkg.in/ldap.v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddUserToGroupCommand_shouldReturnGroupMembershipChanged(t *testing.T) {
+	var usernamePassed, groupPassed string
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		if !add {
+			t.Error("Should've added the user")
+		}
+		usernamePassed, groupPassed = username, groupName
+		return &group.MembershipChange{UserDN: "CN=dave,DC=com", Group: group.Group{Name: "team", DN: "CN=team,DC=com"}, Changed: true}, nil
+	}}
+
+	command := AddUserToGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails(), Policy: allowAll()}), false)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "team"}`))
+
+	if event.EventDef != membershipChangedEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if usernamePassed != "dave" || groupPassed != "team" {
+		t.Errorf("Username or group passed to modifier is wrong: %q, %q", usernamePassed, groupPassed)
+	}
+	expected := membershipChangePayload{Username: "dave", Group: "team", Action: "add", UserDN: "CN=dave,DC=com", GroupDN: "CN=team,DC=com", Changed: true}
+	if payload := event.Payload.(membershipChangePayload); payload != expected {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestRemoveUserFromGroupCommand_shouldReturnUnchangedMembership(t *testing.T) {
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		if add {
+			t.Error("Should've removed the user")
+		}
+		return &group.MembershipChange{UserDN: "CN=dave,DC=com", Group: group.Group{Name: "team", DN: "CN=team,DC=com"}}, nil
+	}}
+
+	command := RemoveUserFromGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails(), Policy: allowAll()}), false)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "team"}`))
+
+	if event.EventDef != membershipChangedEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(membershipChangePayload); payload.Changed || payload.Action != "remove" {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestAddUserToGroupCommand_shouldForgetCachedGroupsOfUserOnceChanged(t *testing.T) {
+	searches := 0
+	searcher := &mockSearcher{groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+		searches++
+		return someUserGroups(), nil
+	}}
+	cache := group.NewCachingSearcher(searcher, "default", group.CacheOptions{TTL: time.Minute})
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		return &group.MembershipChange{Group: group.Group{DN: "CN=team,DC=com"}, Attribute: "member", Changed: true}, nil
+	}}
+	directories := directoriesWith(directory.Directory{Members: modifier, Groups: cache, SearchDetails: someSearchDetails(), Policy: allowAll()})
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+
+	AddUserToGroupCommand(directories, false).Handler(json.RawMessage(`{"username": "dave", "group": "team"}`))
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+
+	if searches != 2 {
+		t.Errorf("Groups of dave should have been searched for again, searched: %d", searches)
+	}
+}
+
+func TestAddUserToGroupCommand_shouldReturnErrorEventIfModifierReturnsError(t *testing.T) {
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		return nil, errors.New("LDAP modify error: insufficient access")
+	}}
+
+	command := AddUserToGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails(), Policy: allowAll()}), false)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "admins"}`))
+
+	if event.EventDef != membershipChangeErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	expected := membershipChangePayload{Username: "dave", Group: "admins", Action: "add", ErrorText: "LDAP modify error: insufficient access"}
+	if payload := event.Payload.(membershipChangePayload); payload != expected {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestAddUserToGroupCommand_shouldReturnOperationDeniedIfGroupIsNotModifiable(t *testing.T) {
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		return nil, &group.GroupNotModifiableError{Group: groupName, DN: "CN=admins,DC=com"}
+	}}
+
+	command := AddUserToGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails(), ModifiableGroups: []string{"team"}, Policy: allowAll()}), false)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "admins"}`))
+
+	if event.EventDef != operationDeniedEventDef {
+		t.Fatalf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if !reflect.DeepEqual(modifier.options.ModifiableGroups, []string{"team"}) {
+		t.Errorf("Modifiable groups passed to modifier are wrong: %v", modifier.options.ModifiableGroups)
+	}
+	expected := operationDeniedPayload{
+		Operation: "AddUserToGroup",
+		Username:  "dave",
+		Group:     "admins",
+		Target:    "CN=admins,DC=com",
+		Rule:      "modifiable-groups",
+		ErrorText: `Group "admins" cannot be modified`,
+	}
+	if payload := event.Payload.(operationDeniedPayload); !reflect.DeepEqual(payload, expected) {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestAddUserToGroupCommand_shouldReturnErrorEventIfUsernameOrGroupNotProvided(t *testing.T) {
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		return nil, errors.New("Should not have been called")
+	}}
+	command := AddUserToGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails(), Policy: allowAll()}), false)
+
+	tests := map[string]string{
+		`{"group": "team"}`:    "No Username provided.",
+		`{"username": "dave"}`: "No Group provided.",
+	}
+	for input, expected := range tests {
+		event := command.Handler(json.RawMessage(input))
+
+		if event.EventDef != membershipChangeErrorEventDef || event.Payload.(membershipChangePayload).ErrorText != expected {
+			t.Errorf("Event for %s is wrong: %+v", input, event)
+		}
+	}
+}
+
+func TestRemoveUserFromGroupCommand_shouldReturnFatalErrorEventForJsonUnmarshallingError(t *testing.T) {
+	command := RemoveUserFromGroupCommand(directoriesWith(directory.Directory{Members: &mockModifier{}, Groups: &mockSearcher{}, SearchDetails: someSearchDetails()}), false)
+	event := command.Handler(json.RawMessage(`{"username": 1}`))
+
+	if event.EventDef.Name != "FATAL" {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+func TestAddUserToGroupCommand_shouldReturnOperationDeniedNamingTheRule(t *testing.T) {
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		return &group.MembershipChange{UserDN: "CN=dave,DC=com", Group: group.Group{Name: "admins", DN: "CN=admins,OU=Groups,DC=com"}, Attribute: "member", Changed: true}, nil
+	}}
+	rules, _ := policy.New([]policy.Rule{
+		{Name: "access-groups", Effect: policy.Allow, Subtrees: []string{"OU=Groups,DC=com"}},
+		{Name: "no-admins", Effect: policy.Deny, Groups: []string{"CN=*admins*,OU=Groups,DC=com"}},
+	})
+
+	command := AddUserToGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails(), Policy: rules}), false)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "admins", "flow": {"name": "access-request"}}`))
+
+	if event.EventDef != operationDeniedEventDef {
+		t.Fatalf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	expected := operationDeniedPayload{
+		Operation: "AddUserToGroup",
+		Username:  "dave",
+		Group:     "admins",
+		Target:    "CN=admins,OU=Groups,DC=com",
+		Rule:      "no-admins",
+		Flow:      map[string]string{"name": "access-request"},
+		ErrorText: `AddUserToGroup on "CN=admins,OU=Groups,DC=com" denied by policy rule "no-admins"`,
+	}
+	if payload := event.Payload.(operationDeniedPayload); !reflect.DeepEqual(payload, expected) {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestRemoveUserFromGroupCommand_shouldBeDeniedByDefault(t *testing.T) {
+	modifier := &mockModifier{change: func(add bool, username, groupName string) (*group.MembershipChange, error) {
+		return &group.MembershipChange{Group: group.Group{DN: "CN=team,DC=com"}, Attribute: "member"}, nil
+	}}
+
+	command := RemoveUserFromGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails()}), false)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "team"}`))
+
+	if event.EventDef != operationDeniedEventDef || event.Payload.(operationDeniedPayload).Rule != policy.DefaultRule {
+		t.Errorf("Event is wrong: %+v", event)
+	}
+}
+
+func TestAddUserToGroupCommand_shouldReturnDryRunCompletedWithRequestIfAskedFor(t *testing.T) {
+	searches := 0
+	searcher := &mockSearcher{groupsToReturn: func(sd *group.SearchDetails, username string) (*group.UserGroups, error) {
+		searches++
+		return someUserGroups(), nil
+	}}
+	cache := group.NewCachingSearcher(searcher, "default", group.CacheOptions{TTL: time.Minute})
+	modifier := &mockModifier{change: dryRunChange}
+	rules, _ := policy.New([]policy.Rule{{Name: "team-leads", Effect: policy.Allow, Groups: []string{"CN=team,DC=com"}}})
+	directories := directoriesWith(directory.Directory{Members: modifier, Groups: cache, SearchDetails: someSearchDetails(), Policy: rules})
+
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	event := AddUserToGroupCommand(directories, false).Handler(json.RawMessage(`{"username": "dave", "group": "team", "dryRun": true}`))
+
+	if event.EventDef != dryRunCompletedEventDef {
+		t.Fatalf("EventDef is wrong! EventDef: %v, payload: %+v", event.EventDef, event.Payload)
+	}
+	if !modifier.options.DryRun {
+		t.Error("Should've asked the modifier for a dry run")
+	}
+	expected := dryRunPayload{
+		Operation: "AddUserToGroup",
+		Username:  "dave",
+		Group:     "team",
+		Rule:      "team-leads",
+		Changed:   true,
+		Request: modifyRequestPayload{
+			DN:      "CN=team,DC=com",
+			Changes: []modificationPayload{{Operation: "add", Attribute: "member", Values: []string{"CN=dave,DC=com"}}},
+		},
+	}
+	if payload := event.Payload.(dryRunPayload); !reflect.DeepEqual(payload, expected) {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	if searches != 1 {
+		t.Errorf("Groups of dave should not have been forgotten on a dry run, searched: %d", searches)
+	}
+}
+
+func TestRemoveUserFromGroupCommand_shouldOnlyDryRunIfConfiguredTo(t *testing.T) {
+	modifier := &mockModifier{change: dryRunChange}
+
+	command := RemoveUserFromGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails(), Policy: allowAll()}), true)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "team", "dryRun": false}`))
+
+	if event.EventDef != dryRunCompletedEventDef || !modifier.options.DryRun {
+		t.Errorf("Should've been a dry run, EventDef: %v", event.EventDef)
+	}
+}
+
+func TestAddUserToGroupCommand_shouldReturnOperationDeniedOnDryRun(t *testing.T) {
+	modifier := &mockModifier{change: dryRunChange}
+
+	command := AddUserToGroupCommand(directoriesWith(directory.Directory{Members: modifier, Groups: &mockSearcher{}, SearchDetails: someSearchDetails()}), true)
+	event := command.Handler(json.RawMessage(`{"username": "dave", "group": "team"}`))
+
+	if event.EventDef != operationDeniedEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+func allowAll() *policy.Policy {
+	p, _ := policy.New([]policy.Rule{{Name: "allow-all", Effect: policy.Allow}})
+	return p
+}
+
+// mockModifier makes the change returned by change, if it is authorized, recording the options it was made with.
+type mockModifier struct {
+	change  func(add bool, username, groupName string) (*group.MembershipChange, error)
+	options group.ModifyOptions
+}
+
+func (m *mockModifier) AddMember(_ context.Context, sd *group.SearchDetails, username, groupName string, options group.ModifyOptions) (*group.MembershipChange, error) {
+	return m.modify(true, username, groupName, options)
+}
+
+func (m *mockModifier) RemoveMember(_ context.Context, sd *group.SearchDetails, username, groupName string, options group.ModifyOptions) (*group.MembershipChange, error) {
+	return m.modify(false, username, groupName, options)
+}
+
+func (m *mockModifier) modify(add bool, username, groupName string, options group.ModifyOptions) (*group.MembershipChange, error) {
+	m.options = options
+	change, err := m.change(add, username, groupName)
+	if err != nil {
+		return nil, err
+	}
+	if err := options.Authorize(change); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// dryRunChange is a change to the 'team' group with its modify request, as a dry run returns it.
+func dryRunChange(add bool, username, groupName string) (*group.MembershipChange, error) {
+	request := ldapClient.NewModifyRequest("CN=team,DC=com")
+	if add {
+		request.Add("member", []string{"CN=dave,DC=com"})
+	} else {
+		request.Delete("member", []string{"CN=dave,DC=com"})
+	}
+	return &group.MembershipChange{UserDN: "CN=dave,DC=com", Group: group.Group{Name: "team", DN: "CN=team,DC=com"}, Attribute: "member", Request: request, Changed: true}, nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/policy"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+)
+
+var operationDeniedEventDef = flyte.EventDef{Name: "OperationDenied"}
+
+// modifiableGroupsRule names the denial of a change to a group that is not one of the directory's modifiable groups.
+const modifiableGroupsRule = "modifiable-groups"
+
+type operationDeniedPayload struct {
+	Operation string            `json:"operation,omitempty"`
+	Username  string            `json:"username,omitempty"`
+	Group     string            `json:"group,omitempty"`
+	Target    string            `json:"target,omitempty"` // the DN of the entry that would have been modified
+	Rule      string            `json:"rule,omitempty"`   // the policy rule that denied it
+	Flow      map[string]string `json:"flow,omitempty"`
+	ErrorText string            `json:"error,omitempty"`
+}
+
+// operationDeniedEvent returns the OperationDenied event for a change the policy denied, or to a group that is not
+// modifiable, so flows can tell a change that is not allowed from one that failed. It returns false for other errors.
+func operationDeniedEvent(err error, payload operationDeniedPayload) (flyte.Event, bool) {
+	var denied *policy.DeniedError
+	var notModifiable *group.GroupNotModifiableError
+	switch {
+	case errors.As(err, &denied):
+		payload.Operation = denied.Operation
+		payload.Target = denied.Target
+		payload.Rule = denied.Rule
+	case errors.As(err, &notModifiable):
+		payload.Target = notModifiable.DN
+		payload.Rule = modifiableGroupsRule
+	default:
+		return flyte.Event{}, false
+	}
+	payload.ErrorText = err.Error()
+	return flyte.Event{EventDef: operationDeniedEventDef, Payload: payload}, true
+}
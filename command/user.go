@@ -0,0 +1,103 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/HotelsDotCom/flyte-client/flyte"
+)
+
+const getUserCommandName = "GetUser"
+
+var getUserSuccessEventDef = flyte.EventDef{Name: "UserRetrieved"}
+var getUserErrorEventDef = flyte.EventDef{Name: "UserRetrievalError"}
+
+type GetUserInput struct {
+	UserName   string   `json:"username"`
+	Attributes []string `json:"attributes,omitempty"` // defaults to all the configured user attributes
+	Directory  string   `json:"directory,omitempty"`  // the directory to search, the default directory if empty
+}
+
+type userPayload struct {
+	Username   string              `json:"username,omitempty"`
+	DN         string              `json:"dn,omitempty"`
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	ErrorText  string              `json:"error,omitempty"`
+}
+
+func GetUserCommand(directories *directory.Registry) flyte.Command {
+	return flyte.Command{
+		Name:    getUserCommandName,
+		Handler: instrument(getUserCommandName, getUserHandler(directories)),
+		OutputEvents: []flyte.EventDef{
+			getUserSuccessEventDef,
+			userNotFoundEventDef,
+			ambiguousUserEventDef,
+			getUserErrorEventDef,
+		},
+	}
+}
+
+func getUserHandler(directories *directory.Registry) flyte.CommandHandler {
+	return func(input json.RawMessage) flyte.Event {
+		// unmarshall input
+		args := GetUserInput{}
+		if err := json.Unmarshal(input, &args); err != nil {
+			return flyte.NewFatalEvent(userPayload{
+				ErrorText: "Json unmarshalling error: " + err.Error(),
+			})
+		}
+		if args.UserName == "" {
+			return newGetUserErrorEvent("No Username provided.", "")
+		}
+
+		d, err := directories.Get(args.Directory)
+		if err != nil {
+			return newGetUserErrorEvent(err.Error(), args.UserName)
+		}
+
+		// user search
+		u, err := d.Users.GetUser(context.Background(), d.SearchDetails, args.UserName, args.Attributes)
+		if event, ok := userLookupErrorEvent(err, args.UserName); ok {
+			return event
+		}
+		if err != nil {
+			return newGetUserErrorEvent(err.Error(), args.UserName)
+		}
+
+		return flyte.Event{
+			EventDef: getUserSuccessEventDef,
+			Payload: userPayload{
+				Username:   args.UserName,
+				DN:         u.DN,
+				Attributes: u.Attributes,
+			},
+		}
+	}
+}
+
+func newGetUserErrorEvent(errorText, username string) flyte.Event {
+	return flyte.Event{
+		EventDef: getUserErrorEventDef,
+		Payload: userPayload{
+			Username:  username,
+			ErrorText: errorText,
+		},
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/user"
+	"reflect"
+	"testing"
+)
+
+func TestGetUserCommand_shouldReturnUserAttributes(t *testing.T) {
+	var attributesPassedToSearcher []string
+	mockUserSearcher := &mockUserSearcher{
+		userToReturn: func(sd *group.SearchDetails, username string, attributes []string) (*user.User, error) {
+			attributesPassedToSearcher = attributes
+			return &user.User{DN: "CN=carlos,DC=com", Attributes: map[string][]string{"mail": {"carlos@example.com"}}}, nil
+		},
+	}
+
+	command := GetUserCommand(directoriesWith(directory.Directory{Users: mockUserSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "attributes": ["mail"]}`))
+
+	if event.EventDef != getUserSuccessEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if !reflect.DeepEqual(attributesPassedToSearcher, []string{"mail"}) {
+		t.Errorf("Attributes passed to searcher are wrong: %v", attributesPassedToSearcher)
+	}
+	expected := userPayload{Username: "carlos", DN: "CN=carlos,DC=com", Attributes: map[string][]string{"mail": {"carlos@example.com"}}}
+	if payload := event.Payload.(userPayload); !reflect.DeepEqual(payload, expected) {
+		t.Errorf("Payload is wrong! Payload: %+v", payload)
+	}
+}
+
+func TestGetUserCommand_shouldReturnUserNotFoundIfThereIsNoUser(t *testing.T) {
+	mockUserSearcher := &mockUserSearcher{
+		userToReturn: func(sd *group.SearchDetails, username string, attributes []string) (*user.User, error) {
+			return nil, &group.UserNotFoundError{Username: username}
+		},
+	}
+
+	command := GetUserCommand(directoriesWith(directory.Directory{Users: mockUserSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos"}`))
+
+	if event.EventDef != userNotFoundEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(userLookupErrorPayload); payload.Username != "carlos" {
+		t.Errorf("Username is wrong! Username: %v", payload.Username)
+	}
+}
+
+func TestGetUserCommand_shouldReturnErrorEventIfSearcherReturnsError(t *testing.T) {
+	mockUserSearcher := &mockUserSearcher{
+		userToReturn: func(sd *group.SearchDetails, username string, attributes []string) (*user.User, error) {
+			return nil, errors.New(`Attribute "userPassword" is not allowed`)
+		},
+	}
+
+	command := GetUserCommand(directoriesWith(directory.Directory{Users: mockUserSearcher, SearchDetails: someSearchDetails()}))
+	event := command.Handler(json.RawMessage(`{"username": "carlos", "attributes": ["userPassword"]}`))
+
+	if event.EventDef != getUserErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(userPayload); payload.ErrorText != `Attribute "userPassword" is not allowed` {
+		t.Errorf("Error text is wrong! Error text: %v", payload.ErrorText)
+	}
+}
+
+func TestGetUserCommand_shouldReturnErrorEventIfUsernameNotProvided(t *testing.T) {
+	command := GetUserCommand(directoriesWith(directory.Directory{Users: &mockUserSearcher{}, SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"attributes": ["mail"]}`))
+
+	if event.EventDef != getUserErrorEventDef {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+	if payload := event.Payload.(userPayload); payload.ErrorText != "No Username provided." {
+		t.Errorf("Error text is wrong! Error text: %v", payload.ErrorText)
+	}
+}
+
+func TestGetUserCommand_shouldReturnFatalErrorEventForJsonUnmarshallingError(t *testing.T) {
+	command := GetUserCommand(directoriesWith(directory.Directory{Users: &mockUserSearcher{}, SearchDetails: someSearchDetails()}))
+
+	event := command.Handler(json.RawMessage(`{"dodgy-json`))
+
+	if event.EventDef.Name != "FATAL" {
+		t.Errorf("EventDef is wrong! EventDef: %v", event.EventDef)
+	}
+}
+
+type mockUserSearcher struct {
+	userToReturn func(*group.SearchDetails, string, []string) (*user.User, error)
+}
+
+func (s *mockUserSearcher) GetUser(_ context.Context, sd *group.SearchDetails, username string, attributes []string) (*user.User, error) {
+	return s.userToReturn(sd, username, attributes)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/ExpediaGroup/flyte-ldap/policy"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultDirectoryName = "default"
+
+// Config is the pack's configuration, read from the environment and, optionally, a config file.
+type Config struct {
+	FlyteAPIURL          *url.URL
+	DefaultDirectory     string
+	Directories          []Directory
+	SecretReloadInterval time.Duration // how often secret files are re-read
+	MetricsAddress       string        // where Prometheus metrics are served, e.g. ':9090', not served if empty
+	HealthAddress        string        // where the health checks are served, not served if empty
+	ReadinessInterval    time.Duration // how often the directories are probed for readiness
+	ShutdownGracePeriod  time.Duration // how long commands in flight are waited for when shutting down
+	DryRun               bool          // commands that would change a directory only rehearse the change
+}
+
+// Directory is the configuration of one of the directories the pack serves.
+type Directory struct {
+	Name             string
+	LDAPURLs         []string
+	BindUsername     string
+	BindUsernameFile string // read instead of BindUsername when set
+	BindPassword     string
+	BindPasswordFile string // read instead of BindPassword when set
+	TLSOptions       ldap.TLSOptions
+	FailoverOptions  ldap.FailoverOptions
+	TimeoutOptions   ldap.TimeoutOptions
+	PoolOptions      ldap.PoolOptions
+	SearchDetails    group.SearchDetails
+	CacheOptions     group.CacheOptions
+	ModifiableGroups []string       // the groups whose members may be changed, by name or full DN
+	Policy           *policy.Policy // decides which changes to the directory are allowed
+}
+
+// Error lists every problem found with the configuration, rather than just the first.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "Invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load reads the configuration. Settings are named as environment variables, e.g. 'LDAP_URL', and are read from the
+// environment, then the config file at path, if there is one. Each directory's settings are read from its prefixed
+// variable, e.g. 'CORP_LDAP_URL' for 'corp', the unprefixed variable, its section of the file, then the top level
+// of the file, so settings can be shared by every directory. All the problems found are returned in an *Error.
+func Load(path string, getenv func(string) string) (*Config, error) {
+	r := &reader{getenv: getenv, file: settings{}, known: map[string]bool{"DIRECTORIES": true}}
+	if path != "" {
+		if err := r.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	top := r.scope("", "", r.file, nil)
+	c := &Config{}
+	if u, err := url.Parse(top.str("FLYTE_API_URL", "", true)); err != nil {
+		r.problem("Config value %q is not a valid url: %v", "FLYTE_API_URL", err)
+	} else {
+		c.FlyteAPIURL = u
+	}
+
+	names, sections := r.directoryNames(top)
+	for _, name := range names {
+		prefix := envPrefix(name)
+		if sections == nil {
+			prefix = "" // the single 'default' directory is configured by the unprefixed settings
+		}
+		c.Directories = append(c.Directories, r.directory(r.scope(name, prefix, sections[name], top)))
+	}
+	c.DefaultDirectory = top.str("DEFAULT_DIRECTORY", names[0], false)
+	c.SecretReloadInterval = time.Duration(top.integer("SECRET_RELOAD_INTERVAL_IN_SECONDS", 30)) * time.Second
+	c.MetricsAddress = top.str("METRICS_ADDRESS", "", false)
+	c.HealthAddress = top.str("HEALTH_ADDRESS", "", false)
+	c.ReadinessInterval = time.Duration(top.integer("READINESS_CHECK_INTERVAL_IN_SECONDS", 15)) * time.Second
+	c.ShutdownGracePeriod = time.Duration(top.integer("SHUTDOWN_GRACE_PERIOD_IN_SECONDS", 30)) * time.Second
+	c.DryRun = top.boolean("DRY_RUN", false)
+	if c.ReadinessInterval <= 0 {
+		r.problem("Config value %q must be greater than 0", "READINESS_CHECK_INTERVAL_IN_SECONDS")
+	}
+
+	r.checkUnknown(top, "")
+	if len(r.problems) > 0 {
+		return nil, &Error{Problems: r.problems}
+	}
+	return c, nil
+}
+
+type reader struct {
+	getenv   func(string) string
+	file     settings
+	known    map[string]bool // every setting read
+	problems []string
+}
+
+// settings are the settings from a level of the config file, keyed by upper-cased name.
+type settings map[string]interface{}
+
+func (r *reader) readFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Cannot read config file: %v", err)
+	}
+	raw := yaml.MapSlice{} // JSON files are valid YAML
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("Cannot parse config file %q: %v", path, err)
+	}
+	r.file = settingsOf(raw)
+	return nil
+}
+
+func settingsOf(raw yaml.MapSlice) settings {
+	s := settings{}
+	for _, item := range raw {
+		s[strings.ToUpper(fmt.Sprint(item.Key))] = item.Value
+	}
+	return s
+}
+
+// directoryNames returns the directories named by DIRECTORIES, or in the file's 'directories' section, in order,
+// with their sections of the file. There is a single directory, 'default', with no sections, if neither names any.
+func (r *reader) directoryNames(top *scope) ([]string, map[string]settings) {
+	sections := map[string]settings{}
+	var names []string
+	if v, ok := top.file["DIRECTORIES"]; ok {
+		raw, ok := v.(yaml.MapSlice)
+		if !ok {
+			r.problem("Config file section %q is not a map of directory names to their settings", "directories")
+		}
+		for _, item := range raw {
+			name := fmt.Sprint(item.Key)
+			section, ok := item.Value.(yaml.MapSlice)
+			if !ok && item.Value != nil {
+				r.problem("Config file section for directory %q is not a map", name)
+			}
+			names = append(names, name)
+			sections[name] = settingsOf(section)
+		}
+	}
+	if v := r.getenv("DIRECTORIES"); v != "" {
+		names = nil
+		for _, name := range strings.Split(v, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	if len(names) == 0 {
+		return []string{defaultDirectoryName}, nil
+	}
+	return names, sections
+}
+
+func (r *reader) directory(s *scope) Directory {
+	d := Directory{Name: s.directory, LDAPURLs: s.list("LDAP_URL", nil, true)}
+	d.BindUsername, d.BindUsernameFile = s.secret("BIND_USERNAME")
+	d.BindPassword, d.BindPasswordFile = s.secret("BIND_PASSWORD")
+	d.TLSOptions = ldap.TLSOptions{
+		StartTLS:       s.boolean("LDAP_START_TLS", false),
+		CACertFile:     s.str("LDAP_TLS_CA_CERT_FILE", "", false),
+		ClientCertFile: s.str("LDAP_TLS_CLIENT_CERT_FILE", "", false),
+		ClientKeyFile:  s.str("LDAP_TLS_CLIENT_KEY_FILE", "", false),
+		ServerName:     s.str("LDAP_TLS_SERVER_NAME", "", false),
+	}
+	d.FailoverOptions = ldap.FailoverOptions{
+		Strategy:         s.str("LDAP_SERVER_STRATEGY", ldap.StrategyFailover, false),
+		FailureThreshold: s.integer("LDAP_SERVER_FAILURE_THRESHOLD", 3),
+		RetryAfter:       time.Duration(s.integer("LDAP_SERVER_RETRY_AFTER_IN_SECONDS", 30)) * time.Second,
+		SRVCacheTTL:      time.Duration(s.integer("LDAP_SRV_CACHE_TTL_IN_SECONDS", 300)) * time.Second,
+	}
+	d.TimeoutOptions = ldap.TimeoutOptions{
+		Connect: time.Duration(s.integer("LDAP_CONNECT_TIMEOUT_IN_SECONDS", 10)) * time.Second,
+		Bind:    time.Duration(s.integer("LDAP_BIND_TIMEOUT_IN_SECONDS", 10)) * time.Second,
+		Search:  time.Duration(s.integer("LDAP_SEARCH_CLIENT_TIMEOUT_IN_SECONDS", 30)) * time.Second,
+	}
+	d.PoolOptions = ldap.PoolOptions{
+		MinIdle:                  s.integer("LDAP_POOL_MIN_IDLE", 0),
+		MaxIdle:                  s.integer("LDAP_POOL_MAX_IDLE", 5),
+		MaxActive:                s.integer("LDAP_POOL_MAX_ACTIVE", 20),
+		MaxLifetime:              time.Duration(s.integer("LDAP_POOL_MAX_LIFETIME_IN_SECONDS", 600)) * time.Second,
+		BindRevalidationInterval: time.Duration(s.integer("LDAP_POOL_BIND_REVALIDATION_IN_SECONDS", 60)) * time.Second,
+	}
+	d.SearchDetails = group.SearchDetails{
+		Attributes:        s.list("ATTRIBUTES", nil, true),
+		BaseDn:            s.str("BASE_DN", "", true),
+		SearchFilter:      s.str("SEARCH_FILTER", "", true),
+		SearchTimeout:     s.integer("SEARCH_TIMEOUT_IN_SECONDS", 20),
+		GroupAttribute:    s.str("GROUP_ATTRIBUTE", "", true),
+		MaxUsernameLength: s.integer("MAX_USERNAME_LENGTH", 256),
+		Transitive:        s.boolean("TRANSITIVE_GROUPS", false),
+		TransitiveMethod:  s.str("TRANSITIVE_METHOD", group.TransitiveClient, false),
+		MaxNestingDepth:   s.integer("MAX_NESTING_DEPTH", 10),
+		GroupBaseDn:       s.str("GROUP_BASE_DN", "", false),
+		GroupSearchFilter: s.str("GROUP_SEARCH_FILTER", "(&(objectClass=group)(cn={group}))", false),
+		MemberAttributes:  s.list("MEMBER_ATTRIBUTES", []string{"sAMAccountName", "mail", "displayName"}, false),
+		UserAttributes:    s.list("USER_ATTRIBUTES", []string{"sAMAccountName", "mail", "displayName", "manager", "department"}, false),
+		PageSize:          s.integer("SEARCH_PAGE_SIZE", 500),
+	}
+	d.CacheOptions = group.CacheOptions{
+		TTL:         time.Duration(s.integer("GROUPS_CACHE_TTL_IN_SECONDS", 0)) * time.Second,
+		NegativeTTL: time.Duration(s.integer("GROUPS_CACHE_NEGATIVE_TTL_IN_SECONDS", 60)) * time.Second,
+		MaxSize:     s.integer("GROUPS_CACHE_MAX_SIZE", 10000),
+	}
+	d.ModifiableGroups = s.separatedList("MODIFIABLE_GROUPS", ";", nil, false)
+	d.Policy = s.policy("POLICY_RULES")
+
+	if m := d.SearchDetails.TransitiveMethod; m != group.TransitiveClient && m != group.TransitiveInChain {
+		s.problem("TRANSITIVE_METHOD", "%q is not %q or %q", m, group.TransitiveClient, group.TransitiveInChain)
+	}
+	r.checkUnknown(s, fmt.Sprintf(" for directory %q", s.directory))
+	return d
+}
+
+// checkUnknown reports settings in the file that are not read, which are most likely misspelt.
+func (r *reader) checkUnknown(s *scope, where string) {
+	var unknown []string
+	for k := range s.file {
+		if !r.known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		r.problem("Unknown config value %q in config file%s", k, where)
+	}
+}
+
+func (r *reader) problem(format string, args ...interface{}) {
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+// envPrefix returns the prefix of a directory's environment variables, e.g. 'OPEN_LDAP_' for 'open-ldap'.
+func envPrefix(name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1)) + "_"
+}
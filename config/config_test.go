@@ -0,0 +1,381 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/ExpediaGroup/flyte-ldap/policy"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadShouldReadSingleDirectoryFromEnvironmentWithDefaults(t *testing.T) {
+	c, err := Load("", getenv(someSettings("")))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if c.FlyteAPIURL.String() != "http://myflyteapi.com" {
+		t.Errorf("Flyte API URL is wrong: %v", c.FlyteAPIURL)
+	}
+	if c.ShutdownGracePeriod != 30*time.Second {
+		t.Errorf("Shutdown grace period is wrong: %v", c.ShutdownGracePeriod)
+	}
+	if c.DryRun {
+		t.Error("Should not only dry run by default")
+	}
+	if c.DefaultDirectory != "default" || len(c.Directories) != 1 {
+		t.Fatalf("Directories are wrong: %s %+v", c.DefaultDirectory, c.Directories)
+	}
+	d := c.Directories[0]
+	if d.Name != "default" || !reflect.DeepEqual(d.LDAPURLs, []string{"my.ldap.com:123"}) || d.BindUsername != "someUsername" || d.BindPassword != "somePassword" {
+		t.Errorf("Directory is wrong: %+v", d)
+	}
+	if d.FailoverOptions.Strategy != "failover" || d.FailoverOptions.FailureThreshold != 3 || d.FailoverOptions.RetryAfter != 30*time.Second || d.FailoverOptions.SRVCacheTTL != 300*time.Second {
+		t.Errorf("Failover options are wrong: %+v", d.FailoverOptions)
+	}
+	if d.TimeoutOptions != (ldap.TimeoutOptions{Connect: 10 * time.Second, Bind: 10 * time.Second, Search: 30 * time.Second}) {
+		t.Errorf("Timeout options are wrong: %+v", d.TimeoutOptions)
+	}
+	if d.PoolOptions.MaxIdle != 5 || d.PoolOptions.MaxActive != 20 || d.PoolOptions.MaxLifetime != 600*time.Second {
+		t.Errorf("Pool options are wrong: %+v", d.PoolOptions)
+	}
+	expected := group.SearchDetails{
+		Attributes:        []string{"memberOf"},
+		BaseDn:            "DC=com",
+		SearchFilter:      "(mailNickname={username})",
+		SearchTimeout:     20,
+		GroupAttribute:    "cn",
+		MaxUsernameLength: 256,
+		TransitiveMethod:  group.TransitiveClient,
+		MaxNestingDepth:   10,
+		GroupSearchFilter: "(&(objectClass=group)(cn={group}))",
+		MemberAttributes:  []string{"sAMAccountName", "mail", "displayName"},
+		UserAttributes:    []string{"sAMAccountName", "mail", "displayName", "manager", "department"},
+		PageSize:          500,
+	}
+	if !reflect.DeepEqual(d.SearchDetails, expected) {
+		t.Errorf("Search details are wrong: %+v", d.SearchDetails)
+	}
+}
+
+func TestLoadShouldReadDirectoriesFromEnvironmentPreferringPrefixedValues(t *testing.T) {
+	values := someSettings("CORP_")
+	for k, v := range someSettings("OPEN_LDAP_") {
+		values[k] = v
+	}
+	values["OPEN_LDAP_BASE_DN"] = "DC=org"
+	values["OPEN_LDAP_TRANSITIVE_GROUPS"] = "true"
+	values["SEARCH_TIMEOUT_IN_SECONDS"] = "5"
+	values["CORP_LDAP_URL"] = "ldaps://dc1.corp.com, ldaps://dc2.corp.com"
+	values["CORP_MODIFIABLE_GROUPS"] = "London team; CN=Paris team,OU=Groups,DC=com"
+	values["DIRECTORIES"] = "corp, open-ldap"
+	values["DEFAULT_DIRECTORY"] = "open-ldap"
+	values["FLYTE_API_URL"] = "http://myflyteapi.com"
+
+	c, err := Load("", getenv(values))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if c.DefaultDirectory != "open-ldap" || len(c.Directories) != 2 {
+		t.Fatalf("Directories are wrong: %s %+v", c.DefaultDirectory, c.Directories)
+	}
+	corp, openLDAP := c.Directories[0].SearchDetails, c.Directories[1].SearchDetails
+	if !reflect.DeepEqual(c.Directories[0].LDAPURLs, []string{"ldaps://dc1.corp.com", "ldaps://dc2.corp.com"}) {
+		t.Errorf("Corp servers are wrong: %v", c.Directories[0].LDAPURLs)
+	}
+	if !reflect.DeepEqual(c.Directories[0].ModifiableGroups, []string{"London team", "CN=Paris team,OU=Groups,DC=com"}) || c.Directories[1].ModifiableGroups != nil {
+		t.Errorf("Modifiable groups are wrong: %v, %v", c.Directories[0].ModifiableGroups, c.Directories[1].ModifiableGroups)
+	}
+	if c.Directories[0].Name != "corp" || corp.BaseDn != "DC=com" || corp.Transitive || corp.SearchTimeout != 5 {
+		t.Errorf("Corp directory is wrong: %s %+v", c.Directories[0].Name, corp)
+	}
+	if c.Directories[1].Name != "open-ldap" || openLDAP.BaseDn != "DC=org" || !openLDAP.Transitive || openLDAP.SearchTimeout != 5 {
+		t.Errorf("Open LDAP directory is wrong: %s %+v", c.Directories[1].Name, openLDAP)
+	}
+}
+
+func TestLoadShouldReadYAMLFileWithEnvironmentOverridingIt(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+flyte_api_url: http://myflyteapi.com
+bind_username: someUsername
+search_filter: (mailNickname={username})
+group_attribute: cn
+attributes: [memberOf]
+search_timeout_in_seconds: 30
+dry_run: true
+directories:
+  partner:
+    ldap_url: partner.ldap.com:389
+    bind_password: partnerPassword
+    base_dn: DC=partner,DC=com
+    transitive_groups: true
+    member_attributes:
+      - mail
+      - uid
+  corp:
+    ldap_url: corp.ldap.com:389
+    bind_password: corpPassword
+    base_dn: DC=corp,DC=com
+    policy_rules:
+      - name: access-groups
+        effect: allow
+        operations: [AddUserToGroup]
+        subtrees: [OU=Access,DC=corp,DC=com]
+        flow:
+          name: access-request
+`)
+	values := map[string]string{
+		"CORP_BIND_PASSWORD":        "secretPassword",
+		"SEARCH_TIMEOUT_IN_SECONDS": "10",
+	}
+
+	c, err := Load(path, getenv(values))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !c.DryRun {
+		t.Error("Should only dry run")
+	}
+	if c.DefaultDirectory != "partner" || len(c.Directories) != 2 {
+		t.Fatalf("Directories are wrong: %s %+v", c.DefaultDirectory, c.Directories)
+	}
+	partner, corp := c.Directories[0], c.Directories[1]
+	if partner.Name != "partner" || !reflect.DeepEqual(partner.LDAPURLs, []string{"partner.ldap.com:389"}) || partner.BindUsername != "someUsername" || partner.BindPassword != "partnerPassword" {
+		t.Errorf("Partner directory is wrong: %+v", partner)
+	}
+	if !partner.SearchDetails.Transitive || !reflect.DeepEqual(partner.SearchDetails.MemberAttributes, []string{"mail", "uid"}) {
+		t.Errorf("Partner search details are wrong: %+v", partner.SearchDetails)
+	}
+	if corp.Name != "corp" || corp.BindPassword != "secretPassword" || corp.SearchDetails.BaseDn != "DC=corp,DC=com" {
+		t.Errorf("Corp directory is wrong: %+v", corp)
+	}
+	if corp.SearchDetails.SearchTimeout != 10 || !reflect.DeepEqual(corp.SearchDetails.Attributes, []string{"memberOf"}) {
+		t.Errorf("Corp search details are wrong: %+v", corp.SearchDetails)
+	}
+	request := policy.Request{Operation: "AddUserToGroup", Target: "CN=team,OU=Access,DC=corp,DC=com", Flow: map[string]string{"name": "access-request"}}
+	if decision := corp.Policy.Evaluate(request); !decision.Allowed || partner.Policy.Evaluate(request).Allowed {
+		t.Errorf("Only the corp policy should allow the request, decision: %+v", decision)
+	}
+}
+
+func TestLoadShouldReadPolicyRulesFromEnvironmentAsJSON(t *testing.T) {
+	values := someSettings("")
+	values["POLICY_RULES"] = `[{"name": "no-admins", "effect": "deny", "groups": ["CN=*admin*,OU=Groups,DC=com"]}, {"name": "all", "effect": "allow"}]`
+
+	c, err := Load("", getenv(values))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	decision := c.Directories[0].Policy.Evaluate(policy.Request{Operation: "AddUserToGroup", Target: "CN=admins,OU=Groups,DC=com"})
+	if decision != (policy.Decision{Rule: "no-admins"}) {
+		t.Errorf("Decision is wrong: %+v", decision)
+	}
+}
+
+func TestLoadShouldReportProblemsWithPolicyRules(t *testing.T) {
+	tests := map[string][]string{
+		`[{"name": "all", "effect": "permit"}, {"effect": "deny"}]`: {
+			`Config value "POLICY_RULES" for directory "default" is invalid: rule "all" has effect "permit" rather than "allow" or "deny"`,
+			`Config value "POLICY_RULES" for directory "default" is invalid: rule 2 has no name`,
+		},
+		`[{"name": "all", "effect": "allow", "group": "CN=team,DC=com"}]`: {
+			`Config value "POLICY_RULES" for directory "default" is not a list of rules: yaml: unmarshal errors:
+  line 1: field group not found in type config.ruleSettings`,
+		},
+	}
+
+	for rules, expected := range tests {
+		values := someSettings("")
+		values["POLICY_RULES"] = rules
+
+		_, err := Load("", getenv(values))
+
+		var configErr *Error
+		if !errors.As(err, &configErr) || !reflect.DeepEqual(configErr.Problems, expected) {
+			t.Errorf("Error for %s is wrong: %v", rules, err)
+		}
+	}
+}
+
+func TestLoadShouldReadJSONFile(t *testing.T) {
+	path := writeFile(t, "config.json", `{
+  "FLYTE_API_URL": "http://myflyteapi.com",
+  "BIND_USERNAME": "someUsername",
+  "BIND_PASSWORD": "somePassword",
+  "LDAP_URL": ["dc1.ldap.com:389", "dc2.ldap.com:389"],
+  "LDAP_SERVER_STRATEGY": "round-robin",
+  "ATTRIBUTES": ["memberOf"],
+  "BASE_DN": "DC=com",
+  "SEARCH_FILTER": "(mailNickname={username})",
+  "GROUP_ATTRIBUTE": "cn",
+  "MAX_NESTING_DEPTH": 3
+}`)
+
+	c, err := Load(path, getenv(nil))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(c.Directories) != 1 || c.Directories[0].SearchDetails.MaxNestingDepth != 3 {
+		t.Fatalf("Directories are wrong: %+v", c.Directories)
+	}
+	if !reflect.DeepEqual(c.Directories[0].LDAPURLs, []string{"dc1.ldap.com:389", "dc2.ldap.com:389"}) || c.Directories[0].FailoverOptions.Strategy != "round-robin" {
+		t.Errorf("Directory servers are wrong: %+v %+v", c.Directories[0].LDAPURLs, c.Directories[0].FailoverOptions)
+	}
+}
+
+func TestLoadShouldReportAllProblemsAtOnce(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+search_timout_in_seconds: 5
+max_nesting_depth: deep
+directories:
+  corp:
+    ldap_url: corp.ldap.com:389
+    transitive_method: magic
+`)
+	values := map[string]string{
+		"CORP_TRANSITIVE_GROUPS": "maybe",
+	}
+
+	_, err := Load(path, getenv(values))
+
+	var configErr *Error
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Expected config error, got: %v", err)
+	}
+	expected := []string{
+		`Config value "FLYTE_API_URL" must be set`,
+		`Config value "BIND_USERNAME" for directory "corp" must be set, or read from "BIND_USERNAME_FILE"`,
+		`Config value "BIND_PASSWORD" for directory "corp" must be set, or read from "BIND_PASSWORD_FILE"`,
+		`Config value "ATTRIBUTES" for directory "corp" must be set`,
+		`Config value "BASE_DN" for directory "corp" must be set`,
+		`Config value "SEARCH_FILTER" for directory "corp" must be set`,
+		`Config value "GROUP_ATTRIBUTE" for directory "corp" must be set`,
+		`Config value "CORP_TRANSITIVE_GROUPS" for directory "corp" 'maybe' not convertible to a boolean`,
+		`Config value "MAX_NESTING_DEPTH" for directory "corp" 'deep' not convertible to an integer`,
+		`Config value "TRANSITIVE_METHOD" for directory "corp" "magic" is not "client" or "in-chain"`,
+		`Unknown config value "SEARCH_TIMOUT_IN_SECONDS" in config file`,
+	}
+	if !reflect.DeepEqual(configErr.Problems, expected) {
+		t.Errorf("Problems are wrong: %q", configErr.Problems)
+	}
+}
+
+func TestLoadShouldReturnSecretFilesInsteadOfValues(t *testing.T) {
+	values := someSettings("")
+	values["BIND_PASSWORD_FILE"] = "/var/run/secrets/ldap/password"
+	values["SECRET_RELOAD_INTERVAL_IN_SECONDS"] = "10"
+
+	c, err := Load("", getenv(values))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	d := c.Directories[0]
+	if d.BindPassword != "" || d.BindPasswordFile != "/var/run/secrets/ldap/password" {
+		t.Errorf("Bind password is wrong: %q %q", d.BindPassword, d.BindPasswordFile)
+	}
+	if d.BindUsername != "someUsername" || d.BindUsernameFile != "" {
+		t.Errorf("Bind username is wrong: %q %q", d.BindUsername, d.BindUsernameFile)
+	}
+	if c.SecretReloadInterval != 10*time.Second {
+		t.Errorf("Secret reload interval is wrong: %v", c.SecretReloadInterval)
+	}
+}
+
+func TestLoadShouldPreferDirectorysBindPasswordToSharedSecretFile(t *testing.T) {
+	values := someSettings("CORP_")
+	values["DIRECTORIES"] = "corp"
+	values["CORP_BIND_PASSWORD"] = "corp-specific"
+	values["BIND_PASSWORD_FILE"] = "/shared/pw"
+
+	c, err := Load("", getenv(values))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if d := c.Directories[0]; d.BindPassword != "corp-specific" || d.BindPasswordFile != "" {
+		t.Errorf("Bind password is wrong: %q %q", d.BindPassword, d.BindPasswordFile)
+	}
+}
+
+func TestLoadShouldLetEnvironmentBindPasswordOverrideSecretFileInConfigFile(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+bind_password_file: /var/run/secrets/ldap/password
+`)
+	values := someSettings("")
+	values["BIND_PASSWORD"] = "fromEnvironment"
+
+	c, err := Load(path, getenv(values))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if d := c.Directories[0]; d.BindPassword != "fromEnvironment" || d.BindPasswordFile != "" {
+		t.Errorf("Bind password is wrong: %q %q", d.BindPassword, d.BindPasswordFile)
+	}
+}
+
+func TestLoadShouldReturnErrorIfFileCannotBeRead(t *testing.T) {
+	_, err := Load(filepath.Join(os.TempDir(), "no-such-config.yaml"), getenv(nil))
+
+	if err == nil {
+		t.Fatal("Expected error!")
+	}
+}
+
+func someSettings(prefix string) map[string]string {
+	return map[string]string{
+		"FLYTE_API_URL":            "http://myflyteapi.com",
+		prefix + "BIND_USERNAME":   "someUsername",
+		prefix + "BIND_PASSWORD":   "somePassword",
+		prefix + "LDAP_URL":        "my.ldap.com:123",
+		prefix + "ATTRIBUTES":      "memberOf",
+		prefix + "BASE_DN":         "DC=com",
+		prefix + "SEARCH_FILTER":   "(mailNickname={username})",
+		prefix + "GROUP_ATTRIBUTE": "cn",
+	}
+}
+
+func getenv(values map[string]string) func(string) string {
+	return func(k string) string {
+		return values[k]
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "flyte-ldap-config")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return path
+}
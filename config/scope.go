@@ -0,0 +1,205 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/policy"
+	"gopkg.in/yaml.v2"
+	"strconv"
+	"strings"
+)
+
+// scope reads the settings of the top level, or of a directory.
+type scope struct {
+	r         *reader
+	directory string // empty for the top level
+	prefix    string // of the directory's environment variables
+	file      settings
+	top       *scope // nil for the top level
+}
+
+func (r *reader) scope(directory, prefix string, file settings, top *scope) *scope {
+	return &scope{r: r, directory: directory, prefix: prefix, file: file, top: top}
+}
+
+// lookup returns the first value set for a setting, and where it came from, or nil if it is not set anywhere.
+func (s *scope) lookup(k string) (interface{}, string) {
+	v, name, _ := s.find(k)
+	return v, name
+}
+
+// find is lookup that also returns how specific the value's source is: 0 for the prefixed variable, then the
+// unprefixed variable, the directory's section of the file and the top level of the file, and 4 if it is not set.
+func (s *scope) find(k string) (interface{}, string, int) {
+	s.r.known[k] = true
+	if s.prefix != "" {
+		if v := s.r.getenv(s.prefix + k); v != "" {
+			return v, s.prefix + k, 0
+		}
+	}
+	if v := s.r.getenv(k); v != "" {
+		return v, k, 1
+	}
+	if v, ok := s.file[k]; ok && v != nil {
+		return v, k, 2
+	}
+	if s.top != nil {
+		if v, ok := s.top.file[k]; ok && v != nil {
+			return v, k, 3
+		}
+	}
+	return nil, k, 4
+}
+
+func (s *scope) str(k, defaultVal string, required bool) string {
+	v, _ := s.lookup(k)
+	if v == nil || fmt.Sprint(v) == "" {
+		if required {
+			s.problem(k, "must be set")
+		}
+		return defaultVal
+	}
+	return fmt.Sprint(v)
+}
+
+// secret reads a required setting that can instead be read from the file named by its '_FILE' variant, e.g.
+// 'BIND_PASSWORD_FILE', returning the file rather than the value if it is. Whichever of the two is set by the more
+// specific source is used, so 'CORP_BIND_PASSWORD' overrides a shared 'BIND_PASSWORD_FILE', and the file if both are
+// set by the same one.
+func (s *scope) secret(k string) (string, string) {
+	file, _, fileSpecificity := s.find(k + "_FILE")
+	v, _, specificity := s.find(k)
+	if file != nil && fmt.Sprint(file) != "" && fileSpecificity <= specificity {
+		return "", fmt.Sprint(file)
+	}
+	if v == nil || fmt.Sprint(v) == "" {
+		s.problem(k, "must be set, or read from %q", k+"_FILE")
+		return "", ""
+	}
+	return fmt.Sprint(v), ""
+}
+
+// list reads a comma separated list from the environment, or a list or comma separated list from the file.
+func (s *scope) list(k string, defaultVal []string, required bool) []string {
+	return s.separatedList(k, ",", defaultVal, required)
+}
+
+// separatedList is list with another separator, e.g. for lists of DNs, which contain commas.
+func (s *scope) separatedList(k, separator string, defaultVal []string, required bool) []string {
+	v, _ := s.lookup(k)
+	switch v := v.(type) {
+	case nil:
+		if required {
+			s.problem(k, "must be set")
+		}
+		return defaultVal
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = strings.TrimSpace(fmt.Sprint(value))
+		}
+		return values
+	default:
+		values := strings.Split(fmt.Sprint(v), separator)
+		for i, value := range values {
+			values[i] = strings.TrimSpace(value)
+		}
+		return values
+	}
+}
+
+// ruleSettings are the settings of a policy rule, from the file or the JSON array in the environment.
+type ruleSettings struct {
+	Name       string            `yaml:"name"`
+	Effect     policy.Effect     `yaml:"effect"`
+	Operations []string          `yaml:"operations"`
+	Groups     []string          `yaml:"groups"`
+	Subtrees   []string          `yaml:"subtrees"`
+	Attributes []string          `yaml:"attributes"`
+	Flow       map[string]string `yaml:"flow"`
+}
+
+// policy reads a list of policy rules from the file, or a JSON array of them from the environment. There are no
+// rules, so every change is denied, if it is not set.
+func (s *scope) policy(k string) *policy.Policy {
+	v, name := s.lookup(k)
+	var rules []policy.Rule
+	if v != nil {
+		data, ok := v.(string)
+		if !ok {
+			raw, _ := yaml.Marshal(v) // to decode the file's lists and maps as rules
+			data = string(raw)
+		}
+		var settings []ruleSettings
+		if err := yaml.UnmarshalStrict([]byte(data), &settings); err != nil {
+			s.problem(name, "is not a list of rules: %v", err)
+			return nil
+		}
+		for _, r := range settings {
+			rules = append(rules, policy.Rule(r))
+		}
+	}
+
+	p, err := policy.New(rules)
+	var rulesErr *policy.RulesError
+	if errors.As(err, &rulesErr) {
+		for _, problem := range rulesErr.Problems {
+			s.problem(name, "is invalid: %s", problem)
+		}
+	}
+	return p
+}
+
+func (s *scope) integer(k string, defaultVal int) int {
+	v, name := s.lookup(k)
+	if v == nil {
+		return defaultVal
+	}
+	if i, ok := v.(int); ok {
+		return i
+	}
+	i, err := strconv.Atoi(fmt.Sprint(v))
+	if err != nil {
+		s.problem(name, "'%v' not convertible to an integer", v)
+	}
+	return i
+}
+
+func (s *scope) boolean(k string, defaultVal bool) bool {
+	v, name := s.lookup(k)
+	if v == nil {
+		return defaultVal
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	b, err := strconv.ParseBool(fmt.Sprint(v))
+	if err != nil {
+		s.problem(name, "'%v' not convertible to a boolean", v)
+	}
+	return b
+}
+
+func (s *scope) problem(k, format string, args ...interface{}) {
+	where := ""
+	if s.directory != "" {
+		where = fmt.Sprintf(" for directory %q", s.directory)
+	}
+	s.r.problem("Config value %q%s %s", k, where, fmt.Sprintf(format, args...))
+}
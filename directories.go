@@ -0,0 +1,95 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/config"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/ExpediaGroup/flyte-ldap/secret"
+	"github.com/HotelsDotCom/go-logger"
+	"time"
+)
+
+// newDirectories creates a directory for each of the configured directories, reporting all the clients that cannot
+// be created, e.g. because of a missing certificate file, at once.
+func newDirectories(cfg *config.Config) *directory.Registry {
+	var directories []*directory.Directory
+	var problems []string
+	for _, d := range cfg.Directories {
+		credentials, err := newBindCredentials(d, cfg.SecretReloadInterval)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Cannot read bind credentials for directory %q: %v", d.Name, err))
+			continue
+		}
+
+		lc, err := ldap.NewPooledClient(d.Name, credentials, d.LDAPURLs, d.TLSOptions, d.FailoverOptions, d.TimeoutOptions, d.PoolOptions)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Cannot create LDAP client for directory %q: %v", d.Name, err))
+			continue
+		}
+		searchDetails := d.SearchDetails
+		dir := directory.New(d.Name, lc, &searchDetails)
+		dir.ModifiableGroups = d.ModifiableGroups
+		dir.Policy = d.Policy
+		if d.CacheOptions.TTL > 0 {
+			dir.Groups = group.NewCachingSearcher(dir.Groups, d.Name, d.CacheOptions)
+		}
+		directories = append(directories, dir)
+	}
+	if len(problems) > 0 {
+		logger.Fatal(&config.Error{Problems: problems})
+	}
+
+	registry, err := directory.NewRegistry(cfg.DefaultDirectory, directories...)
+	if err != nil {
+		logger.Fatalf("Cannot create directories. Error: %v", err)
+	}
+	return registry
+}
+
+func newBindCredentials(d config.Directory, reloadInterval time.Duration) (*bindCredentials, error) {
+	username, err := secretValue(d.BindUsername, d.BindUsernameFile, reloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	password, err := secretValue(d.BindPassword, d.BindPasswordFile, reloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &bindCredentials{username: username, password: password}, nil
+}
+
+// secretValue returns the secret read from file, and re-read every reloadInterval, or value if file is not set.
+func secretValue(value, file string, reloadInterval time.Duration) (secret.Value, error) {
+	if file == "" {
+		return secret.Static(value), nil
+	}
+	return secret.NewFile(file, reloadInterval)
+}
+
+// bindCredentials are a directory's service account credentials, either of which may be read from a secret file.
+type bindCredentials struct {
+	username secret.Value
+	password secret.Value
+}
+
+func (c *bindCredentials) Get() (string, string) {
+	return c.username.Get(), c.password.Get()
+}
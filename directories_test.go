@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/ExpediaGroup/flyte-ldap/config"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNewDirectories_shouldCreateADirectoryForEachConfiguredDirectory(t *testing.T) {
+	cfg := &config.Config{
+		DefaultDirectory: "open-ldap",
+		Directories:      []config.Directory{someDirectoryConfig("corp"), someDirectoryConfig("open-ldap")},
+	}
+	cfg.Directories[1].SearchDetails.BaseDn = "DC=org"
+
+	directories := newDirectories(cfg)
+	defer directories.Close()
+
+	if names := directories.Names(); !reflect.DeepEqual(names, []string{"corp", "open-ldap"}) {
+		t.Fatalf("Directories are wrong: %v", names)
+	}
+	corp, _ := directories.Get("corp")
+	if corp.SearchDetails.BaseDn != "DC=com" {
+		t.Errorf("Corp search details are wrong: %+v", corp.SearchDetails)
+	}
+	defaultDirectory, _ := directories.Get("")
+	if defaultDirectory.Name != "open-ldap" || defaultDirectory.SearchDetails.BaseDn != "DC=org" {
+		t.Errorf("Default directory is wrong: %s %+v", defaultDirectory.Name, defaultDirectory.SearchDetails)
+	}
+}
+
+func TestNewBindCredentials_shouldReadPasswordFromFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "flyte-ldap-password")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("filePassword\n")
+	file.Close()
+	d := someDirectoryConfig("corp")
+	d.BindPasswordFile = file.Name()
+
+	credentials, err := newBindCredentials(d, 0)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if username, password := credentials.Get(); username != "someUsername" || password != "filePassword" {
+		t.Errorf("Credentials are wrong: %q %q", username, password)
+	}
+}
+
+func someDirectoryConfig(name string) config.Directory {
+	d := config.Directory{
+		Name:         name,
+		LDAPURLs:     []string{"my.ldap.com:123"},
+		BindUsername: "someUsername",
+		BindPassword: "somePassword",
+	}
+	d.SearchDetails.BaseDn = "DC=com"
+	return d
+}
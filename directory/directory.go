@@ -0,0 +1,103 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package directory
+
+import (
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/ExpediaGroup/flyte-ldap/policy"
+	"github.com/ExpediaGroup/flyte-ldap/user"
+	"sort"
+)
+
+// Directory is one of the directories the pack serves, e.g. an Active Directory forest, with the settings used to
+// search it.
+type Directory struct {
+	Name             string
+	Client           ldap.Client
+	SearchDetails    *group.SearchDetails
+	Groups           group.Searcher
+	Members          group.Modifier // changes the members of the ModifiableGroups
+	ModifiableGroups []string       // the groups whose members may be changed, by name or full DN, none if empty
+	Policy           *policy.Policy // decides which changes are allowed, nil denies them all
+	Users            user.Searcher
+	Authenticator    user.Authenticator
+}
+
+func New(name string, client ldap.Client, searchDetails *group.SearchDetails) *Directory {
+	return &Directory{
+		Name:          name,
+		Client:        client,
+		SearchDetails: searchDetails,
+		Groups:        group.NewSearcher(client),
+		Members:       group.NewModifier(client),
+		Users:         user.NewSearcher(client),
+		Authenticator: user.NewAuthenticator(client),
+	}
+}
+
+// Registry holds the directories by name, commands choose one with their 'directory' input, or get the default.
+type Registry struct {
+	directories map[string]*Directory
+	defaultName string
+}
+
+func NewRegistry(defaultName string, directories ...*Directory) (*Registry, error) {
+	r := &Registry{directories: map[string]*Directory{}, defaultName: defaultName}
+	for _, d := range directories {
+		if _, ok := r.directories[d.Name]; ok {
+			return nil, fmt.Errorf("Directory %q is defined more than once", d.Name)
+		}
+		r.directories[d.Name] = d
+	}
+	if _, ok := r.directories[defaultName]; !ok {
+		return nil, fmt.Errorf("Default directory %q is not defined", defaultName)
+	}
+	return r, nil
+}
+
+// Get returns the named directory, or the default directory if name is empty.
+func (r *Registry) Get(name string) (*Directory, error) {
+	if name == "" {
+		name = r.defaultName
+	}
+	d, ok := r.directories[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown directory %q", name)
+	}
+	return d, nil
+}
+
+// Names returns the names of the directories, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.directories))
+	for name := range r.directories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes the clients of all the directories.
+func (r *Registry) Close() {
+	for _, d := range r.directories {
+		if d.Client != nil {
+			d.Client.Close()
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package directory
+
+import (
+	"context"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"reflect"
+	"testing"
+)
+
+func TestGetShouldReturnNamedDirectory(t *testing.T) {
+	registry, err := NewRegistry("corp", &Directory{Name: "corp"}, &Directory{Name: "partner"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	d, err := registry.Get("partner")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if d.Name != "partner" {
+		t.Errorf("Directory is wrong: %s", d.Name)
+	}
+}
+
+func TestGetShouldReturnDefaultDirectoryIfNoNameIsGiven(t *testing.T) {
+	registry, err := NewRegistry("corp", &Directory{Name: "corp"}, &Directory{Name: "partner"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	d, err := registry.Get("")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if d.Name != "corp" {
+		t.Errorf("Directory is wrong: %s", d.Name)
+	}
+}
+
+func TestGetShouldReturnErrorForUnknownDirectory(t *testing.T) {
+	registry, err := NewRegistry("corp", &Directory{Name: "corp"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	_, err = registry.Get("Corp")
+
+	if err == nil || err.Error() != `Unknown directory "Corp"` {
+		t.Errorf("Expected unknown directory error, got: %v", err)
+	}
+}
+
+func TestNewRegistryShouldRejectDuplicateNamesAndUndefinedDefault(t *testing.T) {
+	if _, err := NewRegistry("corp", &Directory{Name: "corp"}, &Directory{Name: "corp"}); err == nil || err.Error() != `Directory "corp" is defined more than once` {
+		t.Errorf("Expected duplicate directory error, got: %v", err)
+	}
+	if _, err := NewRegistry("other", &Directory{Name: "corp"}); err == nil || err.Error() != `Default directory "other" is not defined` {
+		t.Errorf("Expected undefined default directory error, got: %v", err)
+	}
+}
+
+func TestNamesShouldBeSorted(t *testing.T) {
+	registry, err := NewRegistry("corp", &Directory{Name: "partner"}, &Directory{Name: "corp"}, &Directory{Name: "openldap"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"corp", "openldap", "partner"}) {
+		t.Errorf("Names are wrong: %v", names)
+	}
+}
+
+func TestNewShouldCreateSearchersForTheClient(t *testing.T) {
+	searchDetails := &group.SearchDetails{BaseDn: "DC=com"}
+
+	d := New("corp", &mockClient{}, searchDetails)
+
+	if d.Name != "corp" || d.SearchDetails != searchDetails || d.Groups == nil || d.Users == nil || d.Authenticator == nil {
+		t.Errorf("Directory is wrong: %+v", d)
+	}
+}
+
+func TestCloseShouldCloseEveryClient(t *testing.T) {
+	corp, partner := &mockClient{}, &mockClient{}
+	registry, err := NewRegistry("corp", New("corp", corp, &group.SearchDetails{}), New("partner", partner, &group.SearchDetails{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	registry.Close()
+
+	if !corp.closed || !partner.closed {
+		t.Error("Every client should have been closed")
+	}
+}
+
+type mockClient struct {
+	closed bool
+}
+
+func (c *mockClient) Connect(context.Context) (ldap.Conn, error) {
+	return nil, nil
+}
+
+func (c *mockClient) Authenticate(_ context.Context, userDN, password string) error {
+	return nil
+}
+
+func (c *mockClient) Close() {
+	c.closed = true
+}
@@ -5,11 +5,11 @@ go 1.14
 require (
 	github.com/HotelsDotCom/flyte-client v0.0.0-20180416153839-ad4cc3a66ae5
 	github.com/HotelsDotCom/go-logger v0.0.0-20180416152005-687d54c98efb
-	github.com/davecgh/go-spew v1.1.0 // indirect
 	github.com/nmcclain/asn1-ber v0.0.0-20170104154839-2661553a0484 // indirect
 	github.com/nmcclain/ldap v0.0.0-20160601145537-6e14e8271933
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.2.1
-	gopkg.in/asn1-ber.v1 v1.0.0-20170511165959-379148ca0225 // indirect
+	github.com/prometheus/client_golang v1.7.1
+	github.com/stretchr/testify v1.4.0
+	gopkg.in/asn1-ber.v1 v1.0.0-20170511165959-379148ca0225
 	gopkg.in/ldap.v2 v2.5.1
+	gopkg.in/yaml.v2 v2.3.0
 )
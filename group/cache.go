@@ -0,0 +1,204 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOptions configure the caching of the groups found for users.
+type CacheOptions struct {
+	TTL         time.Duration // how long the groups found for a user are cached, 0 means they are not cached
+	NegativeTTL time.Duration // how long a user not being found is cached, 0 means it is not cached
+	MaxSize     int           // users cached at once, the least recently used are evicted beyond this. 0 means no limit
+}
+
+type cachingSearcher struct {
+	Searcher
+	directory string
+	options   CacheOptions
+	now       func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // of *cacheEntry, most recently used first
+	inFlight map[string]*lookup
+}
+
+type cacheEntry struct {
+	key        string
+	userGroups *UserGroups // nil if the user was not found
+	expires    time.Time
+}
+
+// lookup is a search in progress, which concurrent lookups of the same user wait for rather than searching again.
+type lookup struct {
+	done       chan struct{}
+	userGroups *UserGroups
+	err        error
+	forgotten  bool // the user was forgotten while searching, so the result may be stale and is not cached
+	abandoned  bool // the search failed as the context of the lookup that made it was done, so waiters search again
+}
+
+// NewCachingSearcher wraps searcher, caching the groups GetGroupsFor finds for each of the directory's users, and
+// whether a user was not found, so repeated lookups of a user don't each bind and search. Concurrent lookups of the
+// same user share a single search, and search again if it is given up on because the context of the lookup that made
+// it is done, rather than their own. The groups returned are marked Cached when they come from the cache, and should
+// not be modified. GetMembersOf is not cached.
+func NewCachingSearcher(searcher Searcher, directory string, options CacheOptions) Searcher {
+	return &cachingSearcher{
+		Searcher:  searcher,
+		directory: directory,
+		options:   options,
+		now:       time.Now,
+		entries:   map[string]*list.Element{},
+		lru:       list.New(),
+		inFlight:  map[string]*lookup{},
+	}
+}
+
+func (c *cachingSearcher) GetGroupsFor(ctx context.Context, sd *SearchDetails, username string) (*UserGroups, error) {
+	key := cacheKey(c.directory, sd, username)
+
+	c.mu.Lock()
+	if entry, ok := c.get(key); ok {
+		c.mu.Unlock()
+		cacheLookups.WithLabelValues(c.directory, "hit").Inc()
+		if entry.userGroups == nil {
+			return nil, &UserNotFoundError{Username: username, Cached: true}
+		}
+		cached := *entry.userGroups
+		cached.Cached = true
+		return &cached, nil
+	}
+	l, searching := c.inFlight[key]
+	if !searching {
+		l = &lookup{done: make(chan struct{})}
+		c.inFlight[key] = l
+	}
+	c.mu.Unlock()
+
+	if searching {
+		cacheLookups.WithLabelValues(c.directory, "shared").Inc()
+		select {
+		case <-l.done:
+			if l.abandoned && ctx.Err() == nil {
+				return c.GetGroupsFor(ctx, sd, username)
+			}
+			return l.userGroups, l.err
+		case <-ctx.Done():
+			return nil, &ldap.TimeoutError{Op: "search", Err: ctx.Err()}
+		}
+	}
+
+	cacheLookups.WithLabelValues(c.directory, "miss").Inc()
+	l.userGroups, l.err = c.Searcher.GetGroupsFor(ctx, sd, username)
+	l.abandoned = l.err != nil && ctx.Err() != nil
+	c.mu.Lock()
+	if !l.forgotten {
+		delete(c.inFlight, key)
+		c.put(key, l.userGroups, l.err)
+	}
+	c.mu.Unlock()
+	close(l.done)
+	return l.userGroups, l.err
+}
+
+// Forget drops what searcher has cached for the username, e.g. once the user's groups have been changed, if it is a
+// caching searcher. Lookups of the same user by another username, e.g. their email rather than their account name,
+// are not forgotten.
+func Forget(searcher Searcher, username string) {
+	if c, ok := searcher.(*cachingSearcher); ok {
+		c.forget(username)
+	}
+}
+
+func (c *cachingSearcher) forget(username string) {
+	prefix := c.directory + "\x00" + strings.ToLower(username) + "\x00"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.lru.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+	for key, l := range c.inFlight {
+		if strings.HasPrefix(key, prefix) {
+			l.forgotten = true
+			delete(c.inFlight, key)
+		}
+	}
+}
+
+// get returns the unexpired entry for key, marking it the most recently used.
+func (c *cachingSearcher) get(key string) (*cacheEntry, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+// put caches the result of a search, if it found the user's groups or that there is no such user, evicting the
+// least recently used entry if the cache is full. Other errors are not cached.
+func (c *cachingSearcher) put(key string, userGroups *UserGroups, err error) {
+	ttl := c.options.TTL
+	var notFound *UserNotFoundError
+	if errors.As(err, &notFound) {
+		ttl = c.options.NegativeTTL
+	} else if err != nil {
+		return
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	entry := &cacheEntry{key: key, userGroups: userGroups, expires: c.now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.options.MaxSize > 0 && c.lru.Len() > c.options.MaxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey identifies a lookup: usernames are matched ignoring case, as directories do, and the search details are
+// part of the key as they decide the groups found, e.g. whether inherited groups are.
+func cacheKey(directory string, sd *SearchDetails, username string) string {
+	return fmt.Sprintf("%s\x00%s\x00%+v", directory, strings.ToLower(username), *sd)
+}
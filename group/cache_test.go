@@ -0,0 +1,284 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCachingSearcherShouldReturnCachedGroups(t *testing.T) {
+	searcher := &countingSearcher{}
+	cache := NewCachingSearcher(searcher, "hits", CacheOptions{TTL: time.Minute})
+	hits := cacheLookups.WithLabelValues("hits", "hit")
+	hitsBefore := testutil.ToFloat64(hits)
+
+	first, err := cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	second, err := cache.GetGroupsFor(context.Background(), someSearchDetails(), "DAVE")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	if searcher.calls() != 1 {
+		t.Errorf("Should've searched once, searched: %d", searcher.calls())
+	}
+	if counted := testutil.ToFloat64(hits) - hitsBefore; counted != 1 {
+		t.Errorf("Should've counted a cache hit, counted: %v", counted)
+	}
+	if first.Cached || !second.Cached {
+		t.Errorf("Only the second lookup should be cached, cached: %v, %v", first.Cached, second.Cached)
+	}
+	if len(second.Direct) != 1 || second.Direct[0].Name != "dave's team" {
+		t.Errorf("Cached groups are wrong: %+v", second.Direct)
+	}
+}
+
+func TestCachingSearcherShouldSearchAgainOnceExpired(t *testing.T) {
+	searcher := &countingSearcher{}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute}).(*cachingSearcher)
+	clock := time.Now()
+	cache.now = func() time.Time { return clock }
+
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	clock = clock.Add(time.Minute)
+	userGroups, _ := cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+
+	if searcher.calls() != 2 || userGroups.Cached {
+		t.Errorf("Expired groups should have been searched for again, searched: %d", searcher.calls())
+	}
+}
+
+func TestCachingSearcherShouldCacheUserNotFoundForNegativeTTL(t *testing.T) {
+	searcher := &countingSearcher{err: &UserNotFoundError{Username: "nobody"}}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute, NegativeTTL: time.Second}).(*cachingSearcher)
+	clock := time.Now()
+	cache.now = func() time.Time { return clock }
+
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "nobody")
+	_, err := cache.GetGroupsFor(context.Background(), someSearchDetails(), "nobody")
+
+	var notFound *UserNotFoundError
+	if !errors.As(err, &notFound) || !notFound.Cached || notFound.Username != "nobody" {
+		t.Errorf("Should've returned the cached user not found, returned: %v", err)
+	}
+	clock = clock.Add(time.Second)
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "nobody")
+	if searcher.calls() != 2 {
+		t.Errorf("User not found should have been cached for the negative TTL, searched: %d", searcher.calls())
+	}
+}
+
+func TestCachingSearcherShouldNotCacheOtherErrors(t *testing.T) {
+	searcher := &countingSearcher{err: errors.New("Cannot connect to LDAP: meh")}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute, NegativeTTL: time.Minute})
+
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	_, err := cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+
+	if err == nil || searcher.calls() != 2 {
+		t.Errorf("Error should not have been cached, searched: %d", searcher.calls())
+	}
+}
+
+func TestCachingSearcherShouldEvictLeastRecentlyUsed(t *testing.T) {
+	searcher := &countingSearcher{}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute, MaxSize: 2})
+
+	for _, username := range []string{"alice", "bob", "alice", "carol", "alice", "bob"} {
+		cache.GetGroupsFor(context.Background(), someSearchDetails(), username)
+	}
+
+	if searcher.calls() != 4 {
+		t.Errorf("Bob should have been evicted by carol, and alice kept, searched: %d", searcher.calls())
+	}
+}
+
+func TestCachingSearcherShouldKeySearchDetails(t *testing.T) {
+	searcher := &countingSearcher{}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute})
+	transitive := someSearchDetails()
+	transitive.Transitive = true
+
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	cache.GetGroupsFor(context.Background(), transitive, "dave")
+
+	if searcher.calls() != 2 {
+		t.Errorf("Transitive search should not have used the direct groups, searched: %d", searcher.calls())
+	}
+}
+
+func TestCachingSearcherShouldShareConcurrentSearchesForTheSameUser(t *testing.T) {
+	searcher := &countingSearcher{release: make(chan struct{})}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(searcher.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if searcher.calls() != 1 {
+		t.Errorf("Concurrent lookups should have shared a search, searched: %d", searcher.calls())
+	}
+}
+
+func TestCachingSearcherShouldStopWaitingForSharedSearchWhenContextIsDone(t *testing.T) {
+	searcher := &countingSearcher{release: make(chan struct{})}
+	defer close(searcher.release)
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute})
+	go cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := cache.GetGroupsFor(ctx, someSearchDetails(), "dave")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestCachingSearcherShouldSearchAgainIfSharedSearchIsGivenUpOnForAnotherContext(t *testing.T) {
+	searcher := &countingSearcher{release: make(chan struct{})}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	go cache.GetGroupsFor(ctx, someSearchDetails(), "dave")
+	time.Sleep(10 * time.Millisecond)
+
+	type result struct {
+		userGroups *UserGroups
+		err        error
+	}
+	waited := make(chan result)
+	go func() {
+		userGroups, err := cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+		waited <- result{userGroups, err}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	close(searcher.release)
+	r := <-waited
+
+	if r.err != nil {
+		t.Fatalf("Unexpected error: %s", r.err.Error())
+	}
+	if len(r.userGroups.Direct) != 1 || r.userGroups.Direct[0].Name != "dave's team" {
+		t.Errorf("User groups are wrong: %+v", r.userGroups.Direct)
+	}
+	if searcher.calls() != 2 {
+		t.Errorf("Should've searched again once the first search was given up on, searched: %d", searcher.calls())
+	}
+}
+
+func TestForgetShouldDropTheUsersCachedGroups(t *testing.T) {
+	searcher := &countingSearcher{}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute})
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	cache.GetGroupsFor(context.Background(), someSearchDetails(), "bob")
+
+	Forget(cache, "Dave")
+	dave, _ := cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	bob, _ := cache.GetGroupsFor(context.Background(), someSearchDetails(), "bob")
+
+	if dave.Cached || !bob.Cached {
+		t.Errorf("Only dave should have been forgotten, cached: %v, %v", dave.Cached, bob.Cached)
+	}
+	if searcher.calls() != 3 {
+		t.Errorf("Should've searched for dave again, searched: %d", searcher.calls())
+	}
+}
+
+func TestForgetShouldNotCacheSearchInProgress(t *testing.T) {
+	searcher := &countingSearcher{release: make(chan struct{})}
+	cache := NewCachingSearcher(searcher, "corp", CacheOptions{TTL: time.Minute})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	Forget(cache, "dave")
+	close(searcher.release)
+	<-done
+	userGroups, _ := cache.GetGroupsFor(context.Background(), someSearchDetails(), "dave")
+
+	if userGroups.Cached || searcher.calls() != 2 {
+		t.Errorf("The search in progress should not have been cached, searched: %d", searcher.calls())
+	}
+}
+
+// countingSearcher finds every user in a team of their own, once release is closed if it is set.
+type countingSearcher struct {
+	release  chan struct{}
+	err      error
+	mu       sync.Mutex
+	searches int
+}
+
+func (s *countingSearcher) GetGroupsFor(ctx context.Context, sd *SearchDetails, username string) (*UserGroups, error) {
+	s.mu.Lock()
+	s.searches++
+	s.mu.Unlock()
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, &ldap.TimeoutError{Op: "search", Err: ctx.Err()}
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &UserGroups{Direct: Groups{{Name: username + "'s team", DN: "CN=" + username + "'s team,DC=com"}}, Inherited: Groups{}}, nil
+}
+
+func (s *countingSearcher) GetMembersOf(ctx context.Context, sd *SearchDetails, nameOrDN string) (Members, error) {
+	return Members{}, nil
+}
+
+func (s *countingSearcher) GetGroupDN(ctx context.Context, sd *SearchDetails, nameOrDN string) (string, error) {
+	return nameOrDN, nil
+}
+
+func (s *countingSearcher) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.searches
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapserver "github.com/nmcclain/ldap"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	bindDistinguishedName = "cn=testy,dc=testers,dc=testz"
+	bindPassword          = "work123"
+	parallelSearches      = 50
+)
+
+// These are best run with the race detector, i.e. 'go test -race ./...'
+
+func TestGetGroupsForShouldHandleParallelSearchesWithUnpooledClient(t *testing.T) {
+	server := startLdapServer(t, binder{}, userSearcher{})
+	defer server.stop()
+	client, err := ldap.NewClient(ldap.StaticCredentials(bindDistinguishedName, bindPassword), []string{server.url}, ldap.TLSOptions{}, ldap.FailoverOptions{}, ldap.TimeoutOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	getGroupsInParallel(t, NewSearcher(client))
+}
+
+func TestGetGroupsForShouldHandleParallelSearchesWithPooledClient(t *testing.T) {
+	server := startLdapServer(t, binder{}, userSearcher{})
+	defer server.stop()
+	client, err := ldap.NewPooledClient("corp", ldap.StaticCredentials(bindDistinguishedName, bindPassword), []string{server.url}, ldap.TLSOptions{}, ldap.FailoverOptions{}, ldap.TimeoutOptions{}, ldap.PoolOptions{MinIdle: 2, MaxIdle: 5, MaxActive: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer client.Close()
+
+	getGroupsInParallel(t, NewSearcher(client))
+}
+
+// getGroupsInParallel checks every search gets the groups of its own user, which it wouldn't if searches shared, or
+// closed, each other's connections.
+func getGroupsInParallel(t *testing.T, searcher Searcher) {
+	searchDetails := someSearchDetails()
+	searchDetails.BaseDn = "dc=testers,dc=testz"
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelSearches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			username := fmt.Sprintf("user-%d", i)
+
+			userGroups, err := searcher.GetGroupsFor(context.Background(), searchDetails, username)
+
+			if err != nil {
+				t.Errorf("Unexpected search error for %s: %s", username, err.Error())
+				return
+			}
+			if len(userGroups.Direct) != 1 || userGroups.Direct[0].Name != "group-of-"+username {
+				t.Errorf("User groups for %s are wrong: %v", username, userGroups.Direct)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// testLdapServer is an LDAP server listening on a port of its own, so tests that run one after another never
+// contend for the same port.
+type testLdapServer struct {
+	url  string
+	quit chan bool
+	done chan error
+	once sync.Once
+}
+
+// startLdapServer starts a server on a free local port and waits until it accepts connections.
+func startLdapServer(t *testing.T, binder ldapserver.Binder, searcher ldapserver.Searcher) *testLdapServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not find a free port: %s", err.Error())
+	}
+	url := ln.Addr().String()
+	ln.Close()
+
+	s := &testLdapServer{url: url, quit: make(chan bool), done: make(chan error, 1)}
+	go func() {
+		ls := ldapserver.NewServer()
+		ls.QuitChannel(s.quit)
+		ls.BindFunc("", binder)
+		ls.SearchFunc("", searcher)
+		s.done <- ls.ListenAndServe(url)
+	}()
+
+	for retries := 0; retries < 50; retries++ {
+		select {
+		case err := <-s.done:
+			t.Fatalf("LDAP Server Failed: %v", err)
+		default:
+		}
+		if conn, err := net.DialTimeout("tcp", url, 2*time.Second); err == nil {
+			conn.Close()
+			return s
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s.stop()
+	t.Fatalf("LDAP Server never started listening on %s", url)
+	return nil
+}
+
+// stop closes the server's listener and waits until it has, it's safe to call more than once.
+func (s *testLdapServer) stop() {
+	s.once.Do(func() {
+		close(s.quit)
+		<-s.done
+	})
+}
+
+type binder struct{}
+
+func (binder) Bind(bindDN, bindSimplePw string, conn net.Conn) (ldapserver.LDAPResultCode, error) {
+	if bindDN != bindDistinguishedName || bindSimplePw != bindPassword {
+		return ldapserver.LDAPResultInvalidCredentials, nil
+	}
+	return ldapserver.LDAPResultSuccess, nil
+}
+
+// userSearcher puts each user, found by '(mailNickname=<user>)', in a group of their own.
+type userSearcher struct{}
+
+func (userSearcher) Search(boundDN string, req ldapserver.SearchRequest, conn net.Conn) (ldapserver.ServerSearchResult, error) {
+	time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond) // so searches overlap
+
+	if !strings.HasPrefix(req.Filter, "(mailNickname=") {
+		return ldapserver.ServerSearchResult{ResultCode: ldapserver.LDAPResultSuccess}, nil
+	}
+	username := strings.TrimSuffix(strings.TrimPrefix(req.Filter, "(mailNickname="), ")")
+	entry := &ldapserver.Entry{
+		DN: "cn=" + username + ",dc=testers,dc=testz",
+		Attributes: []*ldapserver.EntryAttribute{
+			{Name: "memberOf", Values: []string{"CN=group-of-" + username + ",OU=Groups,DC=testers,DC=testz"}},
+		},
+	}
+	return ldapserver.ServerSearchResult{Entries: []*ldapserver.Entry{entry}, ResultCode: ldapserver.LDAPResultSuccess}, nil
+}
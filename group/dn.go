@@ -0,0 +1,334 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DN is a parsed distinguished name, e.g. 'CN=London team,OU=Distribution Lists,DC=com'. The most specific RDN,
+// i.e. 'CN=London team', comes first.
+type DN []RDN
+
+// RDN is a relative distinguished name, usually a single attribute but multi-valued RDNs such as 'CN=John+UID=jsmith'
+// have several.
+type RDN []AttributeTypeAndValue
+
+type AttributeTypeAndValue struct {
+	Type  string
+	Value string // the unescaped value
+}
+
+const dnSpecialChars = "\"+,;<>\\#= "
+
+// ParseDN parses the string representation of a distinguished name (RFC 4514), handling escaped characters, quoted
+// values (RFC 2253), hex encoded values, multi-valued RDNs and ';' as a legacy RDN separator.
+func ParseDN(str string) (DN, error) {
+	dn := DN{}
+	if strings.TrimSpace(str) == "" {
+		return dn, nil
+	}
+
+	rdn := RDN{}
+	for pos := 0; ; {
+		atv, next, err := parseAttributeTypeAndValue(str, pos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DN %q: %v", str, err)
+		}
+		rdn = append(rdn, atv)
+
+		if next == len(str) {
+			return append(dn, rdn), nil
+		}
+		if str[next] == ',' || str[next] == ';' {
+			dn = append(dn, rdn)
+			rdn = RDN{}
+		}
+		pos = next + 1
+	}
+}
+
+// ValueOf returns the value of the first attribute of the given type, e.g. 'cn', matching the type case-insensitively.
+func (dn DN) ValueOf(attributeType string) (string, bool) {
+	for _, rdn := range dn {
+		for _, atv := range rdn {
+			if strings.EqualFold(atv.Type, attributeType) {
+				return atv.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// String returns the RFC 4514 string representation of the DN, escaping values as needed.
+func (dn DN) String() string {
+	rdns := make([]string, len(dn))
+	for i, rdn := range dn {
+		atvs := make([]string, len(rdn))
+		for j, atv := range rdn {
+			atvs[j] = atv.Type + "=" + escapeDNValue(atv.Value)
+		}
+		rdns[i] = strings.Join(atvs, "+")
+	}
+	return strings.Join(rdns, ",")
+}
+
+// Equal compares distinguished names the way Active Directory does, i.e. ignoring the case of types and values.
+func (dn DN) Equal(other DN) bool {
+	if len(dn) != len(other) {
+		return false
+	}
+	for i := range dn {
+		if !dn[i].equal(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Within reports whether the DN is ancestor, or an entry below it, e.g. whether a group is in an OU's subtree.
+func (dn DN) Within(ancestor DN) bool {
+	if len(dn) < len(ancestor) {
+		return false
+	}
+	return dn[len(dn)-len(ancestor):].Equal(ancestor)
+}
+
+func (rdn RDN) equal(other RDN) bool {
+	if len(rdn) != len(other) {
+		return false
+	}
+	for _, atv := range rdn {
+		found := false
+		for _, o := range other {
+			if strings.EqualFold(atv.Type, o.Type) && strings.EqualFold(atv.Value, o.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns a form of the DN that is the same for all DNs that are Equal, for use as a map key.
+func (dn DN) key() string {
+	rdns := make([]string, len(dn))
+	for i, rdn := range dn {
+		atvs := make([]string, len(rdn))
+		for j, atv := range rdn {
+			atvs[j] = strings.ToLower(atv.Type + "=" + escapeDNValue(atv.Value))
+		}
+		sort.Strings(atvs)
+		rdns[i] = strings.Join(atvs, "+")
+	}
+	return strings.Join(rdns, ",")
+}
+
+func escapeDNValue(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte("\"+,;<>\\", c) >= 0,
+			i == 0 && (c == '#' || c == ' '),
+			i == len(value)-1 && c == ' ':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == 0:
+			sb.WriteString("\\00")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// parseAttributeTypeAndValue parses 'type=value' starting at pos, returning the position of the separator that ended
+// it, or len(str) if it ran to the end.
+func parseAttributeTypeAndValue(str string, pos int) (AttributeTypeAndValue, int, error) {
+	eq := strings.IndexByte(str[pos:], '=')
+	if eq < 0 {
+		return AttributeTypeAndValue{}, 0, fmt.Errorf("missing '=' after position %d", pos)
+	}
+	attributeType := strings.TrimSpace(str[pos : pos+eq])
+	if !isValidAttributeType(attributeType) {
+		return AttributeTypeAndValue{}, 0, fmt.Errorf("invalid attribute type %q", attributeType)
+	}
+
+	pos = skipSpaces(str, pos+eq+1)
+
+	var value string
+	var err error
+	switch {
+	case pos < len(str) && str[pos] == '#':
+		value, pos, err = parseHexValue(str, pos+1)
+	case pos < len(str) && str[pos] == '"':
+		value, pos, err = parseQuotedValue(str, pos+1)
+	default:
+		value, pos, err = parseStringValue(str, pos)
+	}
+	if err != nil {
+		return AttributeTypeAndValue{}, 0, err
+	}
+
+	pos = skipSpaces(str, pos)
+	if pos < len(str) && !strings.ContainsRune(",;+", rune(str[pos])) {
+		return AttributeTypeAndValue{}, 0, fmt.Errorf("unexpected %q at position %d", str[pos], pos)
+	}
+	return AttributeTypeAndValue{Type: attributeType, Value: value}, pos, nil
+}
+
+// parseStringValue parses an unquoted value, unescaping '\,' style and '\2C' style escapes and trimming unescaped
+// trailing spaces.
+func parseStringValue(str string, pos int) (string, int, error) {
+	var value []byte
+	trimTo := 0 // the length of value without unescaped trailing spaces
+	for pos < len(str) {
+		c := str[pos]
+		switch {
+		case c == ',' || c == ';' || c == '+':
+			return string(value[:trimTo]), pos, nil
+		case c == '\\':
+			b, next, err := parseEscape(str, pos+1)
+			if err != nil {
+				return "", 0, err
+			}
+			value = append(value, b)
+			trimTo = len(value)
+			pos = next
+		default:
+			value = append(value, c)
+			if c != ' ' {
+				trimTo = len(value)
+			}
+			pos++
+		}
+	}
+	return string(value[:trimTo]), pos, nil
+}
+
+func parseQuotedValue(str string, pos int) (string, int, error) {
+	var value []byte
+	for pos < len(str) {
+		c := str[pos]
+		switch c {
+		case '"':
+			return string(value), pos + 1, nil
+		case '\\':
+			b, next, err := parseEscape(str, pos+1)
+			if err != nil {
+				return "", 0, err
+			}
+			value = append(value, b)
+			pos = next
+		default:
+			value = append(value, c)
+			pos++
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted value")
+}
+
+// parseHexValue parses a '#' prefixed hex value, which holds the BER encoding of the value.
+func parseHexValue(str string, pos int) (string, int, error) {
+	end := pos
+	for end < len(str) && isHexDigit(str[end]) {
+		end++
+	}
+	raw, err := hex.DecodeString(str[pos:end])
+	if err != nil || len(raw) == 0 {
+		return "", 0, fmt.Errorf("invalid hex value %q", str[pos:end])
+	}
+	return berContents(raw), end, nil
+}
+
+// berContents returns the contents of a single BER encoded primitive, e.g. an octet or UTF-8 string, falling back to
+// the raw bytes if they are not one.
+func berContents(raw []byte) string {
+	if len(raw) < 2 || raw[0]&0x20 != 0 { // constructed types are not strings
+		return string(raw)
+	}
+	length, offset := int(raw[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(raw) < 2+n {
+			return string(raw)
+		}
+		length = 0
+		for _, b := range raw[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if offset+length != len(raw) {
+		return string(raw)
+	}
+	return string(raw[offset:])
+}
+
+// parseEscape parses what follows a '\', either a special character or a pair of hex digits.
+func parseEscape(str string, pos int) (byte, int, error) {
+	if pos >= len(str) {
+		return 0, 0, fmt.Errorf("unterminated escape at end of DN")
+	}
+	if strings.IndexByte(dnSpecialChars, str[pos]) >= 0 {
+		return str[pos], pos + 1, nil
+	}
+	if pos+1 < len(str) && isHexDigit(str[pos]) && isHexDigit(str[pos+1]) {
+		b, _ := hex.DecodeString(str[pos : pos+2])
+		return b[0], pos + 2, nil
+	}
+	return 0, 0, fmt.Errorf("invalid escape at position %d", pos-1)
+}
+
+func isValidAttributeType(attributeType string) bool {
+	if attributeType == "" {
+		return false
+	}
+	if attributeType[0] >= '0' && attributeType[0] <= '9' { // numeric oid, e.g. '2.5.4.3'
+		for i := 0; i < len(attributeType); i++ {
+			if c := attributeType[i]; c != '.' && (c < '0' || c > '9') {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 0; i < len(attributeType); i++ {
+		c := attributeType[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && (c >= '0' && c <= '9' || c == '-')) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func skipSpaces(str string, pos int) int {
+	for pos < len(str) && str[pos] == ' ' {
+		pos++
+	}
+	return pos
+}
@@ -0,0 +1,245 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDN(t *testing.T) {
+	tests := []struct {
+		name     string
+		dn       string
+		expected DN
+	}{
+		{
+			name: "simple",
+			dn:   "CN=London team,OU=Distribution Lists,DC=com",
+			expected: DN{
+				{{Type: "CN", Value: "London team"}},
+				{{Type: "OU", Value: "Distribution Lists"}},
+				{{Type: "DC", Value: "com"}},
+			},
+		},
+		{
+			name: "escaped comma",
+			dn:   `CN=Smith\, John,OU=Users,DC=example,DC=com`,
+			expected: DN{
+				{{Type: "CN", Value: "Smith, John"}},
+				{{Type: "OU", Value: "Users"}},
+				{{Type: "DC", Value: "example"}},
+				{{Type: "DC", Value: "com"}},
+			},
+		},
+		{
+			name: "quoted value",
+			dn:   `CN="Smith, John",OU=Users`,
+			expected: DN{
+				{{Type: "CN", Value: "Smith, John"}},
+				{{Type: "OU", Value: "Users"}},
+			},
+		},
+		{
+			name: "escaped quote inside quoted value",
+			dn:   `CN="Dave \"DJ\" Jones"`,
+			expected: DN{
+				{{Type: "CN", Value: `Dave "DJ" Jones`}},
+			},
+		},
+		{
+			name: "hex escaped UTF-8",
+			dn:   `CN=J\C3\BCrgen,OU=Users`,
+			expected: DN{
+				{{Type: "CN", Value: "Jürgen"}},
+				{{Type: "OU", Value: "Users"}},
+			},
+		},
+		{
+			name: "hex encoded BER value",
+			dn:   "CN=#04024869,OU=Users",
+			expected: DN{
+				{{Type: "CN", Value: "Hi"}},
+				{{Type: "OU", Value: "Users"}},
+			},
+		},
+		{
+			name: "multi-valued RDN",
+			dn:   "CN=John Smith+UID=jsmith,OU=Users",
+			expected: DN{
+				{{Type: "CN", Value: "John Smith"}, {Type: "UID", Value: "jsmith"}},
+				{{Type: "OU", Value: "Users"}},
+			},
+		},
+		{
+			name: "spaces around separators",
+			dn:   "CN = London team , OU=Distribution Lists",
+			expected: DN{
+				{{Type: "CN", Value: "London team"}},
+				{{Type: "OU", Value: "Distribution Lists"}},
+			},
+		},
+		{
+			name: "escaped leading hash and trailing space",
+			dn:   `CN=\#hash\ ,OU=Users`,
+			expected: DN{
+				{{Type: "CN", Value: "#hash "}},
+				{{Type: "OU", Value: "Users"}},
+			},
+		},
+		{
+			name: "escaped plus and equals",
+			dn:   `CN=a\+b\=c,OU=Users`,
+			expected: DN{
+				{{Type: "CN", Value: "a+b=c"}},
+				{{Type: "OU", Value: "Users"}},
+			},
+		},
+		{
+			name: "semicolon separator",
+			dn:   "CN=London team;DC=com",
+			expected: DN{
+				{{Type: "CN", Value: "London team"}},
+				{{Type: "DC", Value: "com"}},
+			},
+		},
+		{
+			name: "numeric oid type",
+			dn:   "2.5.4.3=London team",
+			expected: DN{
+				{{Type: "2.5.4.3", Value: "London team"}},
+			},
+		},
+		{
+			name:     "empty",
+			dn:       "",
+			expected: DN{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dn, err := ParseDN(test.dn)
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if !reflect.DeepEqual(dn, test.expected) {
+				t.Errorf("DN is wrong. Expected: %+v, actual: %+v", test.expected, dn)
+			}
+		})
+	}
+}
+
+func TestParseDNShouldReturnErrorForInvalidDNs(t *testing.T) {
+	tests := []struct {
+		name  string
+		dn    string
+		error string
+	}{
+		{name: "no equals", dn: "Something about Dave", error: "missing '='"},
+		{name: "no type", dn: "=London team", error: "invalid attribute type"},
+		{name: "invalid type", dn: "C N=London team", error: "invalid attribute type"},
+		{name: "trailing comma", dn: "CN=London team,", error: "missing '='"},
+		{name: "unterminated escape", dn: `CN=London team\`, error: "unterminated escape"},
+		{name: "invalid escape", dn: `CN=London\zz team`, error: "invalid escape"},
+		{name: "unterminated quote", dn: `CN="London team`, error: "unterminated quoted value"},
+		{name: "text after quote", dn: `CN="London" team`, error: "unexpected"},
+		{name: "invalid hex", dn: "CN=#0402zz", error: "unexpected"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseDN(test.dn)
+
+			if err == nil {
+				t.Fatalf("Expected error for %q", test.dn)
+			}
+			if !strings.Contains(err.Error(), test.error) {
+				t.Errorf("Error should contain %q, is: %s", test.error, err.Error())
+			}
+		})
+	}
+}
+
+func TestDNValueOfShouldMatchTypeCaseInsensitively(t *testing.T) {
+	dn, _ := ParseDN("OU=Dave DLs,DC=SWD,cN=Paris team")
+
+	value, ok := dn.ValueOf("CN")
+
+	if !ok || value != "Paris team" {
+		t.Errorf("Value should be 'Paris team', is: %q", value)
+	}
+	if _, ok := dn.ValueOf("uid"); ok {
+		t.Error("DN should not have a 'uid' value")
+	}
+}
+
+func TestDNEqualShouldIgnoreCaseAndMultiValuedRDNOrder(t *testing.T) {
+	dn, _ := ParseDN("CN=John Smith+UID=jsmith,OU=Users,DC=com")
+	other, _ := ParseDN(`uid=JSMITH+cn=john smith, ou=users, dc=COM`)
+	different, _ := ParseDN("CN=John Smith,OU=Users,DC=com")
+
+	if !dn.Equal(other) {
+		t.Errorf("%v should equal %v", dn, other)
+	}
+	if dn.Equal(different) {
+		t.Errorf("%v should not equal %v", dn, different)
+	}
+}
+
+func TestDNWithinShouldCompareTheAncestorsRDNs(t *testing.T) {
+	dn, _ := ParseDN("CN=London team,OU=Groups,DC=com")
+	tests := map[string]bool{
+		"OU=Groups,DC=com":                     true,
+		"ou=groups, dc=COM":                    true,
+		"CN=London team,OU=Groups,DC=com":      true,
+		"OU=Users,DC=com":                      false,
+		"CN=team,OU=Groups,DC=com":             false,
+		"CN=x,CN=London team,OU=Groups,DC=com": false,
+	}
+
+	for ancestor, expected := range tests {
+		ancestorDN, _ := ParseDN(ancestor)
+		if dn.Within(ancestorDN) != expected {
+			t.Errorf("%v within %v should be %v", dn, ancestor, expected)
+		}
+	}
+}
+
+func TestExtractUserGroupFrom(t *testing.T) {
+	tests := []struct {
+		attributeValue string
+		groupAttribute string
+		expected       string
+	}{
+		{attributeValue: "CN=London team,OU=Distribution Lists,DC=com", groupAttribute: "cn", expected: "London team"},
+		{attributeValue: "uid=london-team,ou=groups,dc=example,dc=com", groupAttribute: "uid", expected: "london-team"},
+		{attributeValue: "name=London team,OU=Distribution Lists,DC=com", groupAttribute: "name", expected: "London team"},
+		{attributeValue: "CN=London team,OU=Distribution Lists,DC=com", groupAttribute: "ou", expected: "Distribution Lists"},
+		{attributeValue: `CN=Smith\, John,OU=Users,DC=com`, groupAttribute: "cn", expected: "Smith, John"},
+		{attributeValue: "CN=London team,OU=Distribution Lists,DC=com", groupAttribute: "uid", expected: ""},
+		{attributeValue: "Something about Dave", groupAttribute: "cn", expected: ""},
+	}
+
+	for _, test := range tests {
+		if userGroup := extractUserGroupFrom(test.attributeValue, test.groupAttribute); userGroup != test.expected {
+			t.Errorf("Group for %q and %q should be %q, is: %q", test.attributeValue, test.groupAttribute, test.expected, userGroup)
+		}
+	}
+}
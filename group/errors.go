@@ -0,0 +1,50 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import "fmt"
+
+// UserNotFoundError is returned when the search filter finds no user for a username.
+type UserNotFoundError struct {
+	Username string
+	Cached   bool // the user was found not to exist by an earlier search, see NewCachingSearcher
+}
+
+func (e *UserNotFoundError) Error() string {
+	return fmt.Sprintf("User %q not found", e.Username)
+}
+
+// AmbiguousUserError is returned when the search filter finds more than one user for a username.
+type AmbiguousUserError struct {
+	Username string
+	DNs      []string // the DNs of the users found
+}
+
+func (e *AmbiguousUserError) Error() string {
+	return fmt.Sprintf("Username %q is ambiguous, %d users found", e.Username, len(e.DNs))
+}
+
+// GroupNotModifiableError is returned when a group's members are to be changed but it is not one of the
+// ModifiableGroups.
+type GroupNotModifiableError struct {
+	Group string
+	DN    string
+}
+
+func (e *GroupNotModifiableError) Error() string {
+	return fmt.Sprintf("Group %q cannot be modified", e.Group)
+}
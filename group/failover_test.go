@@ -0,0 +1,138 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapserver "github.com/nmcclain/ldap"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetGroupsForShouldKeepSucceedingWhenAServerDiesWithUnpooledClient(t *testing.T) {
+	servers := startFailoverServers(t)
+	defer stopFailoverServers(servers)
+	client, err := ldap.NewClient(ldap.StaticCredentials(bindDistinguishedName, bindPassword), failoverServerUrls(servers), ldap.TLSOptions{}, ldap.FailoverOptions{Strategy: ldap.StrategyRoundRobin, FailureThreshold: 2, RetryAfter: time.Minute}, ldap.TimeoutOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	getGroupsWhileAServerDies(t, NewSearcher(client), servers[0])
+}
+
+func TestGetGroupsForShouldKeepSucceedingWhenAServerDiesWithPooledClient(t *testing.T) {
+	servers := startFailoverServers(t)
+	defer stopFailoverServers(servers)
+	client, err := ldap.NewPooledClient("corp", ldap.StaticCredentials(bindDistinguishedName, bindPassword), failoverServerUrls(servers), ldap.TLSOptions{}, ldap.FailoverOptions{Strategy: ldap.StrategyRoundRobin, FailureThreshold: 2, RetryAfter: time.Minute}, ldap.TimeoutOptions{}, ldap.PoolOptions{MaxIdle: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer client.Close()
+
+	getGroupsWhileAServerDies(t, NewSearcher(client), servers[0])
+}
+
+// getGroupsWhileAServerDies gets groups one after another, killing the server half way through, and checks that
+// every search succeeds.
+func getGroupsWhileAServerDies(t *testing.T, searcher Searcher, server *failoverServer) {
+	searchDetails := someSearchDetails()
+	searchDetails.BaseDn = "dc=testers,dc=testz"
+
+	for i := 0; i < 30; i++ {
+		if i == 15 {
+			server.kill()
+		}
+		username := fmt.Sprintf("user-%d", i)
+
+		userGroups, err := searcher.GetGroupsFor(context.Background(), searchDetails, username)
+
+		if err != nil {
+			t.Fatalf("Unexpected search error for %s: %s", username, err.Error())
+		}
+		if len(userGroups.Direct) != 1 || userGroups.Direct[0].Name != "group-of-"+username {
+			t.Errorf("User groups for %s are wrong: %v", username, userGroups.Direct)
+		}
+	}
+	if server.searches() == 0 {
+		t.Error("The server should have been searched before it died")
+	}
+}
+
+// failoverServer is a test server that can be killed, it then stops listening and drops the connections it has.
+type failoverServer struct {
+	*testLdapServer
+	killed   int32
+	searched int32
+}
+
+func startFailoverServers(t *testing.T) []*failoverServer {
+	var servers []*failoverServer
+	for i := 0; i < 3; i++ {
+		s := &failoverServer{}
+		s.testLdapServer = startLdapServer(t, s, s)
+		servers = append(servers, s)
+	}
+	return servers
+}
+
+func failoverServerUrls(servers []*failoverServer) []string {
+	var urls []string
+	for _, s := range servers {
+		urls = append(urls, s.url)
+	}
+	return urls
+}
+
+func stopFailoverServers(servers []*failoverServer) {
+	for _, s := range servers {
+		s.kill()
+	}
+}
+
+func (s *failoverServer) kill() {
+	atomic.StoreInt32(&s.killed, 1)
+	s.stop()
+}
+
+func (s *failoverServer) isKilled() bool {
+	return atomic.LoadInt32(&s.killed) == 1
+}
+
+func (s *failoverServer) searches() int32 {
+	return atomic.LoadInt32(&s.searched)
+}
+
+func (s *failoverServer) Bind(bindDN, bindSimplePw string, conn net.Conn) (ldapserver.LDAPResultCode, error) {
+	if s.isKilled() {
+		conn.Close()
+		return ldapserver.LDAPResultUnavailable, nil
+	}
+	return binder{}.Bind(bindDN, bindSimplePw, conn)
+}
+
+func (s *failoverServer) Search(boundDN string, req ldapserver.SearchRequest, conn net.Conn) (ldapserver.ServerSearchResult, error) {
+	if s.isKilled() {
+		conn.Close()
+		return ldapserver.ServerSearchResult{ResultCode: ldapserver.LDAPResultUnavailable}, nil
+	}
+	atomic.AddInt32(&s.searched, 1)
+	return userSearcher{}.Search(boundDN, req, conn)
+}
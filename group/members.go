@@ -0,0 +1,285 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"strconv"
+	"strings"
+)
+
+const memberAttribute = "member"
+
+// Member is a member of a group, with the MemberAttributes read from their entry.
+type Member struct {
+	DN         string
+	Attributes map[string][]string
+	Inherited  bool // a member through a nested group, only resolved by transitive searches
+	Unexpanded bool // a nested group deeper than MaxNestingDepth, returned itself as its members weren't resolved
+}
+
+type Members []Member
+
+// GetMembersOf returns the members of a group, given either its name or its full DN. Transitive searches replace
+// nested groups with their members, following up to MaxNestingDepth levels of nesting, and nested groups any deeper
+// are returned themselves, as Unexpanded, so the members are never silently incomplete. The members' attributes are
+// read by one paged search of BaseDn for each group, only the members it doesn't find being read one by one.
+func (searcher *searcher) GetMembersOf(ctx context.Context, sd *SearchDetails, nameOrDN string) (Members, error) {
+	conn, err := searcher.client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	groupDN, err := findGroupDN(ctx, conn, sd, nameOrDN)
+	if err != nil {
+		return nil, err
+	}
+
+	seenGroups := map[string]bool{dnKey(groupDN): true}
+	seenMembers := map[string]bool{}
+	members := Members{}
+	for depth, level := 0, []string{groupDN}; len(level) > 0; depth++ {
+		nextLevel := []string{}
+		for _, dn := range level {
+			memberDNs, err := memberDNsOf(ctx, conn, sd, dn)
+			if err != nil {
+				return nil, err
+			}
+			entries, err := searchMembers(ctx, conn, sd, dn, len(memberDNs))
+			if err != nil {
+				return nil, err
+			}
+			for _, memberDN := range memberDNs {
+				entry, found := entries[dnKey(memberDN)]
+				if !found {
+					if entry, err = readEntry(ctx, conn, sd, memberDN, memberEntryAttributes(sd)); err != nil {
+						return nil, err
+					}
+				}
+				member, isGroup := newMember(memberDN, entry, sd)
+				key := dnKey(memberDN)
+				if isGroup && sd.Transitive {
+					if seenGroups[key] {
+						continue
+					}
+					seenGroups[key] = true
+					if depth < sd.MaxNestingDepth {
+						nextLevel = append(nextLevel, memberDN)
+						continue
+					}
+					member.Unexpanded = true
+				}
+				if !seenMembers[key] {
+					seenMembers[key] = true
+					member.Inherited = depth > 0
+					members = append(members, member)
+				}
+			}
+		}
+		level = nextLevel
+	}
+	return members, nil
+}
+
+// GetGroupDN returns nameOrDN if it is a DN, otherwise the DN of the one group GroupSearchFilter finds by that name
+// under the GroupBaseDn. A name that finds no group, or more than one, is an error.
+func (searcher *searcher) GetGroupDN(ctx context.Context, sd *SearchDetails, nameOrDN string) (string, error) {
+	if dn, err := ParseDN(nameOrDN); err == nil && len(dn) > 0 {
+		return nameOrDN, nil
+	}
+
+	conn, err := searcher.client.Connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return findGroupDN(ctx, conn, sd, nameOrDN)
+}
+
+// findGroupDN returns nameOrDN if it is a DN, otherwise the DN of the group GroupSearchFilter finds by that name.
+func findGroupDN(ctx context.Context, conn ldap.Conn, sd *SearchDetails, nameOrDN string) (string, error) {
+	if dn, err := ParseDN(nameOrDN); err == nil && len(dn) > 0 {
+		return nameOrDN, nil
+	}
+
+	dns, err := groupDNsNamed(ctx, conn, sd, nameOrDN)
+	if err != nil {
+		return "", err
+	}
+	switch len(dns) {
+	case 0:
+		return "", fmt.Errorf("Group %q not found", nameOrDN)
+	case 1:
+		return dns[0], nil
+	default:
+		return "", fmt.Errorf("Group %q is ambiguous, %d groups found", nameOrDN, len(dns))
+	}
+}
+
+// groupDNsNamed returns the DNs of the groups GroupSearchFilter finds, under the GroupBaseDn, by the name.
+func groupDNsNamed(ctx context.Context, conn ldap.Conn, sd *SearchDetails, name string) ([]string, error) {
+	searchResults, err := conn.Search(ctx, ldap.SearchRequest{
+		Attributes:    []string{ldap.NoAttributes},
+		BaseDn:        sd.groupBaseDn(),
+		SearchFilter:  ldap.ExpandFilter(sd.GroupSearchFilter, map[string]string{"group": name}),
+		SearchTimeout: sd.SearchTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	dns := []string{}
+	for _, entry := range searchResults.Entries {
+		dns = append(dns, entry.DN)
+	}
+	return dns, nil
+}
+
+// memberDNsOf reads the member attribute of a group. Active Directory returns at most 1500 values, by default, of a
+// large group's members, as 'member;range=0-1499', so the rest are read range by range until the last, 'member;range=
+// 1500-*' say, is returned.
+func memberDNsOf(ctx context.Context, conn ldap.Conn, sd *SearchDetails, groupDN string) ([]string, error) {
+	memberDNs := []string{}
+	for attribute := memberAttribute; attribute != ""; {
+		entry, err := readEntry(ctx, conn, sd, groupDN, []string{attribute})
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("Group %q not found", groupDN)
+		}
+
+		attribute = ""
+		for _, attr := range entry.Attributes {
+			switch name := strings.ToLower(attr.Name); {
+			case name == memberAttribute:
+				memberDNs = append(memberDNs, attr.Values...)
+			case strings.HasPrefix(name, memberAttribute+";range="):
+				memberDNs = append(memberDNs, attr.Values...)
+				next, err := nextRange(name)
+				if err != nil {
+					return nil, err
+				}
+				attribute = next
+			}
+		}
+	}
+	return memberDNs, nil
+}
+
+// nextRange returns the attribute requesting the values after a ranged attribute, e.g. 'member;range=1500-*' after
+// 'member;range=0-1499', or "" if it was the last range.
+func nextRange(rangedAttribute string) (string, error) {
+	bounds := strings.SplitN(rangedAttribute[strings.Index(rangedAttribute, "=")+1:], "-", 2)
+	if len(bounds) != 2 {
+		return "", fmt.Errorf("Invalid ranged attribute %q", rangedAttribute)
+	}
+	if bounds[1] == "*" {
+		return "", nil
+	}
+	end, err := strconv.Atoi(bounds[1])
+	if err != nil {
+		return "", fmt.Errorf("Invalid ranged attribute %q", rangedAttribute)
+	}
+	return fmt.Sprintf("%s;range=%d-*", memberAttribute, end+1), nil
+}
+
+// searchMembers finds the entries under BaseDn that are members of the group, keyed by dnKey, so their attributes
+// needn't be read one by one. Members it can't find, e.g. foreign security principals, entries outside BaseDn or
+// members of directories that don't maintain memberOf, are left to be read on their own.
+func searchMembers(ctx context.Context, conn ldap.Conn, sd *SearchDetails, groupDN string, memberCount int) (map[string]*ldapClient.Entry, error) {
+	entries := map[string]*ldapClient.Entry{}
+	if memberCount == 0 {
+		return entries, nil
+	}
+	searchRequest := ldap.SearchRequest{
+		Attributes:    memberEntryAttributes(sd),
+		BaseDn:        sd.BaseDn,
+		SearchFilter:  ldap.ExpandFilter("(memberOf={dn})", map[string]string{"dn": groupDN}),
+		SearchTimeout: sd.SearchTimeout,
+		PageSize:      sd.PageSize,
+	}
+	err := conn.SearchPaged(ctx, searchRequest, func(entry *ldapClient.Entry) error {
+		entries[dnKey(entry.DN)] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func memberEntryAttributes(sd *SearchDetails) []string {
+	return append([]string{"objectClass"}, sd.MemberAttributes...)
+}
+
+// newMember returns the member with the MemberAttributes of their entry, and whether the member is itself a group.
+// Members whose entries cannot be read, e.g. because they are outside the part of the directory the bind user can
+// see, are returned with no attributes.
+func newMember(memberDN string, entry *ldapClient.Entry, sd *SearchDetails) (Member, bool) {
+	member := Member{DN: memberDN, Attributes: map[string][]string{}}
+	if entry == nil {
+		return member, false
+	}
+
+	for _, attribute := range sd.MemberAttributes {
+		if values := entry.GetAttributeValues(attribute); len(values) > 0 {
+			member.Attributes[attribute] = values
+		}
+	}
+	return member, isGroup(entry)
+}
+
+func isGroup(entry *ldapClient.Entry) bool {
+	for _, objectClass := range entry.GetAttributeValues("objectClass") {
+		switch strings.ToLower(objectClass) {
+		case "group", "groupofnames", "groupofuniquenames":
+			return true
+		}
+	}
+	return false
+}
+
+// readEntry reads the attributes of an entry, returning nil if there is no such entry.
+func readEntry(ctx context.Context, conn ldap.Conn, sd *SearchDetails, dn string, attributes []string) (*ldapClient.Entry, error) {
+	searchResults, err := conn.Search(ctx, ldap.SearchRequest{
+		Attributes:    attributes,
+		BaseDn:        dn,
+		Scope:         ldap.ScopeBaseObject,
+		SearchFilter:  "(objectClass=*)",
+		SearchTimeout: sd.SearchTimeout,
+	})
+	if isNoSuchObject(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(searchResults.Entries) == 0 {
+		return nil, nil
+	}
+	return searchResults.Entries[0], nil
+}
+
+func isNoSuchObject(err error) bool {
+	var ldapErr *ldapClient.Error
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == ldapClient.LDAPResultNoSuchObject
+}
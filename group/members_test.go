@@ -0,0 +1,349 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetMembersOfShouldFindGroupByNameAndReturnMemberAttributes(t *testing.T) {
+	var groupSearch ldap.SearchRequest
+	directory := fakeDirectory{
+		"CN=team,OU=Groups,DC=com": {"objectClass": {"group"}, "member": {"CN=alice,OU=Users,DC=com", "CN=bob,OU=Users,DC=com"}},
+		"CN=alice,OU=Users,DC=com": {"objectClass": {"user"}, "mail": {"alice@example.com"}, "sAMAccountName": {"alice"}},
+		"CN=bob,OU=Users,DC=com":   {"objectClass": {"user"}, "mail": {"bob@example.com"}, "description": {"Bob"}},
+	}
+	searcher := NewSearcher(directory.client(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		groupSearch = sr
+		return entries("CN=team,OU=Groups,DC=com"), nil
+	}))
+
+	members, err := searcher.GetMembersOf(context.Background(), memberSearchDetails(), "team")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if groupSearch.SearchFilter != "(&(objectClass=group)(cn=team))" || groupSearch.BaseDn != "OU=Groups,DC=com" {
+		t.Errorf("Group search is wrong: %+v", groupSearch)
+	}
+	expected := Members{
+		{DN: "CN=alice,OU=Users,DC=com", Attributes: map[string][]string{"mail": {"alice@example.com"}, "sAMAccountName": {"alice"}}},
+		{DN: "CN=bob,OU=Users,DC=com", Attributes: map[string][]string{"mail": {"bob@example.com"}}},
+	}
+	if !reflect.DeepEqual(members, expected) {
+		t.Errorf("Members are wrong: %+v", members)
+	}
+}
+
+func TestGetMembersOfShouldReturnErrorIfGroupNameIsNotFoundOrAmbiguous(t *testing.T) {
+	tests := map[string]*ldapClient.SearchResult{
+		`Group "team" not found`:                    entries(),
+		`Group "team" is ambiguous, 2 groups found`: entries("CN=team,OU=A,DC=com", "CN=team,OU=B,DC=com"),
+	}
+
+	for expected, groups := range tests {
+		searcher := NewSearcher(fakeDirectory{}.client(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+			return groups, nil
+		}))
+
+		_, err := searcher.GetMembersOf(context.Background(), memberSearchDetails(), "team")
+
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got: %v", expected, err)
+		}
+	}
+}
+
+func TestGetGroupDNShouldFindGroupByNameUnderGroupBaseDN(t *testing.T) {
+	var groupSearch ldap.SearchRequest
+	searcher := NewSearcher(fakeDirectory{}.client(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		groupSearch = sr
+		return entries("CN=team,OU=Groups,DC=com"), nil
+	}))
+
+	dn, err := searcher.GetGroupDN(context.Background(), memberSearchDetails(), "team")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if dn != "CN=team,OU=Groups,DC=com" {
+		t.Errorf("DN is wrong: %q", dn)
+	}
+	if groupSearch.SearchFilter != "(&(objectClass=group)(cn=team))" || groupSearch.BaseDn != "OU=Groups,DC=com" {
+		t.Errorf("Group search is wrong: %+v", groupSearch)
+	}
+}
+
+func TestGetMembersOfShouldReadLargeGroupsRangeByRange(t *testing.T) {
+	directory := fakeDirectory{"CN=big,OU=Groups,DC=com": {"objectClass": {"group"}}}
+	var expected []string
+	for i := 0; i < 3200; i++ {
+		dn := fmt.Sprintf("CN=user%d,OU=Users,DC=com", i)
+		expected = append(expected, dn)
+		directory[dn] = map[string][]string{"objectClass": {"user"}}
+	}
+	directory["CN=big,OU=Groups,DC=com"]["member"] = expected
+
+	members, err := NewSearcher(directory.client(nil)).GetMembersOf(context.Background(), memberSearchDetails(), "CN=big,OU=Groups,DC=com")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	var dns []string
+	for _, member := range members {
+		dns = append(dns, member.DN)
+	}
+	if !reflect.DeepEqual(dns, expected) {
+		t.Errorf("Expected %d members, got %d", len(expected), len(dns))
+	}
+}
+
+func TestGetMembersOfShouldSearchForMembersRatherThanReadEachOne(t *testing.T) {
+	directory := fakeDirectory{
+		"CN=big,OU=Groups,DC=com":       {"objectClass": {"group"}},
+		"CN=partner,OU=Partners,DC=com": {"objectClass": {"user"}, "mail": {"partner@example.com"}},
+	}
+	members := []string{"CN=partner,OU=Partners,DC=com"}
+	for i := 0; i < 3200; i++ {
+		dn := fmt.Sprintf("CN=user%d,OU=Users,DC=com", i)
+		members = append(members, dn)
+		directory[dn] = map[string][]string{"objectClass": {"user"}, "mail": {fmt.Sprintf("user%d@example.com", i)}}
+	}
+	directory["CN=big,OU=Groups,DC=com"]["member"] = members
+	client := directory.client(nil)
+	var memberSearch ldap.SearchRequest
+	var reads []string
+	search := client.search
+	client.search = func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		if sr.Scope == ldap.ScopeBaseObject {
+			reads = append(reads, sr.BaseDn)
+		} else {
+			memberSearch = sr
+		}
+		return search(sr)
+	}
+
+	searchDetails := memberSearchDetails()
+	searchDetails.PageSize = 500
+
+	found, err := NewSearcher(client).GetMembersOf(context.Background(), searchDetails, "CN=big,OU=Groups,DC=com")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if memberSearch.BaseDn != "OU=Users,DC=com" || memberSearch.SearchFilter != "(memberOf=CN=big,OU=Groups,DC=com)" || memberSearch.PageSize != 500 {
+		t.Errorf("Member search is wrong: %+v", memberSearch)
+	}
+	expectedReads := []string{"CN=big,OU=Groups,DC=com", "CN=big,OU=Groups,DC=com", "CN=big,OU=Groups,DC=com", "CN=partner,OU=Partners,DC=com"}
+	if !reflect.DeepEqual(reads, expectedReads) {
+		t.Errorf("Should only have read the group's ranges and the member outside the base DN, read: %d entries", len(reads))
+	}
+	if len(found) != len(members) || found[0].Attributes["mail"][0] != "partner@example.com" || found[3200].Attributes["mail"][0] != "user3199@example.com" {
+		t.Errorf("Members are wrong: %d found", len(found))
+	}
+}
+
+func TestGetMembersOfShouldReturnNestedGroupsAsMembersUnlessTransitive(t *testing.T) {
+	members, err := NewSearcher(nestedGroupsDirectory().client(nil)).GetMembersOf(context.Background(), memberSearchDetails(), "CN=a,OU=Groups,DC=com")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if dns := memberDNs(members); !reflect.DeepEqual(dns, []string{"CN=alice,OU=Users,DC=com", "CN=b,OU=Groups,DC=com"}) {
+		t.Errorf("Members are wrong: %v", dns)
+	}
+}
+
+func TestGetMembersOfShouldExpandNestedGroupsAndStopAtCyclesWhenTransitive(t *testing.T) {
+	searchDetails := memberSearchDetails()
+	searchDetails.Transitive = true
+	searchDetails.MaxNestingDepth = 10
+
+	members, err := NewSearcher(nestedGroupsDirectory().client(nil)).GetMembersOf(context.Background(), searchDetails, "CN=a,OU=Groups,DC=com")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if dns := memberDNs(members); !reflect.DeepEqual(dns, []string{"CN=alice,OU=Users,DC=com", "CN=bob,OU=Users,DC=com", "CN=carol,OU=Users,DC=com"}) {
+		t.Errorf("Members are wrong: %v", dns)
+	}
+	if members[0].Inherited || !members[1].Inherited || !members[2].Inherited {
+		t.Errorf("Only members of nested groups should be inherited: %+v", members)
+	}
+}
+
+func TestGetMembersOfShouldReturnGroupsPastMaxNestingDepthUnexpanded(t *testing.T) {
+	searchDetails := memberSearchDetails()
+	searchDetails.Transitive = true
+	searchDetails.MaxNestingDepth = 1
+
+	members, err := NewSearcher(nestedGroupsDirectory().client(nil)).GetMembersOf(context.Background(), searchDetails, "CN=a,OU=Groups,DC=com")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if dns := memberDNs(members); !reflect.DeepEqual(dns, []string{"CN=alice,OU=Users,DC=com", "CN=bob,OU=Users,DC=com", "CN=c,OU=Groups,DC=com"}) {
+		t.Fatalf("Members are wrong: %v", dns)
+	}
+	if members[1].Unexpanded || !members[2].Unexpanded || !members[2].Inherited {
+		t.Errorf("Only the group past the max nesting depth should be unexpanded: %+v", members)
+	}
+}
+
+func TestGetMembersOfShouldReturnMembersWhoseEntriesCannotBeReadWithoutAttributes(t *testing.T) {
+	directory := fakeDirectory{"CN=team,OU=Groups,DC=com": {"objectClass": {"group"}, "member": {"CN=gone,OU=Users,DC=com"}}}
+
+	members, err := NewSearcher(directory.client(nil)).GetMembersOf(context.Background(), memberSearchDetails(), "CN=team,OU=Groups,DC=com")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(members, Members{{DN: "CN=gone,OU=Users,DC=com", Attributes: map[string][]string{}}}) {
+		t.Errorf("Members are wrong: %+v", members)
+	}
+}
+
+func TestGetMembersOfShouldReturnSearchError(t *testing.T) {
+	searcher := NewSearcher(directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		return nil, errors.New("Search went wrong!!")
+	}))
+
+	_, err := searcher.GetMembersOf(context.Background(), memberSearchDetails(), "CN=team,OU=Groups,DC=com")
+
+	if err == nil || err.Error() != "Search went wrong!!" {
+		t.Errorf("Expected search error, got: %v", err)
+	}
+}
+
+func TestNextRange(t *testing.T) {
+	tests := map[string]string{
+		"member;range=0-1499":    "member;range=1500-*",
+		"member;range=1500-2999": "member;range=3000-*",
+		"member;range=3000-*":    "",
+	}
+
+	for ranged, expected := range tests {
+		next, err := nextRange(ranged)
+		if err != nil || next != expected {
+			t.Errorf("nextRange(%q) should be %q, got: %q (%v)", ranged, expected, next, err)
+		}
+	}
+	if _, err := nextRange("member;range=0-x"); err == nil {
+		t.Error("Expected an error for an invalid range")
+	}
+}
+
+func memberSearchDetails() *SearchDetails {
+	searchDetails := someSearchDetails()
+	searchDetails.BaseDn = "OU=Users,DC=com"
+	searchDetails.GroupBaseDn = "OU=Groups,DC=com"
+	searchDetails.GroupSearchFilter = "(&(objectClass=group)(cn={group}))"
+	searchDetails.MemberAttributes = []string{"mail", "sAMAccountName"}
+	return searchDetails
+}
+
+// nestedGroupsDirectory has alice and group b in group a, bob and group c in b, and carol and a, a cycle, in c.
+func nestedGroupsDirectory() fakeDirectory {
+	return fakeDirectory{
+		"CN=a,OU=Groups,DC=com":    {"objectClass": {"top", "group"}, "member": {"CN=alice,OU=Users,DC=com", "CN=b,OU=Groups,DC=com"}},
+		"CN=b,OU=Groups,DC=com":    {"objectClass": {"top", "group"}, "member": {"CN=bob,OU=Users,DC=com", "CN=c,OU=Groups,DC=com"}},
+		"CN=c,OU=Groups,DC=com":    {"objectClass": {"top", "group"}, "member": {"CN=carol,OU=Users,DC=com", "CN=a,OU=Groups,DC=com"}},
+		"CN=alice,OU=Users,DC=com": {"objectClass": {"user"}},
+		"CN=bob,OU=Users,DC=com":   {"objectClass": {"user"}},
+		"CN=carol,OU=Users,DC=com": {"objectClass": {"user"}},
+	}
+}
+
+func memberDNs(members Members) []string {
+	dns := []string{}
+	for _, member := range members {
+		dns = append(dns, member.DN)
+	}
+	return dns
+}
+
+// fakeDirectory answers base searches from the attributes of each entry, returning the member attribute in ranges of
+// 1500 values as Active Directory does, and memberOf searches with the members of the group under the search's base,
+// and sends every other search to subtreeSearch.
+type fakeDirectory map[string]map[string][]string
+
+const fakeRangeSize = 1500
+
+func (d fakeDirectory) client(subtreeSearch func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error)) *mockClient {
+	return directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		if strings.HasPrefix(sr.SearchFilter, "(memberOf=") {
+			return d.membersOf(sr), nil
+		}
+		if sr.Scope != ldap.ScopeBaseObject {
+			return subtreeSearch(sr)
+		}
+		attributes, ok := d[sr.BaseDn]
+		if !ok {
+			return nil, fmt.Errorf("LDAP group error: %w", ldapClient.NewError(ldapClient.LDAPResultNoSuchObject, errors.New("no such object")))
+		}
+
+		entry := map[string][]string{}
+		for _, requested := range sr.Attributes {
+			name := strings.SplitN(requested, ";", 2)[0]
+			values := attributes[name]
+			if name != memberAttribute || len(values) <= fakeRangeSize && requested == memberAttribute {
+				if len(values) > 0 {
+					entry[requested] = values
+				}
+				continue
+			}
+			start := 0
+			if requested != memberAttribute {
+				fmt.Sscanf(requested, "member;range=%d-*", &start)
+			}
+			end := start + fakeRangeSize
+			if end >= len(values) {
+				entry[fmt.Sprintf("member;range=%d-*", start)] = values[start:]
+			} else {
+				entry[fmt.Sprintf("member;range=%d-%d", start, end-1)] = values[start:end]
+			}
+		}
+		return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{ldapClient.NewEntry(sr.BaseDn, entry)}}, nil
+	})
+}
+
+func (d fakeDirectory) membersOf(sr ldap.SearchRequest) *ldapClient.SearchResult {
+	groupDN := strings.TrimSuffix(strings.TrimPrefix(sr.SearchFilter, "(memberOf="), ")")
+	base, _ := ParseDN(sr.BaseDn)
+	searchResult := &ldapClient.SearchResult{}
+	for _, memberDN := range d[groupDN][memberAttribute] {
+		attributes, ok := d[memberDN]
+		if dn, _ := ParseDN(memberDN); !ok || !dn.Within(base) {
+			continue
+		}
+		entry := map[string][]string{}
+		for _, requested := range sr.Attributes {
+			if values := attributes[requested]; len(values) > 0 {
+				entry[requested] = values
+			}
+		}
+		searchResult.Entries = append(searchResult.Entries, ldapClient.NewEntry(memberDN, entry))
+	}
+	return searchResult
+}
@@ -0,0 +1,227 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"strings"
+)
+
+// MembershipChange is the outcome of adding a user to, or removing a user from, a group.
+type MembershipChange struct {
+	UserDN    string
+	Group     Group
+	Attribute string                    // the attribute of the group that is modified, 'member'
+	Request   *ldapClient.ModifyRequest // the modify request sent, or that would have been sent by a dry run
+	Changed   bool                      // false if the user already was, or already was not, a member
+}
+
+// Authorizer decides whether a change may be made once the user and group have been found, stopping it by returning
+// an error, e.g. a *policy.DeniedError.
+type Authorizer func(change *MembershipChange) error
+
+// ModifyOptions are how a change is made.
+type ModifyOptions struct {
+	ModifiableGroups []string // the groups whose members may be changed, by name or full DN, none if empty
+	Authorize        Authorizer
+	DryRun           bool // find the user and group, and authorize the change, but leave the group as it is
+}
+
+// Modifier is safe for concurrent use, every change is made on a connection of its own. Only the options'
+// ModifiableGroups can be changed, a GroupNotModifiableError is returned for any other group, and only if the
+// options' Authorize allows it.
+type Modifier interface {
+	AddMember(ctx context.Context, sd *SearchDetails, username, group string, options ModifyOptions) (*MembershipChange, error)
+	RemoveMember(ctx context.Context, sd *SearchDetails, username, group string, options ModifyOptions) (*MembershipChange, error)
+}
+
+type modifier struct {
+	client ldap.Client
+}
+
+func NewModifier(client ldap.Client) Modifier {
+	return &modifier{client: client}
+}
+
+// AddMember adds the user to the group, given either its name or its full DN. A user who is already a member is
+// not an error, the change is returned as not Changed. A dry run returns whether it would be.
+func (m *modifier) AddMember(ctx context.Context, sd *SearchDetails, username, group string, options ModifyOptions) (*MembershipChange, error) {
+	return m.modify(ctx, sd, username, group, true, options)
+}
+
+// RemoveMember removes the user from the group, given either its name or its full DN. A user who is not a member is
+// not an error, the change is returned as not Changed. A dry run returns whether it would be.
+func (m *modifier) RemoveMember(ctx context.Context, sd *SearchDetails, username, group string, options ModifyOptions) (*MembershipChange, error) {
+	return m.modify(ctx, sd, username, group, false, options)
+}
+
+func (m *modifier) modify(ctx context.Context, sd *SearchDetails, username, groupNameOrDN string, add bool, options ModifyOptions) (*MembershipChange, error) {
+	if err := ValidateUsername(username, sd.MaxUsernameLength); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	group, err := findGroup(ctx, conn, sd, groupNameOrDN)
+	if err != nil {
+		return nil, err
+	}
+	modifiable, err := isModifiable(ctx, conn, sd, group, options.ModifiableGroups)
+	if err != nil {
+		return nil, err
+	}
+	if !modifiable {
+		return nil, &GroupNotModifiableError{Group: groupNameOrDN, DN: group.DN}
+	}
+	user, err := FindUser(ctx, conn, sd, username, []string{ldap.NoAttributes})
+	if err != nil {
+		return nil, err
+	}
+
+	modifyRequest := ldapClient.NewModifyRequest(group.DN)
+	if add {
+		modifyRequest.Add(memberAttribute, []string{user.DN})
+	} else {
+		modifyRequest.Delete(memberAttribute, []string{user.DN})
+	}
+	change := &MembershipChange{UserDN: user.DN, Group: group, Attribute: memberAttribute, Request: modifyRequest, Changed: true}
+	if err := options.Authorize(change); err != nil {
+		return nil, err
+	}
+
+	if options.DryRun {
+		isMember, err := hasMember(ctx, conn, sd, group.DN, user.DN)
+		if err != nil {
+			return nil, err
+		}
+		change.Changed = isMember != add
+		return change, nil
+	}
+	err = conn.Modify(ctx, modifyRequest)
+	if err == nil {
+		return change, nil
+	}
+	if !isUnchanged(err, add) {
+		return nil, err
+	}
+
+	// the result codes are not specific enough to be sure, e.g. Active Directory is unwilling to remove a member that
+	// isn't one, so the membership is checked
+	isMember, checkErr := hasMember(ctx, conn, sd, group.DN, user.DN)
+	if checkErr != nil || isMember != add {
+		return nil, err
+	}
+	change.Changed = false
+	return change, nil
+}
+
+// findGroup returns the group nameOrDN identifies, either by its full DN or the name GroupSearchFilter finds it by,
+// named by its GroupAttribute.
+func findGroup(ctx context.Context, conn ldap.Conn, sd *SearchDetails, nameOrDN string) (Group, error) {
+	if dn, err := ParseDN(nameOrDN); err == nil && len(dn) > 0 {
+		entry, err := readEntry(ctx, conn, sd, nameOrDN, []string{sd.GroupAttribute})
+		if err != nil {
+			return Group{}, err
+		}
+		if entry == nil {
+			return Group{}, fmt.Errorf("Group %q not found", nameOrDN)
+		}
+		return Group{Name: entry.GetAttributeValue(sd.GroupAttribute), DN: entry.DN}, nil
+	}
+
+	searchResults, err := conn.Search(ctx, ldap.SearchRequest{
+		Attributes:    []string{sd.GroupAttribute},
+		BaseDn:        sd.groupBaseDn(),
+		SearchFilter:  ldap.ExpandFilter(sd.GroupSearchFilter, map[string]string{"group": nameOrDN}),
+		SearchTimeout: sd.SearchTimeout,
+	})
+	if err != nil {
+		return Group{}, err
+	}
+	switch len(searchResults.Entries) {
+	case 0:
+		return Group{}, fmt.Errorf("Group %q not found", nameOrDN)
+	case 1:
+		entry := searchResults.Entries[0]
+		return Group{Name: entry.GetAttributeValue(sd.GroupAttribute), DN: entry.DN}, nil
+	default:
+		return Group{}, fmt.Errorf("Group %q is ambiguous, %d groups found", nameOrDN, len(searchResults.Entries))
+	}
+}
+
+// isModifiable reports whether the group is one of the modifiable groups, each either a name or a full DN. A DN
+// matches only the group with that DN, and a name only the one group GroupSearchFilter finds by it under the
+// GroupBaseDn, not any other group in the directory that happens to have the same name.
+func isModifiable(ctx context.Context, conn ldap.Conn, sd *SearchDetails, group Group, modifiableGroups []string) (bool, error) {
+	for _, nameOrDN := range modifiableGroups {
+		if dn, err := ParseDN(nameOrDN); err == nil && len(dn) > 0 {
+			if dnKey(group.DN) == dn.key() {
+				return true, nil
+			}
+			continue
+		}
+		if !strings.EqualFold(group.Name, nameOrDN) {
+			continue
+		}
+
+		dns, err := groupDNsNamed(ctx, conn, sd, nameOrDN)
+		if err != nil {
+			return false, err
+		}
+		if len(dns) == 1 && dnKey(dns[0]) == dnKey(group.DN) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isUnchanged reports whether a modify failed because the member was already added, or already removed.
+func isUnchanged(err error, add bool) bool {
+	var ldapErr *ldapClient.Error
+	if !errors.As(err, &ldapErr) {
+		return false
+	}
+	if add {
+		return ldapErr.ResultCode == ldapClient.LDAPResultAttributeOrValueExists ||
+			ldapErr.ResultCode == ldapClient.LDAPResultEntryAlreadyExists
+	}
+	return ldapErr.ResultCode == ldapClient.LDAPResultNoSuchAttribute ||
+		ldapErr.ResultCode == ldapClient.LDAPResultUnwillingToPerform
+}
+
+// hasMember reports whether the group's member attribute holds memberDN.
+func hasMember(ctx context.Context, conn ldap.Conn, sd *SearchDetails, groupDN, memberDN string) (bool, error) {
+	searchResults, err := conn.Search(ctx, ldap.SearchRequest{
+		Attributes:    []string{ldap.NoAttributes},
+		BaseDn:        groupDN,
+		Scope:         ldap.ScopeBaseObject,
+		SearchFilter:  fmt.Sprintf("(%s=%s)", memberAttribute, ldap.EscapeFilterValue(memberDN)),
+		SearchTimeout: sd.SearchTimeout,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(searchResults.Entries) > 0, nil
+}
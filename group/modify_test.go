@@ -0,0 +1,307 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	teamDN           = "CN=team,OU=Groups,DC=com"
+	privilegedTeamDN = "CN=team,OU=Privileged,DC=com"
+	daveDN           = "CN=dave,OU=Users,DC=com"
+)
+
+func TestAddMemberShouldAddUserDNToGroupMembers(t *testing.T) {
+	directory := &membershipDirectory{}
+	modifier := NewModifier(directory.client())
+
+	change, err := modifier.AddMember(context.Background(), memberSearchDetails(), "dave", "team", modifyOptions())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(directory.modified) != 1 || directory.modified[0].DN != teamDN ||
+		!reflect.DeepEqual(directory.modified[0].AddAttributes, []ldapClient.PartialAttribute{{Type: "member", Vals: []string{daveDN}}}) {
+		t.Fatalf("Modify request is wrong: %+v", directory.modified)
+	}
+	expected := &MembershipChange{UserDN: daveDN, Group: Group{Name: "team", DN: teamDN}, Attribute: "member", Request: directory.modified[0], Changed: true}
+	if !reflect.DeepEqual(change, expected) {
+		t.Errorf("Change is wrong: %+v", change)
+	}
+	if !directory.isMember {
+		t.Error("Dave should have been added to the team")
+	}
+}
+
+func TestRemoveMemberShouldDeleteUserDNFromGroupMembersGivenGroupDN(t *testing.T) {
+	directory := &membershipDirectory{isMember: true}
+	modifier := NewModifier(directory.client())
+
+	change, err := modifier.RemoveMember(context.Background(), memberSearchDetails(), "dave", teamDN, modifyOptions())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !change.Changed || change.Group.Name != "team" {
+		t.Errorf("Change is wrong: %+v", change)
+	}
+	if len(directory.modified) != 1 ||
+		!reflect.DeepEqual(directory.modified[0].DeleteAttributes, []ldapClient.PartialAttribute{{Type: "member", Vals: []string{daveDN}}}) {
+		t.Errorf("Modify request is wrong: %+v", directory.modified)
+	}
+	if directory.isMember {
+		t.Error("Dave should have been removed from the team")
+	}
+}
+
+func TestModifierShouldTreatUnchangedMembershipAsSuccess(t *testing.T) {
+	tests := map[string]struct {
+		add        bool
+		isMember   bool
+		resultCode uint8
+	}{
+		"already a member (OpenLDAP)":         {add: true, isMember: true, resultCode: ldapClient.LDAPResultAttributeOrValueExists},
+		"already a member (Active Directory)": {add: true, isMember: true, resultCode: ldapClient.LDAPResultEntryAlreadyExists},
+		"not a member (OpenLDAP)":             {isMember: false, resultCode: ldapClient.LDAPResultNoSuchAttribute},
+		"not a member (Active Directory)":     {isMember: false, resultCode: ldapClient.LDAPResultUnwillingToPerform},
+	}
+
+	for name, test := range tests {
+		directory := &membershipDirectory{isMember: test.isMember, modifyResultCode: test.resultCode}
+		modifier := NewModifier(directory.client())
+
+		var change *MembershipChange
+		var err error
+		if test.add {
+			change, err = modifier.AddMember(context.Background(), memberSearchDetails(), "dave", "team", modifyOptions())
+		} else {
+			change, err = modifier.RemoveMember(context.Background(), memberSearchDetails(), "dave", "team", modifyOptions())
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err.Error())
+			continue
+		}
+		if change.Changed {
+			t.Errorf("%s: membership should be unchanged", name)
+		}
+	}
+}
+
+func TestModifierShouldReturnModifyErrorIfMembershipIsNotAsWanted(t *testing.T) {
+	// unwilling to perform, but for some other reason than dave not being a member
+	directory := &membershipDirectory{isMember: true, modifyResultCode: ldapClient.LDAPResultUnwillingToPerform}
+	modifier := NewModifier(directory.client())
+
+	_, err := modifier.RemoveMember(context.Background(), memberSearchDetails(), "dave", "team", modifyOptions())
+
+	var ldapErr *ldapClient.Error
+	if !errors.As(err, &ldapErr) || ldapErr.ResultCode != ldapClient.LDAPResultUnwillingToPerform {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestModifierShouldNotModifyGroupsThatAreNotModifiable(t *testing.T) {
+	for _, modifiableGroups := range [][]string{nil, {"other team"}, {"CN=team,OU=Other,DC=com"}} {
+		directory := &membershipDirectory{}
+		modifier := NewModifier(directory.client())
+		options := modifyOptions()
+		options.ModifiableGroups = modifiableGroups
+
+		_, err := modifier.AddMember(context.Background(), memberSearchDetails(), "dave", "team", options)
+
+		var notModifiable *GroupNotModifiableError
+		if !errors.As(err, &notModifiable) || notModifiable.DN != teamDN || err.Error() != `Group "team" cannot be modified` {
+			t.Errorf("Error returned for %v is wrong: %v", modifiableGroups, err)
+		}
+		if len(directory.modified) != 0 {
+			t.Errorf("Group should not have been modified for %v", modifiableGroups)
+		}
+	}
+}
+
+func TestModifierShouldMatchModifiableGroupsByNameOrDN(t *testing.T) {
+	for _, modifiableGroups := range [][]string{{"TEAM"}, {"cn=team,ou=groups,dc=com"}} {
+		directory := &membershipDirectory{}
+		modifier := NewModifier(directory.client())
+		options := modifyOptions()
+		options.ModifiableGroups = modifiableGroups
+
+		if _, err := modifier.AddMember(context.Background(), memberSearchDetails(), "dave", teamDN, options); err != nil {
+			t.Errorf("Unexpected error for %v: %s", modifiableGroups, err.Error())
+		}
+	}
+}
+
+func TestModifierShouldNotMatchModifiableGroupNameToAnotherGroupOfThatName(t *testing.T) {
+	for _, modifiableGroups := range [][]string{{"team"}, {teamDN}} {
+		directory := &membershipDirectory{}
+		modifier := NewModifier(directory.client())
+		options := modifyOptions()
+		options.ModifiableGroups = modifiableGroups
+
+		_, err := modifier.AddMember(context.Background(), memberSearchDetails(), "dave", privilegedTeamDN, options)
+
+		var notModifiable *GroupNotModifiableError
+		if !errors.As(err, &notModifiable) || notModifiable.DN != privilegedTeamDN {
+			t.Errorf("Error returned for %v is wrong: %v", modifiableGroups, err)
+		}
+		if len(directory.modified) != 0 {
+			t.Errorf("Group should not have been modified for %v", modifiableGroups)
+		}
+	}
+}
+
+func TestModifierShouldNotModifyGroupIfChangeIsNotAuthorized(t *testing.T) {
+	directory := &membershipDirectory{}
+	modifier := NewModifier(directory.client())
+	var authorized *MembershipChange
+	denied := errors.New("denied")
+
+	options := modifyOptions()
+	options.Authorize = func(change *MembershipChange) error {
+		authorized = change
+		return denied
+	}
+
+	_, err := modifier.AddMember(context.Background(), memberSearchDetails(), "dave", "team", options)
+
+	if err != denied {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+	if authorized == nil || authorized.UserDN != daveDN || authorized.Group.DN != teamDN || authorized.Attribute != "member" {
+		t.Errorf("Change authorized is wrong: %+v", authorized)
+	}
+	if len(directory.modified) != 0 {
+		t.Error("Group should not have been modified")
+	}
+}
+
+func TestModifierShouldReturnRequestWithoutModifyingGroupOnDryRun(t *testing.T) {
+	tests := []struct {
+		add      bool
+		isMember bool
+		changed  bool
+	}{
+		{add: true, isMember: false, changed: true},
+		{add: true, isMember: true, changed: false},
+		{add: false, isMember: true, changed: true},
+		{add: false, isMember: false, changed: false},
+	}
+
+	for _, test := range tests {
+		directory := &membershipDirectory{isMember: test.isMember}
+		modifier := NewModifier(directory.client())
+		options := modifyOptions()
+		options.DryRun = true
+
+		var change *MembershipChange
+		var err error
+		if test.add {
+			change, err = modifier.AddMember(context.Background(), memberSearchDetails(), "dave", "team", options)
+		} else {
+			change, err = modifier.RemoveMember(context.Background(), memberSearchDetails(), "dave", "team", options)
+		}
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if len(directory.modified) != 0 {
+			t.Errorf("Group should not have been modified by a dry run: %+v", test)
+		}
+		if change.Changed != test.changed {
+			t.Errorf("Change is wrong for %+v: %+v", test, change)
+		}
+		changes := append(change.Request.AddAttributes, change.Request.DeleteAttributes...)
+		if change.Request.DN != teamDN || len(change.Request.AddAttributes) > 0 != test.add ||
+			!reflect.DeepEqual(changes, []ldapClient.PartialAttribute{{Type: "member", Vals: []string{daveDN}}}) {
+			t.Errorf("Request is wrong for %+v: %+v", test, change.Request)
+		}
+	}
+}
+
+func TestModifierShouldReturnUserNotFoundWithoutModifying(t *testing.T) {
+	directory := &membershipDirectory{}
+	modifier := NewModifier(directory.client())
+
+	_, err := modifier.AddMember(context.Background(), memberSearchDetails(), "nobody", "team", modifyOptions())
+
+	var notFound *UserNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+	if len(directory.modified) != 0 {
+		t.Error("Group should not have been modified")
+	}
+}
+
+func allowAll(*MembershipChange) error {
+	return nil
+}
+
+func modifyOptions() ModifyOptions {
+	return ModifyOptions{ModifiableGroups: []string{"team"}, Authorize: allowAll}
+}
+
+// membershipDirectory has a user, dave, and a group, team, which dave is a member of if isMember. Modifying the
+// team's members fails with modifyResultCode, if set. Another group named team, outside the group base DN, is only
+// found by its DN.
+type membershipDirectory struct {
+	isMember         bool
+	modifyResultCode uint8
+	modified         []*ldapClient.ModifyRequest
+}
+
+func (d *membershipDirectory) client() *mockClient {
+	client := directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		switch {
+		case sr.SearchFilter == "(mailNickname=dave)":
+			return entries(daveDN), nil
+		case strings.EqualFold(sr.SearchFilter, "(&(objectClass=group)(cn=team))"):
+			return teamEntry(), nil
+		case sr.BaseDn == privilegedTeamDN && sr.SearchFilter == "(objectClass=*)":
+			return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{ldapClient.NewEntry(privilegedTeamDN, map[string][]string{"cn": {"team"}})}}, nil
+		case sr.BaseDn == teamDN && sr.SearchFilter == "(objectClass=*)":
+			return teamEntry(), nil
+		case sr.BaseDn == teamDN && sr.SearchFilter == "(member="+daveDN+")":
+			if d.isMember {
+				return entries(teamDN), nil
+			}
+		}
+		return entries(), nil
+	})
+	client.modify = func(mr *ldapClient.ModifyRequest) error {
+		d.modified = append(d.modified, mr)
+		if d.modifyResultCode != 0 {
+			return ldapClient.NewError(d.modifyResultCode, errors.New("modify failed"))
+		}
+		d.isMember = len(mr.AddAttributes) > 0
+		return nil
+	}
+	return client
+}
+
+func teamEntry() *ldapClient.SearchResult {
+	return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{ldapClient.NewEntry(teamDN, map[string][]string{"cn": {"team"}})}}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"strings"
+)
+
+const (
+	// TransitiveClient follows the groups' own memberOf attributes level by level, which works with any directory
+	// that maintains memberOf on groups, stopping at MaxNestingDepth.
+	TransitiveClient = "client"
+	// TransitiveInChain asks Active Directory for every group the user is in, however deeply nested, in one search
+	// using the LDAP_MATCHING_RULE_IN_CHAIN matching rule.
+	TransitiveInChain = "in-chain"
+
+	matchingRuleInChain = "1.2.840.113556.1.4.1941"
+)
+
+// inheritedGroupsFor returns the groups the user is a member of through nested groups, excluding the direct ones.
+func inheritedGroupsFor(ctx context.Context, conn ldap.Conn, sd *SearchDetails, userDN string, direct Groups) (Groups, error) {
+	switch sd.TransitiveMethod {
+	case TransitiveClient, "":
+		return nestedGroupsOf(ctx, conn, sd, direct)
+	case TransitiveInChain:
+		return inChainGroupsFor(ctx, conn, sd, userDN, direct)
+	default:
+		return nil, fmt.Errorf("Unknown transitive method %q", sd.TransitiveMethod)
+	}
+}
+
+func inChainGroupsFor(ctx context.Context, conn ldap.Conn, sd *SearchDetails, userDN string, direct Groups) (Groups, error) {
+	searchRequest := ldap.SearchRequest{
+		Attributes:    []string{ldap.NoAttributes},
+		BaseDn:        sd.groupBaseDn(),
+		SearchFilter:  ldap.ExpandFilter("(member:"+matchingRuleInChain+":={dn})", map[string]string{"dn": userDN}),
+		SearchTimeout: sd.SearchTimeout,
+		PageSize:      sd.PageSize, // users can be in more groups than the server returns in one go
+	}
+
+	seen := keysOf(direct)
+	inherited := Groups{}
+	err := conn.SearchPaged(ctx, searchRequest, func(entry *ldapClient.Entry) error {
+		name := extractUserGroupFrom(entry.DN, sd.GroupAttribute)
+		if key := dnKey(entry.DN); name != "" && !seen[key] {
+			seen[key] = true
+			inherited = append(inherited, Group{Name: name, DN: entry.DN})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inherited, nil
+}
+
+// nestedGroupsOf does a breadth first search up from the direct groups. Groups already seen are not followed again,
+// which stops membership cycles, e.g. A in B in A, looping forever.
+func nestedGroupsOf(ctx context.Context, conn ldap.Conn, sd *SearchDetails, direct Groups) (Groups, error) {
+	seen := keysOf(direct)
+	inherited := Groups{}
+	for depth, level := 0, direct; depth < sd.MaxNestingDepth && len(level) > 0; depth++ {
+		nextLevel := Groups{}
+		for _, group := range level {
+			parents, err := parentGroupsOf(ctx, conn, sd, group.DN)
+			if err != nil {
+				return nil, err
+			}
+			for _, parent := range parents {
+				if key := dnKey(parent.DN); !seen[key] {
+					seen[key] = true
+					inherited = append(inherited, parent)
+					nextLevel = append(nextLevel, parent)
+				}
+			}
+		}
+		level = nextLevel
+	}
+	return inherited, nil
+}
+
+// parentGroupsOf reads the groups a group is itself a member of. A group that cannot be read, e.g. one in another
+// domain or one the bind user cannot see, has no parents rather than failing the search.
+func parentGroupsOf(ctx context.Context, conn ldap.Conn, sd *SearchDetails, groupDN string) (Groups, error) {
+	searchRequest := ldap.SearchRequest{
+		Attributes:    sd.Attributes,
+		BaseDn:        groupDN,
+		Scope:         ldap.ScopeBaseObject,
+		SearchFilter:  "(objectClass=*)",
+		SearchTimeout: sd.SearchTimeout,
+	}
+
+	searchResults, err := conn.Search(ctx, searchRequest)
+	if isNoSuchObject(err) {
+		return Groups{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return extractUserGroupsFrom(searchResults, sd.GroupAttribute), nil
+}
+
+func (sd *SearchDetails) groupBaseDn() string {
+	if sd.GroupBaseDn != "" {
+		return sd.GroupBaseDn
+	}
+	return sd.BaseDn
+}
+
+func keysOf(groups Groups) map[string]bool {
+	keys := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		keys[dnKey(group.DN)] = true
+	}
+	return keys
+}
+
+// dnKey returns the same key for DNs that only differ in case or escaping.
+func dnKey(dn string) string {
+	parsed, err := ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	return parsed.key()
+}
@@ -0,0 +1,243 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"context"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const userDN = "CN=carlos,OU=Users,DC=com"
+
+func TestInChainSearchShouldReturnInheritedGroupsSeparatelyFromDirectOnes(t *testing.T) {
+	var inChainRequest ldap.SearchRequest
+	searcher := NewSearcher(directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		if strings.HasPrefix(sr.SearchFilter, "(member:") {
+			inChainRequest = sr
+			return entries("CN=direct,OU=Groups,DC=com", "cn=Parent,ou=groups,dc=com", "CN=grandparent,OU=Groups,DC=com"), nil
+		}
+		return userEntry("CN=direct,OU=Groups,DC=com"), nil
+	}))
+	searchDetails := transitiveSearchDetails(TransitiveInChain)
+	searchDetails.GroupBaseDn = "OU=Groups,DC=com"
+	searchDetails.PageSize = 500
+
+	userGroups, err := searcher.GetGroupsFor(context.Background(), searchDetails, "carlos")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if expected := `(member:1.2.840.113556.1.4.1941:=CN=carlos,OU=Users,DC=com)`; inChainRequest.SearchFilter != expected {
+		t.Errorf("In chain filter is wrong. Expected: %s, got: %s", expected, inChainRequest.SearchFilter)
+	}
+	if inChainRequest.BaseDn != "OU=Groups,DC=com" {
+		t.Errorf("In chain search should use the group base DN, got: %s", inChainRequest.BaseDn)
+	}
+	if inChainRequest.PageSize != 500 {
+		t.Errorf("In chain search should be paged, page size: %d", inChainRequest.PageSize)
+	}
+	if !reflect.DeepEqual(userGroups.Direct.Names(), []string{"direct"}) {
+		t.Errorf("Direct groups are wrong: %v", userGroups.Direct.Names())
+	}
+	if !reflect.DeepEqual(userGroups.Inherited.Names(), []string{"Parent", "grandparent"}) {
+		t.Errorf("Inherited groups are wrong: %v", userGroups.Inherited.Names())
+	}
+}
+
+func TestInChainSearchShouldEscapeUserDNInFilter(t *testing.T) {
+	var filter string
+	searcher := NewSearcher(directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		if strings.HasPrefix(sr.SearchFilter, "(member:") {
+			filter = sr.SearchFilter
+			return entries(), nil
+		}
+		return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{ldapClient.NewEntry("CN=a*b (c),DC=com", nil)}}, nil
+	}))
+
+	if _, err := searcher.GetGroupsFor(context.Background(), transitiveSearchDetails(TransitiveInChain), "carlos"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if expected := `(member:1.2.840.113556.1.4.1941:=CN=a\2ab \28c\29,DC=com)`; filter != expected {
+		t.Errorf("In chain filter is wrong. Expected: %s, got: %s", expected, filter)
+	}
+}
+
+func TestClientSearchShouldFollowNestedGroupsAndStopAtCycles(t *testing.T) {
+	// a is in b, b is in c and c is back in a
+	searcher := NewSearcher(nestedDirectory(map[string][]string{
+		userDN:                  {"CN=a,OU=Groups,DC=com"},
+		"CN=a,OU=Groups,DC=com": {"CN=b,OU=Groups,DC=com"},
+		"CN=b,OU=Groups,DC=com": {"CN=c,OU=Groups,DC=com"},
+		"CN=c,OU=Groups,DC=com": {"cn=A,ou=groups,dc=com"},
+	}))
+
+	userGroups, err := searcher.GetGroupsFor(context.Background(), transitiveSearchDetails(TransitiveClient), "carlos")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(userGroups.Direct.Names(), []string{"a"}) {
+		t.Errorf("Direct groups are wrong: %v", userGroups.Direct.Names())
+	}
+	if !reflect.DeepEqual(userGroups.Inherited.Names(), []string{"b", "c"}) {
+		t.Errorf("Inherited groups are wrong: %v", userGroups.Inherited.Names())
+	}
+}
+
+func TestClientSearchShouldReturnGroupsInheritedThroughSeveralPathsOnce(t *testing.T) {
+	// a and b are both in c
+	searcher := NewSearcher(nestedDirectory(map[string][]string{
+		userDN:                  {"CN=a,OU=Groups,DC=com", "CN=b,OU=Groups,DC=com"},
+		"CN=a,OU=Groups,DC=com": {"CN=c,OU=Groups,DC=com"},
+		"CN=b,OU=Groups,DC=com": {"CN=c,OU=Groups,DC=com"},
+	}))
+
+	userGroups, err := searcher.GetGroupsFor(context.Background(), transitiveSearchDetails(TransitiveClient), "carlos")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(userGroups.Inherited.Names(), []string{"c"}) {
+		t.Errorf("Inherited groups are wrong: %v", userGroups.Inherited.Names())
+	}
+}
+
+func TestClientSearchShouldStopAtMaxNestingDepth(t *testing.T) {
+	searcher := NewSearcher(nestedDirectory(map[string][]string{
+		userDN:                  {"CN=a,OU=Groups,DC=com"},
+		"CN=a,OU=Groups,DC=com": {"CN=b,OU=Groups,DC=com"},
+		"CN=b,OU=Groups,DC=com": {"CN=c,OU=Groups,DC=com"},
+		"CN=c,OU=Groups,DC=com": {"CN=d,OU=Groups,DC=com"},
+	}))
+	searchDetails := transitiveSearchDetails(TransitiveClient)
+	searchDetails.MaxNestingDepth = 2
+
+	userGroups, err := searcher.GetGroupsFor(context.Background(), searchDetails, "carlos")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(userGroups.Inherited.Names(), []string{"b", "c"}) {
+		t.Errorf("Inherited groups are wrong: %v", userGroups.Inherited.Names())
+	}
+}
+
+func TestClientSearchShouldSkipGroupsThatCannotBeRead(t *testing.T) {
+	// the user is in a group in another domain, which isn't in this directory
+	searcher := NewSearcher(nestedDirectory(map[string][]string{
+		userDN:                  {"CN=a,OU=Groups,DC=com", "CN=foreign,OU=Groups,DC=other,DC=com"},
+		"CN=a,OU=Groups,DC=com": {"CN=b,OU=Groups,DC=com"},
+	}))
+
+	userGroups, err := searcher.GetGroupsFor(context.Background(), transitiveSearchDetails(TransitiveClient), "carlos")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(userGroups.Direct.Names(), []string{"a", "foreign"}) {
+		t.Errorf("Direct groups are wrong: %v", userGroups.Direct.Names())
+	}
+	if !reflect.DeepEqual(userGroups.Inherited.Names(), []string{"b"}) {
+		t.Errorf("Inherited groups are wrong: %v", userGroups.Inherited.Names())
+	}
+}
+
+func TestNestedGroupsAreNotSearchedUnlessTransitive(t *testing.T) {
+	searches := 0
+	searcher := NewSearcher(directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		searches++
+		return userEntry("CN=a,OU=Groups,DC=com"), nil
+	}))
+
+	userGroups, err := searcher.GetGroupsFor(context.Background(), someSearchDetails(), "carlos")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if searches != 1 {
+		t.Errorf("Only the user should have been searched for, searches: %d", searches)
+	}
+	if len(userGroups.Inherited) != 0 {
+		t.Errorf("No inherited groups should have been returned: %v", userGroups.Inherited)
+	}
+}
+
+func TestUnknownTransitiveMethodShouldReturnError(t *testing.T) {
+	searcher := NewSearcher(directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		return userEntry("CN=a,OU=Groups,DC=com"), nil
+	}))
+
+	_, err := searcher.GetGroupsFor(context.Background(), transitiveSearchDetails("recursive"), "carlos")
+
+	if err == nil || err.Error() != `Unknown transitive method "recursive"` {
+		t.Errorf("Expected unknown transitive method error, got: %v", err)
+	}
+}
+
+func transitiveSearchDetails(method string) *SearchDetails {
+	searchDetails := someSearchDetails()
+	searchDetails.Transitive = true
+	searchDetails.TransitiveMethod = method
+	searchDetails.MaxNestingDepth = 10
+	return searchDetails
+}
+
+// nestedDirectory answers the user search with the user's memberOf values and base searches on a group with the
+// group's, from memberships which maps each DN to the groups it is a member of. There is no such object for any
+// other DN.
+func nestedDirectory(memberships map[string][]string) *mockClient {
+	return directoryClient(func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		if sr.Scope != ldap.ScopeBaseObject {
+			return userEntry(memberships[userDN]...), nil
+		}
+		for dn, memberOf := range memberships {
+			if dnKey(dn) == dnKey(sr.BaseDn) {
+				return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{
+					ldapClient.NewEntry(dn, map[string][]string{"memberOf": memberOf}),
+				}}, nil
+			}
+		}
+		return nil, ldapClient.NewError(ldapClient.LDAPResultNoSuchObject, errors.New("no such object"))
+	})
+}
+
+func directoryClient(search func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error)) *mockClient {
+	return &mockClient{
+		connect: func() error { return nil },
+		close:   func() {},
+		search:  search,
+	}
+}
+
+func userEntry(memberOf ...string) *ldapClient.SearchResult {
+	return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{
+		ldapClient.NewEntry(userDN, map[string][]string{"memberOf": memberOf}),
+	}}
+}
+
+func entries(dns ...string) *ldapClient.SearchResult {
+	searchResult := &ldapClient.SearchResult{}
+	for _, dn := range dns {
+		searchResult.Entries = append(searchResult.Entries, ldapClient.NewEntry(dn, nil))
+	}
+	return searchResult
+}
@@ -17,21 +17,71 @@ limitations under the License.
 package group
 
 import (
+	"context"
 	"github.com/ExpediaGroup/flyte-ldap/ldap"
 	ldapClient "gopkg.in/ldap.v2"
 	"strings"
 )
 
 type SearchDetails struct {
-	Attributes     []string // i.e. the attributes to be returned by the group, e.g. 'memberOf'
-	BaseDn         string
-	SearchFilter   string
-	GroupAttribute string // the attribute that gives the name of the group from the attribute values, e.g. 'cn'
-	SearchTimeout  int
+	Attributes        []string // i.e. the attributes to be returned by the group, e.g. 'memberOf'
+	BaseDn            string
+	SearchFilter      string // '{username}' is replaced by the escaped username
+	GroupAttribute    string // the attribute that gives the name of the group from the attribute values, e.g. 'cn'
+	SearchTimeout     int
+	MaxUsernameLength int      // usernames longer than this are rejected without searching, 0 means no limit
+	Transitive        bool     // also resolve the groups inherited through nested groups
+	TransitiveMethod  string   // how inherited groups are resolved, TransitiveClient (the default) or TransitiveInChain
+	MaxNestingDepth   int      // the levels of nesting TransitiveClient follows
+	GroupBaseDn       string   // where TransitiveInChain searches for groups, BaseDn if empty
+	GroupSearchFilter string   // finds a group by name, '{group}' is replaced by the escaped name
+	MemberAttributes  []string // the attributes returned for each member of a group, e.g. 'mail'
+	UserAttributes    []string // the attributes the user package may return for a user, e.g. 'mail'
+	PageSize          int      // entries per page of searches that may find many, 0 means they are not paged
 }
 
+// UserGroups are the groups a user is a member of.
+type UserGroups struct {
+	Direct    Groups
+	Inherited Groups // the groups a user is a member of through nested groups, only resolved by transitive searches
+	Cached    bool   // the groups were found by an earlier search, see NewCachingSearcher
+}
+
+type Group struct {
+	Name string // the value of the group attribute, e.g. 'London team'
+	DN   string
+}
+
+type Groups []Group
+
+func (g Groups) Names() []string {
+	names := make([]string, len(g))
+	for i, group := range g {
+		names[i] = group.Name
+	}
+	return names
+}
+
+// Find returns the group matching nameOrDN, either a full DN, e.g. 'CN=London team,OU=Groups,DC=com', or a name,
+// e.g. 'London team', ignoring case. A name matches a group of that name anywhere in the directory, so use GetGroupDN
+// to find the DN of the group a name stands for when that matters, e.g. when deciding access.
+func (g Groups) Find(nameOrDN string) (Group, bool) {
+	dn, err := ParseDN(nameOrDN)
+	isDN := err == nil && len(dn) > 0
+	for _, group := range g {
+		if isDN && dnKey(group.DN) == dn.key() || !isDN && strings.EqualFold(group.Name, nameOrDN) {
+			return group, true
+		}
+	}
+	return Group{}, false
+}
+
+// Searcher is safe for concurrent use, every search is made on a connection of its own. Searches are given up on
+// once ctx is done, returning an *ldap.TimeoutError.
 type Searcher interface {
-	GetGroupsFor(sd *SearchDetails, username string) ([]string, error)
+	GetGroupsFor(ctx context.Context, sd *SearchDetails, username string) (*UserGroups, error)
+	GetMembersOf(ctx context.Context, sd *SearchDetails, nameOrDN string) (Members, error)
+	GetGroupDN(ctx context.Context, sd *SearchDetails, nameOrDN string) (string, error)
 }
 
 type searcher struct {
@@ -42,34 +92,77 @@ func NewSearcher(client ldap.Client) Searcher {
 	return &searcher{client: client}
 }
 
-func (searcher *searcher) GetGroupsFor(sd *SearchDetails, username string) ([]string, error) {
-	if err := searcher.client.Connect(); err != nil {
+func (searcher *searcher) GetGroupsFor(ctx context.Context, sd *SearchDetails, username string) (*UserGroups, error) {
+	if err := ValidateUsername(username, sd.MaxUsernameLength); err != nil {
+		return nil, err
+	}
+
+	conn, err := searcher.client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	searchResults, err := searchUser(ctx, conn, sd, username, sd.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	userGroups := &UserGroups{Direct: extractUserGroupsFrom(searchResults, sd.GroupAttribute), Inherited: Groups{}}
+	if sd.Transitive {
+		userGroups.Inherited, err = inheritedGroupsFor(ctx, conn, sd, searchResults.Entries[0].DN, userGroups.Direct)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return userGroups, nil
+}
+
+// FindUser returns the entry SearchFilter finds for the username, with the given attributes. A UserNotFoundError or
+// AmbiguousUserError is returned unless exactly one user is found. The username should already have been checked by
+// ValidateUsername.
+func FindUser(ctx context.Context, conn ldap.Conn, sd *SearchDetails, username string, attributes []string) (*ldapClient.Entry, error) {
+	searchResults, err := searchUser(ctx, conn, sd, username, attributes)
+	if err != nil {
 		return nil, err
 	}
-	defer searcher.client.Close()
+	return searchResults.Entries[0], nil
+}
 
+// searchUser returns the search results holding the one user SearchFilter finds for the username.
+func searchUser(ctx context.Context, conn ldap.Conn, sd *SearchDetails, username string, attributes []string) (*ldapClient.SearchResult, error) {
 	searchRequest := ldap.SearchRequest{
-		Attributes:    sd.Attributes,
+		Attributes:    attributes,
 		BaseDn:        sd.BaseDn,
-		SearchFilter:  strings.Replace(sd.SearchFilter, "{username}", username, -1),
+		SearchFilter:  ldap.ExpandFilter(sd.SearchFilter, map[string]string{"username": username}),
 		SearchTimeout: sd.SearchTimeout,
 	}
 
-	searchResults, err := searcher.client.Search(searchRequest)
-
+	searchResults, err := conn.Search(ctx, searchRequest)
 	if err != nil {
 		return nil, err
 	}
-	return extractUserGroupsFrom(searchResults, sd.GroupAttribute), nil
+	switch len(searchResults.Entries) {
+	case 0:
+		return nil, &UserNotFoundError{Username: username}
+	case 1:
+		return searchResults, nil
+	default:
+		dns := make([]string, len(searchResults.Entries))
+		for i, entry := range searchResults.Entries {
+			dns[i] = entry.DN
+		}
+		return nil, &AmbiguousUserError{Username: username, DNs: dns}
+	}
 }
 
-func extractUserGroupsFrom(searchResults *ldapClient.SearchResult, groupAttribute string) []string {
-	groups := []string{}
+func extractUserGroupsFrom(searchResults *ldapClient.SearchResult, groupAttribute string) Groups {
+	groups := Groups{}
 	if len(searchResults.Entries) > 0 {
 		for _, attr := range searchResults.Entries[0].Attributes {
 			for _, attributeValue := range attr.Values {
 				if userGroup := extractUserGroupFrom(attributeValue, groupAttribute); userGroup != "" {
-					groups = append(groups, userGroup)
+					groups = append(groups, Group{Name: userGroup, DN: attributeValue})
 				}
 			}
 		}
@@ -77,11 +170,13 @@ func extractUserGroupsFrom(searchResults *ldapClient.SearchResult, groupAttribut
 	return groups
 }
 
+// extractUserGroupFrom returns the value of the group attribute from a group DN, e.g. 'London team' from
+// 'CN=London team,OU=Distribution Lists,DC=com' for 'cn'. Values that are not DNs have no group.
 func extractUserGroupFrom(attributeValue, groupAttribute string) string {
-	for _, v := range strings.Split(attributeValue, ",") {
-		if strings.HasPrefix(strings.ToUpper(v), strings.ToUpper(groupAttribute)+"=") {
-			return v[3:]
-		}
+	dn, err := ParseDN(attributeValue)
+	if err != nil {
+		return ""
 	}
-	return ""
+	userGroup, _ := dn.ValueOf(groupAttribute)
+	return userGroup
 }
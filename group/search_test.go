@@ -17,6 +17,7 @@ limitations under the License.
 package group
 
 import (
+	"context"
 	"errors"
 	"github.com/ExpediaGroup/flyte-ldap/ldap"
 	ldapClient "gopkg.in/ldap.v2"
@@ -36,12 +37,12 @@ func TestClientConnectAndCloseAreCalledWhenCallingGetGroupsFor(t *testing.T) {
 			isClientCloseCalled = true
 		},
 		search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
-			return &ldapClient.SearchResult{}, nil
+			return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{{DN: "cn=dave-jones,DC=com"}}}, nil
 		}}
 	searcher := NewSearcher(mockClient)
 	searchDetails := &SearchDetails{}
 
-	_, err := searcher.GetGroupsFor(searchDetails, "dave-jones")
+	_, err := searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones")
 
 	if err != nil {
 		t.Fatalf("Unexpected error: %s", err.Error())
@@ -63,7 +64,7 @@ func TestErrorIsReturnedIfClientConnectError(t *testing.T) {
 	searcher := NewSearcher(mockClient)
 	searchDetails := &SearchDetails{}
 
-	_, err := searcher.GetGroupsFor(searchDetails, "dave-jones")
+	_, err := searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones")
 
 	if err == nil {
 		t.Fatal("Expected error!")
@@ -79,13 +80,13 @@ func TestSearchShouldReturnsUserGroups(t *testing.T) {
 			{
 				DN: "cn=dave-jones,OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE,",
 				Attributes: []*ldapClient.EntryAttribute{
-					{"memberOf", []string{
+					{Name: "memberOf", Values: []string{
 						"CN=London team,OU=Distribution Lists,DC=com",
 						"OU=Distribution Lists,cn=New York team,DC=com,DC=EDFR,DC=DFER,DC=com",
 						"OU=Dave DLs,DC=SWD,DC=DFER,DC=com,cN=Paris team",
-						"Cn=Brussels team,OU=John DLs,DC=SWE,DC=DFER,DC=com"}, nil},
-					{"uid", []string{"fsdf56sdf54fs645f"}, nil},
-					{"description", []string{"Something about Dave"}, nil},
+						"Cn=Brussels team,OU=John DLs,DC=SWE,DC=DFER,DC=com"}},
+					{Name: "uid", Values: []string{"fsdf56sdf54fs645f"}},
+					{Name: "description", Values: []string{"Something about Dave"}},
 				}},
 		},
 	}
@@ -98,26 +99,26 @@ func TestSearchShouldReturnsUserGroups(t *testing.T) {
 	searcher := NewSearcher(mockClient)
 	searchDetails := someSearchDetails()
 
-	userGroups, err := searcher.GetGroupsFor(searchDetails, "dave-jones")
+	userGroups, err := searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones")
 
 	if err != nil {
 		t.Fatalf("Unexpected search error: %s", err.Error())
 	}
-	if userGroups[0] != "London team" {
-		t.Errorf("User group should be 'London team', is: %v", userGroups[0])
+	if userGroups.Direct[0].Name != "London team" {
+		t.Errorf("User group should be 'London team', is: %v", userGroups.Direct[0].Name)
 	}
-	if userGroups[1] != "New York team" {
-		t.Errorf("User group should be 'New York team', is: %v", userGroups[1])
+	if userGroups.Direct[1].Name != "New York team" {
+		t.Errorf("User group should be 'New York team', is: %v", userGroups.Direct[1].Name)
 	}
-	if userGroups[2] != "Paris team" {
-		t.Errorf("User group should be 'Paris team', is: %v", userGroups[2])
+	if userGroups.Direct[2].Name != "Paris team" {
+		t.Errorf("User group should be 'Paris team', is: %v", userGroups.Direct[2].Name)
 	}
-	if userGroups[3] != "Brussels team" {
-		t.Errorf("User group should be 'Brussels team', is: %v", userGroups[3])
+	if userGroups.Direct[3].Name != "Brussels team" {
+		t.Errorf("User group should be 'Brussels team', is: %v", userGroups.Direct[3].Name)
 	}
 }
 
-func TestSearchShouldNotReturnsUserGroupsIfNoSearchResultsAreReturned(t *testing.T) {
+func TestSearchShouldReturnUserNotFoundErrorIfNoSearchResultsAreReturned(t *testing.T) {
 	mockClient := &mockClient{
 		connect: func() error { return nil },
 		close:   func() {},
@@ -127,12 +128,46 @@ func TestSearchShouldNotReturnsUserGroupsIfNoSearchResultsAreReturned(t *testing
 	searcher := NewSearcher(mockClient)
 	searchDetails := someSearchDetails()
 
-	userGroups, err := searcher.GetGroupsFor(searchDetails, "dave-jones")
+	userGroups, err := searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones")
 
-	if err != nil {
-		t.Fatalf("Unexpected search error: %s", err.Error())
+	var notFound *UserNotFoundError
+	if !errors.As(err, &notFound) || notFound.Username != "dave-jones" {
+		t.Fatalf("Expected user not found error, got: %v", err)
 	}
-	if len(userGroups) > 0 {
+	if err.Error() != `User "dave-jones" not found` {
+		t.Errorf("Error message is wrong: %s", err.Error())
+	}
+	if userGroups != nil {
+		t.Errorf("No user groups should have been returned. User groups returned: %v", userGroups)
+	}
+}
+
+func TestSearchShouldReturnAmbiguousUserErrorIfSeveralSearchResultsAreReturned(t *testing.T) {
+	mockClient := &mockClient{
+		connect: func() error { return nil },
+		close:   func() {},
+		search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+			return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{
+				{DN: "cn=dave-jones,OU=London,DC=com"},
+				{DN: "cn=dave-jones,OU=Paris,DC=com"},
+			}}, nil
+		}}
+	searcher := NewSearcher(mockClient)
+	searchDetails := someSearchDetails()
+
+	userGroups, err := searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones")
+
+	var ambiguous *AmbiguousUserError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("Expected ambiguous user error, got: %v", err)
+	}
+	if !reflect.DeepEqual(ambiguous.DNs, []string{"cn=dave-jones,OU=London,DC=com", "cn=dave-jones,OU=Paris,DC=com"}) {
+		t.Errorf("DNs are wrong: %v", ambiguous.DNs)
+	}
+	if err.Error() != `Username "dave-jones" is ambiguous, 2 users found` {
+		t.Errorf("Error message is wrong: %s", err.Error())
+	}
+	if userGroups != nil {
 		t.Errorf("No user groups should have been returned. User groups returned: %v", userGroups)
 	}
 }
@@ -147,7 +182,7 @@ func TestSearchShouldReturnClientSearchError(t *testing.T) {
 	searcher := NewSearcher(mockClient)
 	searchDetails := someSearchDetails()
 
-	_, err := searcher.GetGroupsFor(searchDetails, "dave-jones")
+	_, err := searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones")
 
 	if err == nil {
 		t.Error("Search should've returned an error.")
@@ -169,7 +204,7 @@ func TestCorrectParametersArePassedToClientSearch(t *testing.T) {
 	searcher := NewSearcher(mockClient)
 	searchDetails := someSearchDetails()
 
-	searcher.GetGroupsFor(searchDetails, "dave-jones")
+	searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones")
 
 	if !reflect.DeepEqual(searchRequest.Attributes, []string{"memberOf"}) {
 		t.Errorf("Search request attributes is wrong. Should be 'memberOf', is: %s", searchRequest.Attributes)
@@ -185,36 +220,75 @@ func TestCorrectParametersArePassedToClientSearch(t *testing.T) {
 	}
 }
 
+func TestUsernameIsEscapedInSearchFilter(t *testing.T) {
+	var searchRequest ldap.SearchRequest
+	mockClient := &mockClient{
+		connect: func() error { return nil },
+		close:   func() {},
+		search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+			searchRequest = sr
+			return &ldapClient.SearchResult{}, nil
+		}}
+	searcher := NewSearcher(mockClient)
+	searchDetails := someSearchDetails()
+
+	searcher.GetGroupsFor(context.Background(), searchDetails, "*)(objectClass=*")
+
+	if searchRequest.SearchFilter != "(mailNickname=\\2a\\29\\28objectClass=\\2a)" {
+		t.Errorf("Group filter is wrong. Should be '(mailNickname=\\2a\\29\\28objectClass=\\2a)', is: %s", searchRequest.SearchFilter)
+	}
+}
+
+func TestInvalidUsernameIsRejectedWithoutConnecting(t *testing.T) {
+	mockClient := &mockClient{
+		connect: func() error {
+			t.Fatal("Client connect should not have been called.")
+			return nil
+		},
+	}
+	searcher := NewSearcher(mockClient)
+	searchDetails := someSearchDetails()
+
+	_, err := searcher.GetGroupsFor(context.Background(), searchDetails, "dave-jones-the-longest-username")
+
+	if err == nil {
+		t.Fatal("Expected error!")
+	}
+	if err.Error() != "Invalid username: longer than 20 characters" {
+		t.Errorf("Error message not correct. Expected: 'Invalid username: longer than 20 characters', actual: '%s'", err.Error())
+	}
+}
+
 func TestExtractUserGroupsShouldExtractUserGroupsFromSearchResults(t *testing.T) {
 	searchResults := &ldapClient.SearchResult{
 		Entries: []*ldapClient.Entry{
 			{
 				DN: "cn=dave-jones,OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE,",
 				Attributes: []*ldapClient.EntryAttribute{
-					{"memberOf", []string{
+					{Name: "memberOf", Values: []string{
 						"CN=London team,OU=Distribution Lists,DC=com",
 						"OU=Distribution Lists,cn=New York team,DC=com,DC=EDFR,DC=DFER,DC=com",
 						"OU=Dave DLs,DC=SWD,DC=DFER,DC=com,cN=Paris team",
-						"Cn=Brussels team,OU=John DLs,DC=SWE,DC=DFER,DC=com"}, nil},
-					{"uid", []string{"fsdf56sdf54fs645f"}, nil},
-					{"description", []string{"Something about Dave"}, nil},
+						"Cn=Brussels team,OU=John DLs,DC=SWE,DC=DFER,DC=com"}},
+					{Name: "uid", Values: []string{"fsdf56sdf54fs645f"}},
+					{Name: "description", Values: []string{"Something about Dave"}},
 				}},
 		},
 	}
 
 	userGroups := extractUserGroupsFrom(searchResults, "cn")
 
-	if userGroups[0] != "London team" {
-		t.Errorf("User group should be 'London team', is: %v", userGroups[0])
+	if userGroups[0].Name != "London team" {
+		t.Errorf("User group should be 'London team', is: %v", userGroups[0].Name)
 	}
-	if userGroups[1] != "New York team" {
-		t.Errorf("User group should be 'New York team', is: %v", userGroups[1])
+	if userGroups[1].Name != "New York team" {
+		t.Errorf("User group should be 'New York team', is: %v", userGroups[1].Name)
 	}
-	if userGroups[2] != "Paris team" {
-		t.Errorf("User group should be 'Paris team', is: %v", userGroups[2])
+	if userGroups[2].Name != "Paris team" {
+		t.Errorf("User group should be 'Paris team', is: %v", userGroups[2].Name)
 	}
-	if userGroups[3] != "Brussels team" {
-		t.Errorf("User group should be 'Brussels team', is: %v", userGroups[3])
+	if userGroups[3].Name != "Brussels team" {
+		t.Errorf("User group should be 'Brussels team', is: %v", userGroups[3].Name)
 	}
 }
 
@@ -228,13 +302,69 @@ func TestExtractUserGroupsShouldReturnEmptyStringArrayFromEmptySearchResults(t *
 	}
 }
 
+func TestFindShouldMatchGroupsByNameOrDNIgnoringCase(t *testing.T) {
+	groups := Groups{
+		{Name: "London team", DN: "CN=London team,OU=Distribution Lists,DC=com"},
+		{Name: "Paris, France", DN: `CN=Paris\, France,OU=Distribution Lists,DC=com`},
+	}
+	tests := []struct {
+		nameOrDN string
+		found    string
+	}{
+		{"London team", "London team"},
+		{"london TEAM", "London team"},
+		{"CN=London team,OU=Distribution Lists,DC=com", "London team"},
+		{"cn=london team, ou=distribution lists, dc=com", "London team"},
+		{`CN="Paris, France",OU=Distribution Lists,DC=com`, "Paris, France"},
+		{"Paris, France", "Paris, France"},
+		{"London", ""},
+		{"CN=London team,OU=Other,DC=com", ""},
+	}
+
+	for _, test := range tests {
+		group, found := groups.Find(test.nameOrDN)
+		if found != (test.found != "") || group.Name != test.found {
+			t.Errorf("Find(%q) should have found %q, found: %q (%v)", test.nameOrDN, test.found, group.Name, found)
+		}
+	}
+}
+
+func TestGetGroupsForShouldStopSearchingWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	searches := 0
+	mockClient := &mockClient{
+		connect: func() error { return nil },
+		close:   func() {},
+		search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+			searches++
+			cancel()
+			return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{{DN: "cn=dave-jones,DC=com", Attributes: []*ldapClient.EntryAttribute{
+				{Name: "memberOf", Values: []string{"CN=London team,OU=Groups,DC=com"}},
+			}}}}, nil
+		}}
+	searchDetails := someSearchDetails()
+	searchDetails.Transitive = true
+	searchDetails.MaxNestingDepth = 10
+
+	_, err := NewSearcher(mockClient).GetGroupsFor(ctx, searchDetails, "dave-jones")
+
+	var timeoutErr *ldap.TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout() {
+		t.Errorf("Should've returned a cancellation, returned: %v", err)
+	}
+	if searches != 1 {
+		t.Errorf("Nested groups should not have been searched once cancelled, searches: %d", searches)
+	}
+}
+
 func someSearchDetails() *SearchDetails {
 	return &SearchDetails{
-		Attributes:     []string{"memberOf"},
-		BaseDn:         "cn=blah-blah,OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE,",
-		SearchFilter:   "(mailNickname={username})",
-		GroupAttribute: "cn",
-		SearchTimeout:  20,
+		Attributes:        []string{"memberOf"},
+		BaseDn:            "cn=blah-blah,OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE,",
+		SearchFilter:      "(mailNickname={username})",
+		GroupAttribute:    "cn",
+		SearchTimeout:     20,
+		MaxUsernameLength: 20,
 	}
 }
 
@@ -242,16 +372,55 @@ type mockClient struct {
 	connect func() error
 	close   func()
 	search  func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error)
+	modify  func(mr *ldapClient.ModifyRequest) error
 }
 
-func (c *mockClient) Connect() error {
-	return c.connect()
+func (c *mockClient) Connect(context.Context) (ldap.Conn, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return &mockConn{close: c.close, search: c.search, modify: c.modify}, nil
+}
+
+func (c *mockClient) Authenticate(_ context.Context, userDN, password string) error {
+	return nil
 }
 
-func (c *mockClient) Search(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+func (c *mockClient) Close() {}
+
+type mockConn struct {
+	close  func()
+	search func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error)
+	modify func(mr *ldapClient.ModifyRequest) error
+}
+
+func (c *mockConn) Search(ctx context.Context, sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &ldap.TimeoutError{Op: "search", Err: err}
+	}
 	return c.search(sr)
 }
 
-func (c *mockClient) Close() {
+func (c *mockConn) Modify(ctx context.Context, mr *ldapClient.ModifyRequest) error {
+	if err := ctx.Err(); err != nil {
+		return &ldap.TimeoutError{Op: "modify", Err: err}
+	}
+	return c.modify(mr)
+}
+
+func (c *mockConn) SearchPaged(ctx context.Context, sr ldap.SearchRequest, handle func(*ldapClient.Entry) error) error {
+	searchResults, err := c.Search(ctx, sr)
+	if err != nil {
+		return err
+	}
+	for _, entry := range searchResults.Entries {
+		if err := handle(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *mockConn) Close() {
 	c.close()
 }
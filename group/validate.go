@@ -0,0 +1,40 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ValidateUsername rejects input that can never be a legitimate username before it gets anywhere near the directory.
+// A maxLength of 0 means the length is not limited.
+func ValidateUsername(username string, maxLength int) error {
+	if !utf8.ValidString(username) {
+		return fmt.Errorf("Invalid username: not valid UTF-8")
+	}
+	if maxLength > 0 && utf8.RuneCountInString(username) > maxLength {
+		return fmt.Errorf("Invalid username: longer than %d characters", maxLength)
+	}
+	for _, r := range username {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("Invalid username: contains control character %U", r)
+		}
+	}
+	return nil
+}
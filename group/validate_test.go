@@ -0,0 +1,45 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import "testing"
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username  string
+		maxLength int
+		expected  string
+	}{
+		{username: "dave-jones", maxLength: 10},
+		{username: "dave-jones", maxLength: 0},
+		{username: "dave-jones", maxLength: 9, expected: "Invalid username: longer than 9 characters"},
+		{username: "Jürgen", maxLength: 6},
+		{username: "dave\njones", maxLength: 256, expected: "Invalid username: contains control character U+000A"},
+		{username: "dave\x00", maxLength: 256, expected: "Invalid username: contains control character U+0000"},
+		{username: "dave\xff", maxLength: 256, expected: "Invalid username: not valid UTF-8"},
+	}
+
+	for _, test := range tests {
+		err := ValidateUsername(test.username, test.maxLength)
+		if test.expected == "" && err != nil {
+			t.Errorf("Username %q should be valid, got error: %s", test.username, err.Error())
+		}
+		if test.expected != "" && (err == nil || err.Error() != test.expected) {
+			t.Errorf("Username %q should be rejected with %q, got: %v", test.username, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"github.com/HotelsDotCom/go-logger"
+	"net/http"
+)
+
+type healthPayload struct {
+	Status            string `json:"status"`
+	Registered        bool   `json:"registered"`
+	RegistrationError string `json:"registrationError,omitempty"`
+}
+
+type readinessPayload struct {
+	Ready       bool              `json:"ready"`
+	Directories map[string]Result `json:"directories"`
+}
+
+// Healthz answers 200 while the process is up, reporting whether the pack has registered with Flyte. It does not
+// fail while the pack is registering, as restarting the pack would not help it register.
+func Healthz(registration *Registration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		registered, err := registration.State()
+		payload := healthPayload{Status: "ok", Registered: registered}
+		if err != nil {
+			payload.RegistrationError = err.Error()
+		}
+		writeJSON(w, http.StatusOK, payload)
+	}
+}
+
+// Readyz answers 200 if every directory was ready when last probed, 503 otherwise, with the result of each.
+func Readyz(prober *Prober) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		results, ready := prober.Results()
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, readinessPayload{Ready: ready, Directories: results})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		logger.Errorf("Cannot write health response: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/HotelsDotCom/flyte-client/client"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthzShouldBeHealthyWhileRegistering(t *testing.T) {
+	registration := &Registration{}
+	registration.Client(&mockFlyteClient{err: errors.New("connection refused")}).CreatePack(client.Pack{})
+
+	response := httptest.NewRecorder()
+	Healthz(registration)(response, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	payload := healthPayload{}
+	json.Unmarshal(response.Body.Bytes(), &payload)
+	if response.Code != http.StatusOK || payload.Registered || payload.RegistrationError != "connection refused" {
+		t.Errorf("Response is wrong: %d %s", response.Code, response.Body.String())
+	}
+}
+
+func TestHealthzShouldReportRegistration(t *testing.T) {
+	registration := &Registration{}
+	registration.Client(&mockFlyteClient{}).CreatePack(client.Pack{})
+
+	response := httptest.NewRecorder()
+	Healthz(registration)(response, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	payload := healthPayload{}
+	json.Unmarshal(response.Body.Bytes(), &payload)
+	if response.Code != http.StatusOK || !payload.Registered || payload.RegistrationError != "" {
+		t.Errorf("Response is wrong: %d %s", response.Code, response.Body.String())
+	}
+}
+
+func TestReadyzShouldBeUnavailableUntilDirectoriesAreReady(t *testing.T) {
+	client := &mockClient{connectErr: errors.New("Cannot connect to LDAP: connect timed out")}
+	prober := NewProber(registryOf(t, client), time.Minute)
+	prober.probeAll(context.Background())
+
+	response := httptest.NewRecorder()
+	Readyz(prober)(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Response is wrong: %d %s", response.Code, response.Body.String())
+	}
+
+	client.connectErr = nil
+	prober.probeAll(context.Background())
+
+	response = httptest.NewRecorder()
+	Readyz(prober)(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	payload := readinessPayload{}
+	json.Unmarshal(response.Body.Bytes(), &payload)
+	if response.Code != http.StatusOK || !payload.Ready || !payload.Directories["corp"].Ready {
+		t.Errorf("Response is wrong: %d %s", response.Code, response.Body.String())
+	}
+}
+
+type mockFlyteClient struct {
+	client.Client
+	err error
+}
+
+func (c *mockFlyteClient) CreatePack(client.Pack) error {
+	return c.err
+}
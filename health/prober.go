@@ -0,0 +1,139 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/HotelsDotCom/go-logger"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of probing a directory.
+type Result struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Prober probes every directory in the background, so readiness checks get the last results straight away rather
+// than each binding and searching, or waiting on a directory that has stopped answering.
+type Prober struct {
+	directories *directory.Registry
+	interval    time.Duration
+
+	mu      sync.Mutex
+	results map[string]Result // nil until the first probe completes
+}
+
+// NewProber creates a prober for the directories, probing them every interval, each probe given interval to complete.
+func NewProber(directories *directory.Registry, interval time.Duration) *Prober {
+	return &Prober{directories: directories, interval: interval}
+}
+
+// Start probes the directories now, then every interval, until stop is closed, or for good if stop is nil.
+func (p *Prober) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			p.probeAll(context.Background())
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Results returns the results of the last probe of each directory, by name, and whether every directory is ready.
+// No directory is ready until the first probe has completed.
+func (p *Prober) Results() (map[string]Result, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := map[string]Result{}
+	ready := p.results != nil
+	for _, name := range p.directories.Names() {
+		result, ok := p.results[name]
+		if !ok {
+			result = Result{Error: "not probed yet"}
+		}
+		results[name] = result
+		ready = ready && result.Ready
+	}
+	return results, ready
+}
+
+// probeAll probes the directories at once, logging those that have become ready, or stopped being ready.
+func (p *Prober) probeAll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.interval)
+	defer cancel()
+
+	names := p.directories.Names()
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			d, _ := p.directories.Get(name)
+			if err := probe(ctx, d); err != nil {
+				results[i] = Result{Error: err.Error()}
+			} else {
+				results[i] = Result{Ready: true}
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	previous := p.results
+	p.results = map[string]Result{}
+	for i, name := range names {
+		p.results[name] = results[i]
+		if last, ok := previous[name]; ok && last.Ready == results[i].Ready {
+			continue
+		}
+		if results[i].Ready {
+			logger.Infof("Directory %q is ready", name)
+		} else {
+			logger.Errorf("Directory %q is not ready: %s", name, results[i].Error)
+		}
+	}
+}
+
+// probe checks the directory can be bound to, as the service account, and its base DN read.
+func probe(ctx context.Context, d *directory.Directory) error {
+	conn, err := d.Client.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Search(ctx, ldap.SearchRequest{
+		Attributes:    []string{ldap.NoAttributes},
+		BaseDn:        d.SearchDetails.BaseDn,
+		Scope:         ldap.ScopeBaseObject,
+		SearchFilter:  "(objectClass=*)",
+		SearchTimeout: d.SearchDetails.SearchTimeout,
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"testing"
+	"time"
+)
+
+func TestProberShouldNotBeReadyUntilProbed(t *testing.T) {
+	prober := NewProber(registryOf(t, &mockClient{}), time.Minute)
+
+	results, ready := prober.Results()
+
+	if ready || results["corp"].Ready || results["corp"].Error != "not probed yet" {
+		t.Errorf("Should not be ready until probed: %+v", results)
+	}
+}
+
+func TestProberShouldBindAndReadBaseDNOfEachDirectory(t *testing.T) {
+	client := &mockClient{}
+	prober := NewProber(registryOf(t, client), time.Minute)
+
+	prober.probeAll(context.Background())
+
+	results, ready := prober.Results()
+	if !ready || !results["corp"].Ready {
+		t.Errorf("Should be ready: %+v", results)
+	}
+	if client.searched.BaseDn != "DC=com" || client.searched.Scope != ldap.ScopeBaseObject {
+		t.Errorf("Should have read the base DN, searched: %+v", client.searched)
+	}
+}
+
+func TestProberShouldNotBeReadyIfADirectoryCannotBeBound(t *testing.T) {
+	client := &mockClient{connectErr: errors.New("Cannot bind to LDAP: bind timed out")}
+	prober := NewProber(registryOf(t, client), time.Minute)
+
+	prober.probeAll(context.Background())
+
+	results, ready := prober.Results()
+	if ready || results["corp"].Error != "Cannot bind to LDAP: bind timed out" {
+		t.Errorf("Should not be ready: %+v", results)
+	}
+}
+
+func TestProberShouldNotBeReadyIfBaseDNCannotBeRead(t *testing.T) {
+	client := &mockClient{searchErr: ldapClient.NewError(ldapClient.LDAPResultNoSuchObject, errors.New("no such object"))}
+	prober := NewProber(registryOf(t, client), time.Minute)
+
+	prober.probeAll(context.Background())
+
+	if _, ready := prober.Results(); ready {
+		t.Error("Should not be ready")
+	}
+}
+
+func registryOf(t *testing.T, client ldap.Client) *directory.Registry {
+	registry, err := directory.NewRegistry("corp", directory.New("corp", client, &group.SearchDetails{BaseDn: "DC=com", SearchTimeout: 20}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return registry
+}
+
+type mockClient struct {
+	connectErr error
+	searchErr  error
+	searched   ldap.SearchRequest
+}
+
+func (c *mockClient) Connect(context.Context) (ldap.Conn, error) {
+	if c.connectErr != nil {
+		return nil, c.connectErr
+	}
+	return &mockConn{client: c}, nil
+}
+
+func (c *mockClient) Authenticate(_ context.Context, userDN, password string) error {
+	return nil
+}
+
+func (c *mockClient) Close() {}
+
+type mockConn struct {
+	client *mockClient
+}
+
+func (c *mockConn) Search(_ context.Context, sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+	c.client.searched = sr
+	if c.client.searchErr != nil {
+		return nil, c.client.searchErr
+	}
+	return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{{DN: sr.BaseDn}}}, nil
+}
+
+func (c *mockConn) Modify(context.Context, *ldapClient.ModifyRequest) error {
+	return nil
+}
+
+func (c *mockConn) SearchPaged(ctx context.Context, sr ldap.SearchRequest, handle func(*ldapClient.Entry) error) error {
+	return nil
+}
+
+func (c *mockConn) Close() {}
@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"github.com/HotelsDotCom/flyte-client/client"
+	"sync"
+)
+
+// Registration records whether the pack has registered with Flyte, by watching the client's attempts to.
+type Registration struct {
+	mu         sync.Mutex
+	registered bool
+	err        error // the last attempt's error, nil once registered
+}
+
+// Client returns c, recording whether each of its attempts to register the pack succeeds.
+func (r *Registration) Client(c client.Client) client.Client {
+	return &registeringClient{Client: c, registration: r}
+}
+
+func (r *Registration) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered = r.registered || err == nil
+	r.err = err
+}
+
+// State returns whether the pack has registered, and the error of the last attempt if it has not.
+func (r *Registration) State() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registered, r.err
+}
+
+type registeringClient struct {
+	client.Client
+	registration *Registration
+}
+
+func (c *registeringClient) CreatePack(pack client.Pack) error {
+	err := c.Client.CreatePack(pack)
+	c.registration.record(err)
+	return err
+}
@@ -0,0 +1,58 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/ExpediaGroup/flyte-ldap/config"
+	"github.com/ExpediaGroup/flyte-ldap/health"
+	"github.com/HotelsDotCom/go-logger"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// serveHTTP serves the Prometheus metrics at '/metrics' and the health checks at '/healthz' and '/readyz', on
+// listeners of their own so they need not be exposed wherever the pack is. They share a listener if their addresses
+// are the same.
+func serveHTTP(cfg *config.Config, registration *health.Registration, prober *health.Prober) {
+	muxes := map[string]*http.ServeMux{}
+	muxFor := func(address string) *http.ServeMux {
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+		}
+		return muxes[address]
+	}
+
+	if cfg.MetricsAddress != "" {
+		muxFor(cfg.MetricsAddress).Handle("/metrics", promhttp.Handler())
+	}
+	if cfg.HealthAddress != "" {
+		mux := muxFor(cfg.HealthAddress)
+		mux.Handle("/healthz", health.Healthz(registration))
+		mux.Handle("/readyz", health.Readyz(prober))
+	}
+
+	for address, mux := range muxes {
+		go serve(address, mux)
+	}
+}
+
+func serve(address string, handler http.Handler) {
+	logger.Infof("Serving metrics and health checks on %s", address)
+	if err := http.ListenAndServe(address, handler); err != nil {
+		logger.Fatalf("Cannot serve on %s: %v", address, err)
+	}
+}
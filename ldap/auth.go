@@ -0,0 +1,109 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gopkg.in/ldap.v2"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AuthenticationError is returned when the directory rejects a user's credentials.
+type AuthenticationError struct {
+	Code   string // the Active Directory sub-code, e.g. '775', if there was one
+	Reason string
+}
+
+func (e *AuthenticationError) Error() string {
+	return "Authentication failed: " + e.Reason
+}
+
+const invalidCredentials = "invalid credentials"
+
+// adReasons are the reasons for the sub-codes Active Directory gives in 'data 775' style in the diagnostic message of
+// an invalid credentials result.
+var adReasons = map[string]string{
+	"525": "user not found",
+	"52e": invalidCredentials,
+	"530": "not permitted to log on at this time",
+	"531": "not permitted to log on at this workstation",
+	"532": "password expired",
+	"533": "account disabled",
+	"701": "account expired",
+	"773": "password must be reset",
+	"775": "account locked",
+}
+
+var adSubCode = regexp.MustCompile(`data ([0-9a-fA-F]+)`)
+
+// Authenticate checks a user's password by binding as the user on a connection of its own, closed straight after,
+// so connections bound as the service account are never affected.
+func (c *ldapClient) Authenticate(ctx context.Context, userDN, password string) error {
+	if password == "" {
+		// a bind with an empty password is an unauthenticated bind, which servers accept whoever the user is
+		return &AuthenticationError{Reason: "empty password"}
+	}
+
+	ldapConn, err := c.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer ldapConn.Close()
+
+	ctx, cancel := withTimeout(ctx, c.timeouts.Bind)
+	defer cancel()
+	start := time.Now()
+	err = withContext(ctx, "bind", ldapConn.Close, func() error {
+		return authenticate(ldapConn, userDN, password)
+	})
+	observe("bind", start, err)
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return fmt.Errorf("Cannot bind to LDAP: %w", err)
+	}
+	return err
+}
+
+func authenticate(conn binder, userDN, password string) error {
+	err := conn.Bind(userDN, password)
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.LDAPResultInvalidCredentials {
+		return newAuthenticationError(ldapErr.Err)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot bind to LDAP: %v", err)
+	}
+	return nil
+}
+
+// newAuthenticationError decodes the Active Directory sub-code from the diagnostic message of an invalid credentials
+// result, e.g. '80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 775, v3839'.
+func newAuthenticationError(diagnostic error) *AuthenticationError {
+	if diagnostic != nil {
+		if match := adSubCode.FindStringSubmatch(diagnostic.Error()); match != nil {
+			code := strings.ToLower(match[1])
+			if reason, ok := adReasons[code]; ok {
+				return &AuthenticationError{Code: code, Reason: reason}
+			}
+		}
+	}
+	return &AuthenticationError{Reason: invalidCredentials}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/ldap.v2"
+	"testing"
+)
+
+func TestAuthenticateShouldSucceedIfUserCanBind(t *testing.T) {
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	client := newTestClient(t, testServer.url, TLSOptions{})
+
+	if err := client.Authenticate(context.Background(), bindDistinguishedName, "letmein"); err != nil {
+		t.Errorf("Unexpected error: '%s'.", err.Error())
+	}
+}
+
+func TestAuthenticateShouldReturnAuthenticationErrorIfUserCannotBind(t *testing.T) {
+	testServer := startLdapServer(t, shouldNotBind)
+	defer testServer.stop()
+	client := newTestClient(t, testServer.url, TLSOptions{})
+
+	err := client.Authenticate(context.Background(), bindDistinguishedName, "letmein")
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) || authErr.Reason != "invalid credentials" {
+		t.Errorf("Expected invalid credentials error, got: %v", err)
+	}
+}
+
+func TestAuthenticateShouldRejectEmptyPasswordWithoutConnecting(t *testing.T) {
+	// note ldap test server not started, an unauthenticated bind would succeed
+	client := newTestClient(t, unusedUrl(t), TLSOptions{})
+
+	err := client.Authenticate(context.Background(), bindDistinguishedName, "")
+
+	var authErr *AuthenticationError
+	if !errors.As(err, &authErr) || authErr.Reason != "empty password" {
+		t.Errorf("Expected empty password error, got: %v", err)
+	}
+}
+
+func TestAuthenticateShouldBindOnANewConnectionWhenPooled(t *testing.T) {
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	client, err := NewPooledClient("corp", StaticCredentials(bindDistinguishedName, bindPassword), []string{testServer.url}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{}, PoolOptions{MaxIdle: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: '%s'.", err.Error())
+	}
+	defer client.Close()
+
+	if err := client.Authenticate(context.Background(), bindDistinguishedName, "letmein"); err != nil {
+		t.Errorf("Unexpected error: '%s'.", err.Error())
+	}
+	if idle := len(client.(*pooledClient).idle); idle != 0 {
+		t.Errorf("The user's connection should not have been pooled, idle connections: %d", idle)
+	}
+}
+
+func TestAuthenticateShouldDecodeActiveDirectorySubCodes(t *testing.T) {
+	tests := map[string]AuthenticationError{
+		"data 52e": {Code: "52e", Reason: "invalid credentials"},
+		"data 525": {Code: "525", Reason: "user not found"},
+		"data 530": {Code: "530", Reason: "not permitted to log on at this time"},
+		"data 532": {Code: "532", Reason: "password expired"},
+		"data 533": {Code: "533", Reason: "account disabled"},
+		"data 701": {Code: "701", Reason: "account expired"},
+		"data 773": {Code: "773", Reason: "password must be reset"},
+		"data 775": {Code: "775", Reason: "account locked"},
+		"data 52E": {Code: "52e", Reason: "invalid credentials"},
+		"data 999": {Reason: "invalid credentials"},
+		"":         {Reason: "invalid credentials"},
+	}
+
+	for data, expected := range tests {
+		diagnostic := "80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, " + data + ", v3839"
+		binder := &mockBinder{err: ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New(diagnostic))}
+
+		err := authenticate(binder, "CN=dave,DC=com", "letmein")
+
+		var authErr *AuthenticationError
+		if !errors.As(err, &authErr) || *authErr != expected {
+			t.Errorf("Expected %+v for %q, got: %v", expected, data, err)
+		}
+	}
+}
+
+func TestAuthenticateShouldReturnOtherBindErrorsAsIs(t *testing.T) {
+	binder := &mockBinder{err: ldap.NewError(ldap.LDAPResultUnavailable, errors.New("server is unavailable"))}
+
+	err := authenticate(binder, "CN=dave,DC=com", "letmein")
+
+	var authErr *AuthenticationError
+	if err == nil || errors.As(err, &authErr) {
+		t.Errorf("Expected a bind error that is not an authentication error, got: %v", err)
+	}
+}
+
+func TestAuthenticationErrorShouldNotContainThePassword(t *testing.T) {
+	binder := &mockBinder{err: ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("data 52e"))}
+
+	err := authenticate(binder, "CN=dave,DC=com", "s3cr3t")
+
+	if err.Error() != "Authentication failed: invalid credentials" {
+		t.Errorf("Error message is wrong: %s", err.Error())
+	}
+	if binder.username != "CN=dave,DC=com" || binder.password != "s3cr3t" {
+		t.Errorf("Bind was not as the user: %s", binder.username)
+	}
+}
+
+type mockBinder struct {
+	username, password string
+	err                error
+}
+
+func (b *mockBinder) Bind(username, password string) error {
+	b.username, b.password = username, password
+	return b.err
+}
@@ -17,64 +17,264 @@ limitations under the License.
 package ldap
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"gopkg.in/ldap.v2"
+	"net"
+	"time"
 )
 
+// Client hands out connections to the directory. It is safe for concurrent use, each caller getting a connection
+// of its own. Operations given up on because their context is done return a *TimeoutError.
 type Client interface {
-	Connect() error
-	Search(sr SearchRequest) (*ldap.SearchResult, error)
+	// Connect returns a connection bound as the service account, for the caller's sole use until it closes it.
+	Connect(ctx context.Context) (Conn, error)
+	// Authenticate checks a user's password by binding as the user, returning an *AuthenticationError if the
+	// directory rejects it.
+	Authenticate(ctx context.Context, userDN, password string) error
+	// Close releases any connections the client holds on to, e.g. idle pooled connections.
+	Close()
+}
+
+type Conn interface {
+	// Search returns every entry found, a page at a time if the request has a PageSize.
+	Search(ctx context.Context, sr SearchRequest) (*ldap.SearchResult, error)
+	// SearchPaged calls handle with each entry found as its page arrives, rather than holding on to them all,
+	// stopping at the first error handle returns.
+	SearchPaged(ctx context.Context, sr SearchRequest, handle func(*ldap.Entry) error) error
+	// Modify changes the attributes of an entry, e.g. the members of a group.
+	Modify(ctx context.Context, mr *ldap.ModifyRequest) error
 	Close()
 }
 
 type ldapClient struct {
-	bindUsername  string
-	bindPassword  string
-	ldapServerUrl string
+	credentials Credentials
+	servers     *serverSet
+	startTLS    bool
+	timeouts    TimeoutOptions
+}
+
+type connection struct {
 	ldapSearcher  ldapSearcher
+	searchTimeout time.Duration
 }
 
 type SearchRequest struct {
 	Attributes    []string // i.e. the attributes to be returned by the group, e.g. 'memberOf'
 	BaseDn        string
+	Scope         Scope
 	SearchFilter  string
 	SearchTimeout int
+	PageSize      int // entries per page of a paged search (RFC 2696), 0 means the search is not paged
+}
+
+// NoAttributes is the attribute to ask for when none are needed, only the DNs of the entries found (RFC 4511), as
+// asking for no attributes at all returns every one.
+const NoAttributes = "1.1"
+
+type Scope int
+
+const (
+	ScopeWholeSubtree Scope = iota // the base DN and everything below it, the default
+	ScopeBaseObject                // only the base DN itself
+	ScopeSingleLevel               // only the immediate children of the base DN
+)
+
+var ldapScopes = map[Scope]int{
+	ScopeWholeSubtree: ldap.ScopeWholeSubtree,
+	ScopeBaseObject:   ldap.ScopeBaseObject,
+	ScopeSingleLevel:  ldap.ScopeSingleLevel,
 }
 
 type ldapSearcher interface {
 	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Modify(modifyRequest *ldap.ModifyRequest) error
 	Close()
 }
 
-func NewClient(bindUsername, bindPassword, ldapServerUrl string) Client {
-	return &ldapClient{
-		bindUsername:  bindUsername,
-		bindPassword:  bindPassword,
-		ldapServerUrl: ldapServerUrl,
+type binder interface {
+	Bind(username, password string) error
+}
+
+// NewClient creates a client for the servers at ldapServerUrls, each either 'host:port', 'ldap://host[:port]' or
+// 'ldaps://host[:port]', binding with the service account's credentials. The TLS options are used for 'ldaps://'
+// urls and when StartTLS is requested. If a server cannot be connected to, or bound to, the next is tried, in the
+// order given by the failover options' strategy. Connecting, binding and searching are given up on after the
+// timeout options' deadlines, a connect timeout failing over to the next server.
+func NewClient(credentials Credentials, ldapServerUrls []string, tlsOptions TLSOptions, failoverOptions FailoverOptions, timeoutOptions TimeoutOptions) (Client, error) {
+	return newLdapClient(credentials, ldapServerUrls, tlsOptions, failoverOptions, timeoutOptions)
+}
+
+func newLdapClient(credentials Credentials, ldapServerUrls []string, tlsOptions TLSOptions, failoverOptions FailoverOptions, timeoutOptions TimeoutOptions) (*ldapClient, error) {
+	servers, err := newServerSet(ldapServerUrls, tlsOptions, failoverOptions)
+	if err != nil {
+		return nil, err
 	}
+
+	return &ldapClient{
+		credentials: credentials,
+		servers:     servers,
+		startTLS:    tlsOptions.StartTLS,
+		timeouts:    timeoutOptions,
+	}, nil
 }
 
-func (c *ldapClient) Connect() error {
-	ldapConn, err := ldap.Dial("tcp", c.ldapServerUrl)
+func (c *ldapClient) Connect(ctx context.Context) (Conn, error) {
+	ldapConn, err := c.connect(ctx)
 	if err != nil {
-		return fmt.Errorf("Cannot connect to LDAP: %v", err)
+		return nil, err
 	}
+	return &connection{ldapSearcher: ldapConn, searchTimeout: c.timeouts.Search}, nil
+}
+
+// Close is a no-op, the unpooled client holds no connections of its own.
+func (c *ldapClient) Close() {}
+
+// connect dials a server and binds as the service account, returning the connection ready for use. The next server
+// is tried if either fails.
+func (c *ldapClient) connect(ctx context.Context) (*ldap.Conn, error) {
+	return c.servers.try(ctx, func(s *server) (*ldap.Conn, error) {
+		ldapConn, err := c.openServer(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.bind(ctx, ldapConn); err != nil {
+			ldapConn.Close()
+			return nil, err
+		}
+
+		return ldapConn, nil
+	})
+}
 
-	err = ldapConn.Bind(c.bindUsername, c.bindPassword)
+// open dials a server and starts TLS if needed, returning the connection ready to be bound. The next server is
+// tried if either fails.
+func (c *ldapClient) open(ctx context.Context) (*ldap.Conn, error) {
+	return c.servers.try(ctx, func(s *server) (*ldap.Conn, error) {
+		return c.openServer(ctx, s)
+	})
+}
+
+func (c *ldapClient) openServer(ctx context.Context, s *server) (ldapConn *ldap.Conn, err error) {
+	start := time.Now()
+	defer func() { observe("connect", start, err) }()
+	ctx, cancel := withTimeout(ctx, c.timeouts.Connect)
+	defer cancel()
+
+	ldapConn, err = dial(ctx, s)
 	if err != nil {
-		ldapConn.Close()
-		return fmt.Errorf("Cannot bind to LDAP: %v", err)
+		return nil, fmt.Errorf("Cannot connect to LDAP: %w", err)
+	}
+
+	if c.startTLS {
+		err = withContext(ctx, "connect", ldapConn.Close, func() error {
+			return ldapConn.StartTLS(s.tlsConfig)
+		})
+		if err != nil {
+			ldapConn.Close()
+			return nil, fmt.Errorf("Cannot start TLS with LDAP: %w", err)
+		}
 	}
+	return ldapConn, nil
+}
 
-	c.ldapSearcher = ldapConn
+func (c *ldapClient) bind(ctx context.Context, ldapConn pooledConnection) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Bind)
+	defer cancel()
 
+	username, password := c.credentials.Get()
+	start := time.Now()
+	err := withContext(ctx, "bind", ldapConn.Close, func() error {
+		return ldapConn.Bind(username, password)
+	})
+	observe("bind", start, err)
+	if err != nil {
+		return fmt.Errorf("Cannot bind to LDAP: %w", err)
+	}
 	return nil
 }
 
-func (c *ldapClient) Search(sr SearchRequest) (*ldap.SearchResult, error) {
-	searchRequest := &ldap.SearchRequest{
+// dial connects to the server, completing the TLS handshake of an 'ldaps://' server, before ctx is done.
+func dial(ctx context.Context, s *server) (*ldap.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.address.address)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, &TimeoutError{Op: "connect", Err: ctx.Err()}
+		}
+		return nil, err
+	}
+
+	if s.address.isLDAPS() {
+		tlsConn := tls.Client(conn, s.tlsConfig)
+		err := withContext(ctx, "connect", func() { conn.Close() }, tlsConn.Handshake)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	ldapConn := ldap.NewConn(conn, s.address.isLDAPS())
+	ldapConn.Start()
+	return ldapConn, nil
+}
+
+func (c *connection) Search(ctx context.Context, sr SearchRequest) (*ldap.SearchResult, error) {
+	return search(ctx, c.ldapSearcher, sr, c.searchTimeout)
+}
+
+func (c *connection) SearchPaged(ctx context.Context, sr SearchRequest, handle func(*ldap.Entry) error) error {
+	return searchPaged(ctx, c.ldapSearcher, sr, c.searchTimeout, handle)
+}
+
+func search(ctx context.Context, ldapSearcher ldapSearcher, sr SearchRequest, timeout time.Duration) (*ldap.SearchResult, error) {
+	if sr.PageSize > 0 {
+		searchResults := &ldap.SearchResult{}
+		err := searchPaged(ctx, ldapSearcher, sr, timeout, func(entry *ldap.Entry) error {
+			searchResults.Entries = append(searchResults.Entries, entry)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return searchResults, nil
+	}
+
+	searchResults, err := searchOnce(ctx, ldapSearcher, newSearchRequest(sr), timeout)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP group error: %w", err)
+	}
+	return searchResults, nil
+}
+
+// searchOnce sends a single search request, closing the connection if it is not answered within timeout or before
+// ctx is done.
+func searchOnce(ctx context.Context, ldapSearcher ldapSearcher, searchRequest *ldap.SearchRequest, timeout time.Duration) (*ldap.SearchResult, error) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	var searchResults *ldap.SearchResult
+	start := time.Now()
+	err := withContext(ctx, "search", ldapSearcher.Close, func() error {
+		var err error
+		searchResults, err = ldapSearcher.Search(searchRequest)
+		return err
+	})
+	observe("search", start, err)
+	if err != nil {
+		return nil, err // searchResults may still be written to after a timeout
+	}
+	return searchResults, nil
+}
+
+func newSearchRequest(sr SearchRequest) *ldap.SearchRequest {
+	return &ldap.SearchRequest{
 		BaseDN:       sr.BaseDn,
-		Scope:        ldap.ScopeWholeSubtree,
+		Scope:        ldapScopes[sr.Scope],
 		DerefAliases: ldap.NeverDerefAliases,
 		SizeLimit:    0,
 		TimeLimit:    sr.SearchTimeout,
@@ -83,14 +283,36 @@ func (c *ldapClient) Search(sr SearchRequest) (*ldap.SearchResult, error) {
 		Attributes:   sr.Attributes,
 		Controls:     nil,
 	}
+}
+
+func (c *connection) Modify(ctx context.Context, mr *ldap.ModifyRequest) error {
+	return modify(ctx, c.ldapSearcher, mr, c.searchTimeout)
+}
+
+// modify sends a modify request, closing the connection if it is not answered within timeout or before ctx is done.
+func modify(ctx context.Context, ldapSearcher ldapSearcher, modifyRequest *ldap.ModifyRequest, timeout time.Duration) error {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
 
-	searchResults, err := c.ldapSearcher.Search(searchRequest)
+	start := time.Now()
+	err := withContext(ctx, "modify", ldapSearcher.Close, func() error {
+		return ldapSearcher.Modify(modifyRequest)
+	})
+	observe("modify", start, err)
 	if err != nil {
-		return nil, fmt.Errorf("LDAP group error: %v", err.Error())
+		return fmt.Errorf("LDAP modify error: %w", err)
 	}
-	return searchResults, nil
+	return nil
 }
 
-func (c *ldapClient) Close() {
+func (c *connection) Close() {
 	c.ldapSearcher.Close()
 }
+
+// isConnectionError reports whether err means the connection itself is broken, rather than the operation failing.
+// A connection is closed when an operation on it times out.
+func isConnectionError(err error) bool {
+	var ldapErr *ldap.Error
+	var timeoutErr *TimeoutError
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.ErrorNetwork || errors.As(err, &timeoutErr)
+}
@@ -17,19 +17,19 @@ limitations under the License.
 package ldap
 
 import (
+	"context"
 	"errors"
 	ldapserver "github.com/nmcclain/ldap"
 	"gopkg.in/ldap.v2"
-	"log"
 	"net"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 const (
-	ldapServerUrl         = "localhost:49456"
 	bindDistinguishedName = "cn=testy,dc=testers,dc=testz"
 	bindPassword          = "work123"
 	shouldBind            = ldapserver.LDAPResultSuccess
@@ -39,25 +39,24 @@ const (
 // test the connection
 
 func TestConnectShouldConnectToLDAPServer(t *testing.T) {
-	quit := make(chan bool)
-	startLdapServer(quit, shouldBind)
-	defer stopLdapServer(quit)
-	client := NewClient(bindDistinguishedName, bindPassword, ldapServerUrl)
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	client := newTestClient(t, testServer.url, TLSOptions{})
 
-	err := client.Connect()
-	defer client.Close()
+	conn, err := client.Connect(context.Background())
 
 	if err != nil {
 		t.Fatalf("Unexpected error: '%s'.", err.Error())
 	}
+	conn.Close()
 }
 
 func TestConnectShouldReturnErrorIfClientCannotConnectToLdap(t *testing.T) {
 	// note ldap test server not started
 
-	client := NewClient(bindDistinguishedName, bindPassword, ldapServerUrl)
+	client := newTestClient(t, unusedUrl(t), TLSOptions{})
 
-	err := client.Connect()
+	_, err := client.Connect(context.Background())
 
 	if err == nil {
 		t.Fatal("Should've returned error due to ldap connection failure.")
@@ -68,12 +67,11 @@ func TestConnectShouldReturnErrorIfClientCannotConnectToLdap(t *testing.T) {
 }
 
 func TestConnectShouldReturnErrorIfClientCannotBindToLdap(t *testing.T) {
-	quit := make(chan bool)
-	startLdapServer(quit, shouldNotBind)
-	defer stopLdapServer(quit)
-	client := NewClient(bindDistinguishedName, bindPassword, ldapServerUrl)
+	testServer := startLdapServer(t, shouldNotBind)
+	defer testServer.stop()
+	client := newTestClient(t, testServer.url, TLSOptions{})
 
-	err := client.Connect()
+	_, err := client.Connect(context.Background())
 
 	if err == nil {
 		t.Fatal("Should've returned error due to ldap bind failure.")
@@ -83,39 +81,68 @@ func TestConnectShouldReturnErrorIfClientCannotBindToLdap(t *testing.T) {
 	}
 }
 
-func startLdapServer(quit chan bool, br ldapserver.LDAPResultCode) {
-	go func() {
-		s := ldapserver.NewServer()
-		s.QuitChannel(quit)
+// testLdapServer is an LDAP server listening on a port of its own, so tests that run one after another never
+// contend for the same port.
+type testLdapServer struct {
+	url  string
+	quit chan bool
+	done chan error
+	once sync.Once
+}
 
-		s.BindFunc(bindDistinguishedName, bindResultOf(br))
+// startLdapServer starts a server, answering binds with br, on a free local port and waits until it accepts
+// connections.
+func startLdapServer(t *testing.T, br ldapserver.LDAPResultCode) *testLdapServer {
+	url := unusedUrl(t)
+	s := &testLdapServer{url: url, quit: make(chan bool), done: make(chan error, 1)}
+	go func() {
+		ls := ldapserver.NewServer()
+		ls.QuitChannel(s.quit)
+		ls.BindFunc(bindDistinguishedName, bindResultOf(br))
+		s.done <- ls.ListenAndServe(url)
+	}()
 
-		// start the server
-		log.Printf("Starting example LDAP server on %s", ldapServerUrl)
-		if err := s.ListenAndServe(ldapServerUrl); err != nil {
-			log.Fatalf("LDAP Server Failed: %s", err.Error())
+	for retries := 0; retries < 50; retries++ {
+		select {
+		case err := <-s.done:
+			t.Fatalf("LDAP Server Failed: %v", err)
+		default:
 		}
-	}()
+		if conn, err := net.DialTimeout("tcp", url, 2*time.Second); err == nil {
+			conn.Close()
+			return s
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s.stop()
+	t.Fatalf("LDAP Server never started listening on %s", url)
+	return nil
+}
 
-	waitForPort(5)
+// stop closes the server's listener and waits until it has, it's safe to call more than once.
+func (s *testLdapServer) stop() {
+	s.once.Do(func() {
+		close(s.quit)
+		<-s.done
+	})
 }
 
-func waitForPort(retries int) {
-	if retries < 0 {
-		return
-	}
-	conn, err := net.DialTimeout("tcp", ldapServerUrl, 2*time.Second)
+// unusedUrl returns the address of a free local port, which nothing listens on until a test starts a server on it.
+func unusedUrl(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		time.Sleep(1 * time.Second)
-		waitForPort(retries - 1)
-	}
-	if conn != nil {
-		defer conn.Close()
+		t.Fatalf("Could not find a free port: %s", err.Error())
 	}
+	defer ln.Close()
+	return ln.Addr().String()
 }
 
-func stopLdapServer(quit chan bool) {
-	quit <- true
+func newTestClient(t *testing.T, url string, tlsOptions TLSOptions) Client {
+	client, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{url}, tlsOptions, FailoverOptions{}, TimeoutOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: '%s'.", err.Error())
+	}
+	return client
 }
 
 type BinderFunc func(bindDN, bindSimplePw string, conn net.Conn) (ldapserver.LDAPResultCode, error)
@@ -135,17 +162,17 @@ func bindResultOf(br ldapserver.LDAPResultCode) BinderFunc {
 func TestSearchShouldCallLdapSearchWithCorrectParametersAndReturnSearchResults(t *testing.T) {
 	searchResultsToReturn := &ldap.SearchResult{
 		Entries: []*ldap.Entry{
-			{"cn=dave-jones,OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE,", []*ldap.EntryAttribute{
-				{"memberOf", []string{
+			{DN: "cn=dave-jones,OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE,", Attributes: []*ldap.EntryAttribute{
+				{Name: "memberOf", Values: []string{
 					"CN=London team,OU=Distribution Lists,DC=com",
-					"OU=Distribution Lists,cn=New York team,DC=com,DC=EDFR,DC=DFER,DC=com"}, nil},
-				{"uid", []string{"fsdf56sdf54fs645f"}, nil},
-				{"description", []string{"Something about Dave"}, nil},
+					"OU=Distribution Lists,cn=New York team,DC=com,DC=EDFR,DC=DFER,DC=com"}},
+				{Name: "uid", Values: []string{"fsdf56sdf54fs645f"}},
+				{Name: "description", Values: []string{"Something about Dave"}},
 			}},
 		},
 	}
 	ldapSearcher := &mockSearcher{returnedSearchResults: searchResultsToReturn}
-	client := ldapClient{ldapSearcher: ldapSearcher}
+	conn := connection{ldapSearcher: ldapSearcher}
 	searchRequest := SearchRequest{
 		Attributes:    []string{"memberOf"},
 		BaseDn:        "OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE",
@@ -153,7 +180,7 @@ func TestSearchShouldCallLdapSearchWithCorrectParametersAndReturnSearchResults(t
 		SearchTimeout: 20,
 	}
 
-	results, err := client.Search(searchRequest)
+	results, err := conn.Search(context.Background(), searchRequest)
 
 	if err != nil {
 		t.Fatal(err)
@@ -164,6 +191,9 @@ func TestSearchShouldCallLdapSearchWithCorrectParametersAndReturnSearchResults(t
 	if ldapSearcher.searchRequest.BaseDN != searchRequest.BaseDn {
 		t.Errorf("BaseDn passed to the LDAP group is incorrect. Expected: '%s', actual: '%s'.", searchRequest.BaseDn, ldapSearcher.searchRequest.BaseDN)
 	}
+	if ldapSearcher.searchRequest.Scope != ldap.ScopeWholeSubtree {
+		t.Errorf("Scope passed to the LDAP group is incorrect. Expected: '%d', actual: '%d'.", ldap.ScopeWholeSubtree, ldapSearcher.searchRequest.Scope)
+	}
 	if ldapSearcher.searchRequest.TimeLimit != searchRequest.SearchTimeout {
 		t.Errorf("Search timeout passed to the LDAP group is incorrect. Expected: '%d', actual: '%d'.", searchRequest.SearchTimeout, ldapSearcher.searchRequest.TimeLimit)
 	}
@@ -175,8 +205,19 @@ func TestSearchShouldCallLdapSearchWithCorrectParametersAndReturnSearchResults(t
 	}
 }
 
+func TestSearchShouldPassBaseObjectScope(t *testing.T) {
+	ldapSearcher := &mockSearcher{returnedSearchResults: &ldap.SearchResult{}}
+	conn := connection{ldapSearcher: ldapSearcher}
+
+	conn.Search(context.Background(), SearchRequest{BaseDn: "CN=London team,OU=Distribution Lists,DC=com", Scope: ScopeBaseObject, SearchFilter: "(objectClass=*)"})
+
+	if ldapSearcher.searchRequest.Scope != ldap.ScopeBaseObject {
+		t.Errorf("Scope passed to the LDAP group is incorrect. Expected: '%d', actual: '%d'.", ldap.ScopeBaseObject, ldapSearcher.searchRequest.Scope)
+	}
+}
+
 func TestShouldReturnErrorIfSearchProblem(t *testing.T) {
-	client := ldapClient{ldapSearcher: &mockSearcher{shouldReturnError: true}}
+	conn := connection{ldapSearcher: &mockSearcher{shouldReturnError: true}}
 	searchRequest := SearchRequest{
 		Attributes:    []string{"memberOf"},
 		BaseDn:        "OU=User Policies,OU=All Users,DC=FAE,DC=CORPORATE",
@@ -184,7 +225,7 @@ func TestShouldReturnErrorIfSearchProblem(t *testing.T) {
 		SearchTimeout: 20,
 	}
 
-	_, err := client.Search(searchRequest)
+	_, err := conn.Search(context.Background(), searchRequest)
 
 	if err == nil {
 		t.Fatal("Should've returned error due to ldap group failure.")
@@ -194,11 +235,35 @@ func TestShouldReturnErrorIfSearchProblem(t *testing.T) {
 	}
 }
 
+func TestModifyShouldSendModifyRequest(t *testing.T) {
+	ldapSearcher := &mockSearcher{}
+	conn := connection{ldapSearcher: ldapSearcher}
+	modifyRequest := ldap.NewModifyRequest("CN=London team,OU=Groups,DC=com")
+	modifyRequest.Add("member", []string{"CN=Dave Jones,OU=Users,DC=com"})
+
+	if err := conn.Modify(context.Background(), modifyRequest); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if ldapSearcher.modifyRequest != modifyRequest {
+		t.Errorf("Modify request passed to LDAP is wrong: %+v", ldapSearcher.modifyRequest)
+	}
+}
+
+func TestShouldReturnErrorIfModifyProblem(t *testing.T) {
+	conn := connection{ldapSearcher: &mockSearcher{shouldReturnError: true}}
+
+	err := conn.Modify(context.Background(), ldap.NewModifyRequest("CN=London team,OU=Groups,DC=com"))
+
+	if err == nil || err.Error() != "LDAP modify error: Some error" {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
 func TestCloseShouldCallCloseMethodOnTheLdapSearcher(t *testing.T) {
 	mockSearcher := &mockSearcher{}
-	client := ldapClient{ldapSearcher: mockSearcher}
+	conn := connection{ldapSearcher: mockSearcher}
 
-	client.Close()
+	conn.Close()
 
 	if !mockSearcher.isClosed {
 		t.Error("Close method not called!")
@@ -209,6 +274,7 @@ type mockSearcher struct {
 	isClosed              bool
 	searchRequest         *ldap.SearchRequest
 	returnedSearchResults *ldap.SearchResult
+	modifyRequest         *ldap.ModifyRequest
 	shouldReturnError     bool
 }
 
@@ -220,6 +286,14 @@ func (s *mockSearcher) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchRe
 	return s.returnedSearchResults, nil
 }
 
+func (s *mockSearcher) Modify(modifyRequest *ldap.ModifyRequest) error {
+	s.modifyRequest = modifyRequest
+	if s.shouldReturnError {
+		return errors.New("Some error")
+	}
+	return nil
+}
+
 func (s *mockSearcher) Close() {
 	s.isClosed = true
 }
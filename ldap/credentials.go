@@ -0,0 +1,43 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+// Credentials supply the username and password the service account binds with. They are asked for on every bind, so
+// they can change while the client is in use, e.g. when the password is rotated.
+type Credentials interface {
+	Get() (username, password string)
+}
+
+type bindCredentials struct {
+	username string
+	password string
+}
+
+// StaticCredentials returns credentials that never change.
+func StaticCredentials(username, password string) Credentials {
+	return bindCredentials{username: username, password: password}
+}
+
+func (c bindCredentials) Get() (string, string) {
+	return c.username, c.password
+}
+
+// current returns the credentials c supplies right now, in a form that can be compared with those supplied later.
+func current(c Credentials) bindCredentials {
+	username, password := c.Get()
+	return bindCredentials{username: username, password: password}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"gopkg.in/ldap.v2"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The orders the servers are tried in.
+const (
+	StrategyFailover   = "failover"    // in the order they are listed, so the first server takes all the load
+	StrategyRoundRobin = "round-robin" // starting with the next server each time, spreading the load
+	StrategyRandom     = "random"      // in a random order each time, spreading the load
+)
+
+type FailoverOptions struct {
+	Strategy         string        // the order the servers are tried in, StrategyFailover if empty
+	FailureThreshold int           // consecutive server failures after which a server is skipped. 0 means never
+	RetryAfter       time.Duration // how long a server is skipped for before it is tried again
+	Resolver         Resolver      // looks up the servers of 'ldap-srv://' urls, net.DefaultResolver if nil
+	SRVCacheTTL      time.Duration // how long looked up servers are used for before they are looked up again
+}
+
+var errNoServerAvailable = errors.New("Cannot connect to LDAP: every server has failed repeatedly, retrying them later")
+
+// server is one of the servers a client connects to, with a circuit breaker that skips it while it is failing.
+type server struct {
+	address   serverAddress
+	tlsConfig *tls.Config // nil when the connection is not secured
+
+	mu        sync.Mutex
+	failures  int       // consecutive server failures, see isServerFailure
+	skipUntil time.Time // while the breaker is open
+}
+
+// target is an entry in the list of servers: either a server, or a domain whose servers are looked up.
+type target interface {
+	servers(ctx context.Context) ([]*server, error)
+}
+
+func (s *server) servers(context.Context) ([]*server, error) {
+	return []*server{s}, nil
+}
+
+type serverSet struct {
+	targets    []target
+	options    FailoverOptions
+	tlsOptions TLSOptions
+	next       uint32 // the server round robin starts with
+	now        func() time.Time
+	shuffle    func(n int, swap func(i, j int))
+	intn       func(n int) int
+
+	mu          sync.Mutex
+	known       map[serverAddress]*server // so looked up servers keep their breaker state between look ups
+	lastFailure error                     // the last server failure, reported while every server is skipped
+}
+
+func newServerSet(ldapServerUrls []string, tlsOptions TLSOptions, options FailoverOptions) (*serverSet, error) {
+	switch options.Strategy {
+	case "":
+		options.Strategy = StrategyFailover
+	case StrategyFailover, StrategyRoundRobin, StrategyRandom:
+	default:
+		return nil, fmt.Errorf("unknown LDAP server strategy %q, expected %q, %q or %q", options.Strategy, StrategyFailover, StrategyRoundRobin, StrategyRandom)
+	}
+	if len(ldapServerUrls) == 0 {
+		return nil, errors.New("no LDAP server url")
+	}
+	if options.Resolver == nil {
+		options.Resolver = net.DefaultResolver
+	}
+
+	s := &serverSet{
+		options:    options,
+		tlsOptions: tlsOptions,
+		now:        time.Now,
+		shuffle:    rand.Shuffle,
+		intn:       rand.Intn,
+		known:      map[serverAddress]*server{},
+	}
+	for _, u := range ldapServerUrls {
+		if domain, ok := srvDomain(u); ok {
+			t, err := newSRVTarget(domain, s)
+			if err != nil {
+				return nil, err
+			}
+			s.targets = append(s.targets, t)
+			continue
+		}
+
+		address, err := parseServerUrl(u)
+		if err != nil {
+			return nil, err
+		}
+		srv, err := s.serverFor(address)
+		if err != nil {
+			return nil, err
+		}
+		s.targets = append(s.targets, srv)
+	}
+	return s, nil
+}
+
+// serverFor returns the server at address, creating it the first time it is asked for.
+func (s *serverSet) serverFor(address serverAddress) (*server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if srv, ok := s.known[address]; ok {
+		return srv, nil
+	}
+	tlsConfig, err := s.tlsOptions.tlsConfigFor(address)
+	if err != nil {
+		return nil, err
+	}
+	srv := &server{address: address, tlsConfig: tlsConfig}
+	s.known[address] = srv
+	return srv, nil
+}
+
+// try calls connect with each server in turn, in the strategy's order and skipping servers whose breaker is open,
+// until it succeeds, recording each server's success or failure. Only server failures count against a server, not
+// e.g. a bind rejecting the credentials, which every server would. No more servers are tried once ctx is done, and
+// the failure that causes is not held against the server either.
+func (s *serverSet) try(ctx context.Context, connect func(*server) (*ldap.Conn, error)) (*ldap.Conn, error) {
+	servers, lastErr := s.list(ctx)
+	if len(servers) == 0 {
+		return nil, lastErr
+	}
+
+	tried := 0
+	for _, srv := range s.order(servers) {
+		if !srv.available(s.now()) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, &TimeoutError{Op: "connect", Err: err}
+		}
+		tried++
+		conn, err := connect(srv)
+		if err == nil {
+			srv.succeeded()
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err // the caller gave up, which says nothing about the server
+		}
+		if isServerFailure(err) {
+			srv.failed(s.now(), s.options)
+			s.recordFailure(err)
+		}
+		lastErr = err
+	}
+
+	switch tried {
+	case 0:
+		if err := s.lastServerFailure(); err != nil {
+			return nil, fmt.Errorf("%w, last error: %v", errNoServerAvailable, err)
+		}
+		return nil, errNoServerAvailable
+	case 1:
+		return nil, lastErr
+	default:
+		return nil, fmt.Errorf("%w, after trying %d servers", lastErr, tried)
+	}
+}
+
+// isServerFailure reports whether err means the server could not be reached, or could not serve the request, e.g.
+// a network error, a timeout or a busy or unavailable result, rather than the request itself being rejected.
+func isServerFailure(err error) bool {
+	var netErr net.Error
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		switch ldapErr.ResultCode {
+		case ldap.ErrorNetwork, ldap.LDAPResultBusy, ldap.LDAPResultUnavailable:
+			return true
+		}
+	}
+	return errors.As(err, &netErr) || isConnectionError(err)
+}
+
+func (s *serverSet) recordFailure(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastFailure = err
+}
+
+func (s *serverSet) lastServerFailure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastFailure
+}
+
+// list returns the servers of every target, in the order they are listed, looking up those of domains. The error
+// is the last look up error, if any.
+func (s *serverSet) list(ctx context.Context) ([]*server, error) {
+	var servers []*server
+	var lastErr error
+	for _, t := range s.targets {
+		targetServers, err := t.servers(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		servers = append(servers, targetServers...)
+	}
+	return servers, lastErr
+}
+
+// order returns the servers, in the order they are listed, in the order they should be tried.
+func (s *serverSet) order(listed []*server) []*server {
+	servers := make([]*server, len(listed))
+	switch s.options.Strategy {
+	case StrategyRoundRobin:
+		start := int(atomic.AddUint32(&s.next, 1)-1) % len(listed)
+		copy(servers, listed[start:])
+		copy(servers[len(listed)-start:], listed[:start])
+	case StrategyRandom:
+		copy(servers, listed)
+		s.shuffle(len(servers), func(i, j int) { servers[i], servers[j] = servers[j], servers[i] })
+	default:
+		copy(servers, listed)
+	}
+	return servers
+}
+
+// available reports whether the server's breaker is closed, or has been open for long enough that it should be
+// tried again.
+func (s *server) available(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !now.Before(s.skipUntil)
+}
+
+func (s *server) succeeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = 0
+	s.skipUntil = time.Time{}
+}
+
+// failed records a failure, opening the breaker once there have been FailureThreshold in a row. A server being
+// retried after RetryAfter is skipped again straight away if it fails.
+func (s *server) failed(now time.Time, options FailoverOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+	if options.FailureThreshold > 0 && s.failures >= options.FailureThreshold {
+		s.skipUntil = now.Add(options.RetryAfter)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gopkg.in/ldap.v2"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerSetShouldOrderServersByStrategy(t *testing.T) {
+	urls := []string{"dc1:389", "dc2:389", "dc3:389"}
+	tests := []struct {
+		strategy string
+		orders   [][]string
+	}{
+		{"", [][]string{{"dc1:389", "dc2:389", "dc3:389"}, {"dc1:389", "dc2:389", "dc3:389"}}},
+		{StrategyFailover, [][]string{{"dc1:389", "dc2:389", "dc3:389"}, {"dc1:389", "dc2:389", "dc3:389"}}},
+		{StrategyRoundRobin, [][]string{{"dc1:389", "dc2:389", "dc3:389"}, {"dc2:389", "dc3:389", "dc1:389"}, {"dc3:389", "dc1:389", "dc2:389"}, {"dc1:389", "dc2:389", "dc3:389"}}},
+		{StrategyRandom, [][]string{{"dc3:389", "dc2:389", "dc1:389"}}},
+	}
+
+	for _, test := range tests {
+		servers, err := newServerSet(urls, TLSOptions{}, FailoverOptions{Strategy: test.strategy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		servers.shuffle = func(n int, swap func(i, j int)) { swap(0, n-1) }
+
+		listed, _ := servers.list(context.Background())
+		for _, expected := range test.orders {
+			if order := addressesOf(servers.order(listed)); !reflect.DeepEqual(order, expected) {
+				t.Errorf("Order for %q strategy should be %v, is: %v", test.strategy, expected, order)
+			}
+		}
+	}
+}
+
+func TestNewServerSetShouldRejectUnknownStrategy(t *testing.T) {
+	_, err := newServerSet([]string{"dc1:389"}, TLSOptions{}, FailoverOptions{Strategy: "fastest"})
+
+	if err == nil || err.Error() != `unknown LDAP server strategy "fastest", expected "failover", "round-robin" or "random"` {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestNewServerSetShouldRejectNoServers(t *testing.T) {
+	_, err := newServerSet(nil, TLSOptions{}, FailoverOptions{})
+
+	if err == nil {
+		t.Error("Expected error!")
+	}
+}
+
+func TestServerSetShouldTryNextServerWhenOneFails(t *testing.T) {
+	servers := newTestServerSet(t, FailoverOptions{})
+	var tried []string
+
+	_, err := servers.try(context.Background(), func(s *server) (*ldap.Conn, error) {
+		tried = append(tried, s.address.address)
+		if s.address.address == "dc1:389" {
+			return nil, errors.New("Cannot connect to LDAP: meh")
+		}
+		return nil, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(tried, []string{"dc1:389", "dc2:389"}) {
+		t.Errorf("Servers tried are wrong: %v", tried)
+	}
+}
+
+func TestServerSetShouldReturnLastErrorWhenEveryServerFails(t *testing.T) {
+	servers := newTestServerSet(t, FailoverOptions{})
+
+	_, err := servers.try(context.Background(), func(s *server) (*ldap.Conn, error) {
+		return nil, errors.New("Cannot connect to " + s.address.address)
+	})
+
+	if err == nil || err.Error() != "Cannot connect to dc2:389, after trying 2 servers" {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestServerSetShouldSkipServerAfterRepeatedFailuresUntilRetryAfter(t *testing.T) {
+	servers := newTestServerSet(t, FailoverOptions{FailureThreshold: 2, RetryAfter: time.Minute})
+	clock := &mockClock{now: time.Now()}
+	servers.now = clock.Now
+	dc1Down := true
+	var tried []string
+	connect := func(s *server) (*ldap.Conn, error) {
+		tried = append(tried, s.address.address)
+		if dc1Down && s.address.address == "dc1:389" {
+			return nil, networkError()
+		}
+		return nil, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		servers.try(context.Background(), connect)
+	}
+	if !reflect.DeepEqual(tried, []string{"dc1:389", "dc2:389", "dc1:389", "dc2:389", "dc2:389"}) {
+		t.Errorf("Servers should be skipped after 2 failures, tried: %v", tried)
+	}
+
+	tried = nil
+	dc1Down = false
+	clock.advance(time.Minute)
+	servers.try(context.Background(), connect)
+	servers.try(context.Background(), connect)
+	if !reflect.DeepEqual(tried, []string{"dc1:389", "dc1:389"}) {
+		t.Errorf("Server should be tried again after a minute, tried: %v", tried)
+	}
+}
+
+func TestServerSetShouldReturnErrorWhenEveryServerIsSkipped(t *testing.T) {
+	servers := newTestServerSet(t, FailoverOptions{FailureThreshold: 1, RetryAfter: time.Minute})
+	failing := func(s *server) (*ldap.Conn, error) {
+		return nil, networkError()
+	}
+	servers.try(context.Background(), failing)
+
+	_, err := servers.try(context.Background(), failing)
+
+	expected := "Cannot connect to LDAP: every server has failed repeatedly, retrying them later, last error: Cannot connect to LDAP: LDAP Result Code 200 \"Network Error\": connection refused"
+	if !errors.Is(err, errNoServerAvailable) || err.Error() != expected {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestServerSetShouldNotCountFailuresThatAreNotTheServers(t *testing.T) {
+	servers := newTestServerSet(t, FailoverOptions{FailureThreshold: 1, RetryAfter: time.Minute})
+	var tried []string
+	rejected := func(s *server) (*ldap.Conn, error) {
+		tried = append(tried, s.address.address)
+		return nil, fmt.Errorf("Cannot bind to LDAP: %w", ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")))
+	}
+
+	servers.try(context.Background(), rejected)
+	_, err := servers.try(context.Background(), rejected)
+
+	if !reflect.DeepEqual(tried, []string{"dc1:389", "dc2:389", "dc1:389", "dc2:389"}) {
+		t.Errorf("Servers should not have been skipped, tried: %v", tried)
+	}
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) || ldapErr.ResultCode != ldap.LDAPResultInvalidCredentials {
+		t.Errorf("Error returned should be the bind error: %v", err)
+	}
+}
+
+func TestIsServerFailure(t *testing.T) {
+	tests := map[error]bool{
+		networkError(): true,
+		&TimeoutError{Op: "bind", Err: context.DeadlineExceeded}:                    true,
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}: true,
+		ldap.NewError(ldap.LDAPResultBusy, errors.New("busy")):                      true,
+		ldap.NewError(ldap.LDAPResultUnavailable, errors.New("unavailable")):        true,
+		ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("no")):          false,
+		errors.New("x509: certificate signed by unknown authority"):                 false,
+	}
+
+	for err, expected := range tests {
+		if isServerFailure(err) != expected {
+			t.Errorf("isServerFailure(%v) should be %v", err, expected)
+		}
+	}
+}
+
+func TestConnectShouldFailOverToNextServer(t *testing.T) {
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	client, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{unusedUrl(t), testServer.url}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	conn, err := client.Connect(context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	conn.Close()
+}
+
+func newTestServerSet(t *testing.T, options FailoverOptions) *serverSet {
+	servers, err := newServerSet([]string{"dc1:389", "dc2:389"}, TLSOptions{}, options)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return servers
+}
+
+func addressesOf(servers []*server) []string {
+	var addresses []string
+	for _, s := range servers {
+		addresses = append(addresses, s.address.address)
+	}
+	return addresses
+}
+
+func networkError() error {
+	return fmt.Errorf("Cannot connect to LDAP: %w", ldap.NewError(ldap.ErrorNetwork, errors.New("connection refused")))
+}
@@ -0,0 +1,46 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EscapeFilterValue escapes the characters that have a special meaning in a search filter assertion value (RFC 4515),
+// so user supplied input can only ever be matched literally.
+func EscapeFilterValue(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			sb.WriteString(fmt.Sprintf("\\%02x", c))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// ExpandFilter replaces every '{name}' placeholder in the filter template with the escaped value for name.
+func ExpandFilter(template string, values map[string]string) string {
+	oldnew := make([]string, 0, len(values)*2)
+	for name, value := range values {
+		oldnew = append(oldnew, "{"+name+"}", EscapeFilterValue(value))
+	}
+	return strings.NewReplacer(oldnew...).Replace(template)
+}
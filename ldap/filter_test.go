@@ -0,0 +1,54 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import "testing"
+
+func TestEscapeFilterValueShouldEscapeSpecialCharacters(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "dave-jones", expected: "dave-jones"},
+		{value: "*)(objectClass=*", expected: "\\2a\\29\\28objectClass=\\2a"},
+		{value: "back\\slash", expected: "back\\5cslash"},
+		{value: "nul\x00byte", expected: "nul\\00byte"},
+		{value: "Jürgen", expected: "Jürgen"},
+	}
+
+	for _, test := range tests {
+		if escaped := EscapeFilterValue(test.value); escaped != test.expected {
+			t.Errorf("Escaped value for %q is wrong. Expected: %q, actual: %q", test.value, test.expected, escaped)
+		}
+	}
+}
+
+func TestExpandFilterShouldReplaceEveryPlaceholderWithEscapedValue(t *testing.T) {
+	filter := ExpandFilter("(|(mailNickname={username})(sAMAccountName={username}))", map[string]string{"username": "*"})
+
+	if filter != "(|(mailNickname=\\2a)(sAMAccountName=\\2a))" {
+		t.Errorf("Expanded filter is wrong: %q", filter)
+	}
+}
+
+func TestExpandFilterShouldLeaveUnknownPlaceholders(t *testing.T) {
+	filter := ExpandFilter("(&(cn={group})(member={username}))", map[string]string{"username": "dave"})
+
+	if filter != "(&(cn={group})(member=dave))" {
+		t.Errorf("Expanded filter is wrong: %q", filter)
+	}
+}
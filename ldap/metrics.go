@@ -0,0 +1,65 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var (
+	operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "flyte_ldap",
+		Name:      "operation_duration_seconds",
+		Help:      "Time taken by LDAP operations: connecting to a server, binding and each search and modify request.",
+	}, []string{"operation", "outcome"})
+
+	poolConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "flyte_ldap",
+		Name:      "pool_connections",
+		Help:      "Pooled LDAP connections, either in use ('active') or waiting to be used ('idle').",
+	}, []string{"directory", "state"})
+
+	poolMaxActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "flyte_ldap",
+		Name:      "pool_max_active_connections",
+		Help:      "The most pooled LDAP connections that can be in use at once, 0 if there is no limit.",
+	}, []string{"directory"})
+)
+
+// observe records the duration of an operation started at start, and whether it succeeded, failed, timed out or, for
+// a user's bind, the user was rejected.
+func observe(operation string, start time.Time, err error) {
+	operationDuration.WithLabelValues(operation, outcomeOf(err)).Observe(time.Since(start).Seconds())
+}
+
+func outcomeOf(err error) string {
+	var timeoutErr *TimeoutError
+	var authErr *AuthenticationError
+	switch {
+	case err == nil:
+		return "success"
+	case errors.As(err, &timeoutErr):
+		return "timeout"
+	case errors.As(err, &authErr):
+		return "rejected"
+	default:
+		return "error"
+	}
+}
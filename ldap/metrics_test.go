@@ -0,0 +1,76 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+func TestOutcomeOfShouldTellTimeoutsAndRejectionsFromErrors(t *testing.T) {
+	tests := map[string]error{
+		"success":  nil,
+		"timeout":  &TimeoutError{Op: "search", Err: context.DeadlineExceeded},
+		"rejected": &AuthenticationError{Reason: invalidCredentials},
+		"error":    errors.New("Cannot connect to LDAP: meh"),
+	}
+
+	for expected, err := range tests {
+		if outcome := outcomeOf(err); outcome != expected {
+			t.Errorf("Outcome of %v should be %q, is: %q", err, expected, outcome)
+		}
+	}
+}
+
+func TestPooledClientShouldCountActiveAndIdleConnections(t *testing.T) {
+	active, idle := poolConnections.WithLabelValues("corp", "active"), poolConnections.WithLabelValues("corp", "idle")
+	activeBefore, idleBefore := testutil.ToFloat64(active), testutil.ToFloat64(idle)
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 2})
+	pool.directory = "corp"
+
+	first, _ := pool.Connect(context.Background())
+	second, _ := pool.Connect(context.Background())
+	first.Close()
+
+	if testutil.ToFloat64(active) != activeBefore+1 || testutil.ToFloat64(idle) != idleBefore+1 {
+		t.Errorf("Should count 1 active and 1 idle connection, counted: %v active, %v idle", testutil.ToFloat64(active)-activeBefore, testutil.ToFloat64(idle)-idleBefore)
+	}
+	second.Close()
+	pool.Close()
+	if testutil.ToFloat64(active) != activeBefore || testutil.ToFloat64(idle) != idleBefore {
+		t.Errorf("Should count no connections once closed, counted: %v active, %v idle", testutil.ToFloat64(active)-activeBefore, testutil.ToFloat64(idle)-idleBefore)
+	}
+}
+
+func TestNewPooledClientShouldSetMaxActiveConnectionsOfItsDirectory(t *testing.T) {
+	for _, directory := range []string{"corp", "partner", "corp"} {
+		pool, err := NewPooledClient(directory, StaticCredentials(bindDistinguishedName, bindPassword), []string{unusedUrl(t)}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{}, PoolOptions{MaxActive: 20})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		pool.Close()
+	}
+
+	for _, directory := range []string{"corp", "partner"} {
+		if maxActive := testutil.ToFloat64(poolMaxActive.WithLabelValues(directory)); maxActive != 20 {
+			t.Errorf("Max active connections of %s should be 20, is: %v", directory, maxActive)
+		}
+	}
+}
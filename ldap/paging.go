@@ -0,0 +1,76 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/ldap.v2"
+	"time"
+)
+
+// searchPaged searches a page at a time using the paged results control (RFC 2696), so searches finding more entries
+// than the server's size limit, e.g. Active Directory's 1000, return all of them rather than failing. handle is
+// called with each entry as its page arrives. If handle returns an error the search is abandoned and the error
+// returned. A search without a PageSize is done in one go, its entries passed to handle in the same way. Each page
+// is given timeout to arrive.
+func searchPaged(ctx context.Context, ldapSearcher ldapSearcher, sr SearchRequest, timeout time.Duration, handle func(*ldap.Entry) error) error {
+	searchRequest := newSearchRequest(sr)
+	var paging *ldap.ControlPaging
+	if sr.PageSize > 0 {
+		paging = ldap.NewControlPaging(uint32(sr.PageSize))
+		searchRequest.Controls = []ldap.Control{paging}
+	}
+
+	for {
+		searchResults, err := searchOnce(ctx, ldapSearcher, searchRequest, timeout)
+		if err != nil {
+			return fmt.Errorf("LDAP group error: %w", err)
+		}
+
+		cookie := nextPageCookie(searchResults)
+		for _, entry := range searchResults.Entries {
+			if err := handle(entry); err != nil {
+				if paging != nil && len(cookie) > 0 {
+					abandon(ctx, ldapSearcher, searchRequest, paging, cookie, timeout)
+				}
+				return err
+			}
+		}
+
+		if paging == nil || len(cookie) == 0 {
+			return nil
+		}
+		paging.SetCookie(cookie)
+	}
+}
+
+// nextPageCookie returns the cookie that asks for the next page, which is empty once the last page has been read.
+func nextPageCookie(searchResults *ldap.SearchResult) []byte {
+	control, ok := ldap.FindControl(searchResults.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+	if !ok {
+		return nil
+	}
+	return control.Cookie
+}
+
+// abandon tells the server the rest of the pages are not wanted, so it can free the search's resources.
+func abandon(ctx context.Context, ldapSearcher ldapSearcher, searchRequest *ldap.SearchRequest, paging *ldap.ControlPaging, cookie []byte, timeout time.Duration) {
+	paging.PagingSize = 0
+	paging.SetCookie(cookie)
+	searchOnce(ctx, ldapSearcher, searchRequest, timeout)
+}
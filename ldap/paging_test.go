@@ -0,0 +1,158 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gopkg.in/ldap.v2"
+	"reflect"
+	"testing"
+)
+
+func TestSearchShouldReadEveryPageWhenPaged(t *testing.T) {
+	ldapSearcher := &pagingSearcher{entries: 5}
+	conn := connection{ldapSearcher: ldapSearcher}
+
+	results, err := conn.Search(context.Background(), SearchRequest{BaseDn: "DC=com", SearchFilter: "(objectClass=user)", PageSize: 2})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if dns := dnsOf(results.Entries); !reflect.DeepEqual(dns, []string{"cn=0", "cn=1", "cn=2", "cn=3", "cn=4"}) {
+		t.Errorf("Entries are wrong: %v", dns)
+	}
+	if !reflect.DeepEqual(ldapSearcher.pageSizes, []uint32{2, 2, 2}) {
+		t.Errorf("Should've asked for 3 pages of 2, asked for: %v", ldapSearcher.pageSizes)
+	}
+}
+
+func TestSearchPagedShouldStreamEntriesAPageAtATime(t *testing.T) {
+	ldapSearcher := &pagingSearcher{entries: 4}
+	conn := connection{ldapSearcher: ldapSearcher}
+	var pagesReadBeforeEntry []int
+
+	err := conn.SearchPaged(context.Background(), SearchRequest{PageSize: 2}, func(entry *ldap.Entry) error {
+		pagesReadBeforeEntry = append(pagesReadBeforeEntry, len(ldapSearcher.pageSizes))
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(pagesReadBeforeEntry, []int{1, 1, 2, 2}) {
+		t.Errorf("Entries should be handled as each page arrives, pages read before each entry: %v", pagesReadBeforeEntry)
+	}
+}
+
+func TestSearchPagedShouldAbandonSearchWhenHandlerFails(t *testing.T) {
+	ldapSearcher := &pagingSearcher{entries: 6}
+	conn := connection{ldapSearcher: ldapSearcher}
+
+	err := conn.SearchPaged(context.Background(), SearchRequest{PageSize: 2}, func(entry *ldap.Entry) error {
+		if entry.DN == "cn=2" {
+			return errors.New("enough")
+		}
+		return nil
+	})
+
+	if err == nil || err.Error() != "enough" {
+		t.Fatalf("Error returned is wrong: %v", err)
+	}
+	if !reflect.DeepEqual(ldapSearcher.pageSizes, []uint32{2, 2, 0}) {
+		t.Errorf("Should've abandoned the search with a page size of 0, asked for: %v", ldapSearcher.pageSizes)
+	}
+}
+
+func TestSearchPagedShouldSearchInOneGoWithoutPageSize(t *testing.T) {
+	ldapSearcher := &mockSearcher{returnedSearchResults: &ldap.SearchResult{Entries: []*ldap.Entry{{DN: "cn=0"}, {DN: "cn=1"}}}}
+	conn := connection{ldapSearcher: ldapSearcher}
+	var entries []*ldap.Entry
+
+	err := conn.SearchPaged(context.Background(), SearchRequest{}, func(entry *ldap.Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if dns := dnsOf(entries); !reflect.DeepEqual(dns, []string{"cn=0", "cn=1"}) {
+		t.Errorf("Entries are wrong: %v", dns)
+	}
+	if len(ldapSearcher.searchRequest.Controls) != 0 {
+		t.Errorf("No controls should have been sent: %v", ldapSearcher.searchRequest.Controls)
+	}
+}
+
+func TestSearchPagedShouldReturnSearchError(t *testing.T) {
+	conn := connection{ldapSearcher: &mockSearcher{shouldReturnError: true}}
+
+	err := conn.SearchPaged(context.Background(), SearchRequest{PageSize: 2}, func(entry *ldap.Entry) error { return nil })
+
+	if err == nil || err.Error() != "LDAP group error: Some error" {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+// pagingSearcher returns entries 'cn=0' to 'cn=<entries-1>' a page at a time, the cookie being the next entry.
+type pagingSearcher struct {
+	entries   int
+	pageSizes []uint32
+}
+
+func (s *pagingSearcher) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	paging := ldap.FindControl(searchRequest.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+	s.pageSizes = append(s.pageSizes, paging.PagingSize)
+	if paging.PagingSize == 0 {
+		return &ldap.SearchResult{}, nil
+	}
+
+	start := 0
+	if len(paging.Cookie) > 0 {
+		fmt.Sscan(string(paging.Cookie), &start)
+	}
+	end := start + int(paging.PagingSize)
+	if end > s.entries {
+		end = s.entries
+	}
+	results := &ldap.SearchResult{}
+	for i := start; i < end; i++ {
+		results.Entries = append(results.Entries, &ldap.Entry{DN: fmt.Sprintf("cn=%d", i)})
+	}
+	next := ldap.NewControlPaging(paging.PagingSize)
+	if end < s.entries {
+		next.SetCookie([]byte(fmt.Sprint(end)))
+	}
+	results.Controls = []ldap.Control{next}
+	return results, nil
+}
+
+func (s *pagingSearcher) Modify(modifyRequest *ldap.ModifyRequest) error {
+	return nil
+}
+
+func (s *pagingSearcher) Close() {}
+
+func dnsOf(entries []*ldap.Entry) []string {
+	var dns []string
+	for _, entry := range entries {
+		dns = append(dns, entry.DN)
+	}
+	return dns
+}
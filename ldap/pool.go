@@ -0,0 +1,353 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/HotelsDotCom/go-logger"
+	"gopkg.in/ldap.v2"
+	"sync"
+	"time"
+)
+
+type PoolOptions struct {
+	MinIdle                  int           // connections kept open and bound, ready for the next search
+	MaxIdle                  int           // idle connections beyond this are closed when returned to the pool
+	MaxActive                int           // connections in use at once, further searches wait for one. 0 means no limit
+	MaxLifetime              time.Duration // connections older than this are closed rather than reused. 0 means no limit
+	BindRevalidationInterval time.Duration // idle connections not bound within this are re-bound on checkout. 0 means never
+}
+
+type pooledConnection interface {
+	ldapSearcher
+	binder
+}
+
+type pooledConn struct {
+	pooledConnection
+	createdAt time.Time
+	boundAt   time.Time
+	boundAs   bindCredentials // the service account credentials of the last bind
+}
+
+type pooledClient struct {
+	options       PoolOptions
+	connect       func(context.Context) (pooledConnection, error)          // dials and binds a new connection
+	bind          func(context.Context, pooledConnection) error            // re-binds an existing connection
+	authenticate  func(ctx context.Context, userDN, password string) error // binds as a user on a connection outside the pool
+	credentials   func() bindCredentials                                   // the credentials connect and bind currently use
+	searchTimeout time.Duration                                            // the deadline of each search on a pooled connection, and of its health check
+	now           func() time.Time
+	active        chan struct{} // a slot per connection in use, nil if MaxActive is 0
+	directory     string        // labels the pool's metrics
+
+	mu      sync.Mutex
+	idle    []*pooledConn // most recently returned last
+	filling bool
+	closed  bool
+}
+
+// pooledHandle is the Conn handed out by the pool, closing it returns the connection to the pool.
+type pooledHandle struct {
+	pool   *pooledClient
+	conn   *pooledConn
+	broken bool
+	once   sync.Once
+}
+
+var (
+	errConnectionExpired = errors.New("connection has reached its maximum lifetime")
+	errPoolClosed        = errors.New("Cannot connect to LDAP: connection pool is closed")
+)
+
+// NewPooledClient creates a client that keeps bound connections open between searches rather than dialing and
+// binding for every one, see NewClient for the credentials, urls, TLS, failover and timeout options. Idle connections
+// are re-bound before use if the credentials have changed since they were bound, connections in use are left alone.
+// The pool's metrics are labelled with the directory it connects to.
+func NewPooledClient(directory string, credentials Credentials, ldapServerUrls []string, tlsOptions TLSOptions, failoverOptions FailoverOptions, timeoutOptions TimeoutOptions, poolOptions PoolOptions) (Client, error) {
+	c, err := newLdapClient(credentials, ldapServerUrls, tlsOptions, failoverOptions, timeoutOptions)
+	if err != nil {
+		return nil, err
+	}
+	if poolOptions.MaxIdle < poolOptions.MinIdle {
+		return nil, fmt.Errorf("pool max idle (%d) cannot be less than min idle (%d)", poolOptions.MaxIdle, poolOptions.MinIdle)
+	}
+
+	connect := func(ctx context.Context) (pooledConnection, error) {
+		conn, err := c.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+	p := newPooledClient(connect, c.bind, poolOptions)
+	p.authenticate = c.Authenticate
+	p.credentials = func() bindCredentials { return current(c.credentials) }
+	p.searchTimeout = timeoutOptions.Search
+	p.directory = directory
+	poolMaxActive.WithLabelValues(directory).Set(float64(poolOptions.MaxActive))
+	return p, nil
+}
+
+func newPooledClient(connect func(context.Context) (pooledConnection, error), bind func(context.Context, pooledConnection) error, options PoolOptions) *pooledClient {
+	p := &pooledClient{
+		options:     options,
+		connect:     connect,
+		bind:        bind,
+		credentials: func() bindCredentials { return bindCredentials{} },
+		now:         time.Now,
+	}
+	if options.MaxActive > 0 {
+		p.active = make(chan struct{}, options.MaxActive)
+	}
+	return p
+}
+
+// Connect checks a connection out of the pool, which is returned to it when the Conn is closed. The pool is topped
+// back up to MinIdle connections in the background, logging why if it can't be.
+func (p *pooledClient) Connect(ctx context.Context) (Conn, error) {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.options.MinIdle > 0 {
+		go func() {
+			if err := p.fill(); err != nil {
+				logger.Errorf("Cannot keep %d idle LDAP connections open for directory %q: %v", p.options.MinIdle, p.directory, err)
+			}
+		}()
+	}
+	poolConnections.WithLabelValues(p.directory, "active").Inc()
+	return &pooledHandle{pool: p, conn: conn}, nil
+}
+
+// Authenticate binds as the user on a new connection rather than a pooled one, so the pooled connections stay bound
+// as the service account.
+func (p *pooledClient) Authenticate(ctx context.Context, userDN, password string) error {
+	return p.authenticate(ctx, userDN, password)
+}
+
+// Close closes the idle connections, connections in use are closed as they are returned.
+func (p *pooledClient) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+	poolConnections.WithLabelValues(p.directory, "idle").Sub(float64(len(idle)))
+
+	for _, conn := range idle {
+		conn.Close()
+	}
+}
+
+func (h *pooledHandle) Search(ctx context.Context, sr SearchRequest) (*ldap.SearchResult, error) {
+	searchResults, err := search(ctx, h.conn, sr, h.pool.searchTimeout)
+	if isConnectionError(err) {
+		h.broken = true
+	}
+	return searchResults, err
+}
+
+func (h *pooledHandle) SearchPaged(ctx context.Context, sr SearchRequest, handle func(*ldap.Entry) error) error {
+	err := searchPaged(ctx, h.conn, sr, h.pool.searchTimeout, handle)
+	if isConnectionError(err) {
+		h.broken = true
+	}
+	return err
+}
+
+func (h *pooledHandle) Modify(ctx context.Context, mr *ldap.ModifyRequest) error {
+	err := modify(ctx, h.conn, mr, h.pool.searchTimeout)
+	if isConnectionError(err) {
+		h.broken = true
+	}
+	return err
+}
+
+func (h *pooledHandle) Close() {
+	h.once.Do(func() {
+		poolConnections.WithLabelValues(h.pool.directory, "active").Dec()
+		h.pool.put(h.conn, !h.broken)
+	})
+}
+
+// get checks out a healthy connection, reusing an idle one where possible, waiting if MaxActive connections are
+// already in use, until ctx is done.
+func (p *pooledClient) get(ctx context.Context) (*pooledConn, error) {
+	if p.active != nil {
+		select {
+		case p.active <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Cannot connect to LDAP: %w", &TimeoutError{Op: "connect", Err: ctx.Err()})
+		}
+	}
+	if p.isClosed() {
+		p.release()
+		return nil, errPoolClosed
+	}
+
+	for conn := p.popIdle(); conn != nil; conn = p.popIdle() {
+		if ctx.Err() != nil {
+			p.put(conn, true) // rather than closing healthy idle connections that cannot be validated in time
+			return nil, fmt.Errorf("Cannot connect to LDAP: %w", &TimeoutError{Op: "connect", Err: ctx.Err()})
+		}
+		if err := p.validate(ctx, conn); err != nil {
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+
+	conn, err := p.open(ctx)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// put returns a connection checked out by get, closing it rather than keeping it if it is no longer reusable.
+func (p *pooledClient) put(conn *pooledConn, reusable bool) {
+	defer p.release()
+
+	if !reusable || p.expired(conn) {
+		conn.Close()
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= p.options.MaxIdle {
+		p.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.idle = append(p.idle, conn)
+	p.mu.Unlock()
+	poolConnections.WithLabelValues(p.directory, "idle").Inc()
+}
+
+func (p *pooledClient) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func (p *pooledClient) release() {
+	if p.active != nil {
+		<-p.active
+	}
+}
+
+func (p *pooledClient) open(ctx context.Context) (*pooledConn, error) {
+	boundAs := p.credentials() // before connecting, so a change while connecting is picked up on the next checkout
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := p.now()
+	return &pooledConn{pooledConnection: conn, createdAt: now, boundAt: now, boundAs: boundAs}, nil
+}
+
+func (p *pooledClient) popIdle() *pooledConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) == 0 {
+		return nil
+	}
+	conn := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	poolConnections.WithLabelValues(p.directory, "idle").Dec()
+	return conn
+}
+
+// validate checks an idle connection is still fit for use: it has not outlived MaxLifetime, its bind is still
+// accepted if it is due re-validation or the credentials have changed, and otherwise the server still answers on it.
+func (p *pooledClient) validate(ctx context.Context, conn *pooledConn) error {
+	if p.expired(conn) {
+		return errConnectionExpired
+	}
+	boundAs := p.credentials()
+	if boundAs != conn.boundAs || p.options.BindRevalidationInterval > 0 && p.now().Sub(conn.boundAt) >= p.options.BindRevalidationInterval {
+		if err := p.bind(ctx, conn); err != nil {
+			return err
+		}
+		conn.boundAt = p.now()
+		conn.boundAs = boundAs
+		return nil
+	}
+	return healthCheck(ctx, conn, p.searchTimeout)
+}
+
+func (p *pooledClient) expired(conn *pooledConn) bool {
+	return p.options.MaxLifetime > 0 && p.now().Sub(conn.createdAt) >= p.options.MaxLifetime
+}
+
+// fill opens connections until MinIdle are idle, returning the first error encountered.
+func (p *pooledClient) fill() error {
+	p.mu.Lock()
+	if p.filling {
+		p.mu.Unlock()
+		return nil
+	}
+	p.filling = true
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.filling = false
+		p.mu.Unlock()
+	}()
+
+	for {
+		p.mu.Lock()
+		needed := !p.closed && len(p.idle) < p.options.MinIdle
+		p.mu.Unlock()
+		if !needed {
+			return nil
+		}
+
+		conn, err := p.open(context.Background())
+		if err != nil {
+			return err
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		p.idle = append([]*pooledConn{conn}, p.idle...) // least recently used, so warm connections go first
+		p.mu.Unlock()
+		poolConnections.WithLabelValues(p.directory, "idle").Inc()
+	}
+}
+
+// healthCheck reads the root DSE, which every server allows, to check the connection is still alive.
+func healthCheck(ctx context.Context, conn ldapSearcher, timeout time.Duration) error {
+	_, err := searchOnce(ctx, conn, &ldap.SearchRequest{
+		BaseDN:       "",
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{NoAttributes},
+	}, timeout)
+	return err
+}
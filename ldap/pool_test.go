@@ -0,0 +1,409 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/ldap.v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPooledClientShouldReuseConnectionBetweenSearches(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 2})
+
+	searchTwice(t, pool)
+
+	if dialer.dialled() != 1 {
+		t.Errorf("Should've dialled once, dialled: %d", dialer.dialled())
+	}
+	if dialer.connections[0].searches != 3 {
+		t.Errorf("Connection should've been used for 2 searches and 1 health check, used for: %d", dialer.connections[0].searches)
+	}
+}
+
+func TestPooledClientShouldCloseConnectionsBeyondMaxIdle(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1})
+
+	first, _ := pool.get(context.Background())
+	second, _ := pool.get(context.Background())
+	pool.put(first, true)
+	pool.put(second, true)
+
+	if dialer.dialled() != 2 {
+		t.Fatalf("Should've dialled twice, dialled: %d", dialer.dialled())
+	}
+	if dialer.connections[0].isClosed || !dialer.connections[1].isClosed {
+		t.Errorf("Only the second connection should have been closed")
+	}
+}
+
+func TestPooledClientShouldCloseConnectionsOlderThanMaxLifetime(t *testing.T) {
+	dialer := &mockDialer{}
+	clock := &mockClock{now: time.Now()}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1, MaxLifetime: time.Minute})
+	pool.now = clock.Now
+
+	searchWith(t, pool)
+	clock.advance(time.Minute)
+	searchWith(t, pool)
+
+	if dialer.dialled() != 2 {
+		t.Fatalf("Should've dialled twice, dialled: %d", dialer.dialled())
+	}
+	if !dialer.connections[0].isClosed {
+		t.Error("Expired connection should have been closed")
+	}
+}
+
+func TestPooledClientShouldRevalidateBindOfIdleConnections(t *testing.T) {
+	dialer := &mockDialer{}
+	clock := &mockClock{now: time.Now()}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1, BindRevalidationInterval: time.Minute})
+	pool.now = clock.Now
+
+	searchWith(t, pool)
+	clock.advance(time.Minute)
+	searchWith(t, pool)
+
+	if dialer.dialled() != 1 {
+		t.Fatalf("Should've dialled once, dialled: %d", dialer.dialled())
+	}
+	if dialer.connections[0].binds != 1 {
+		t.Errorf("Connection should've been re-bound once, re-bound: %d", dialer.connections[0].binds)
+	}
+}
+
+func TestPooledClientShouldRebindIdleConnectionsWhenCredentialsChange(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1})
+	password := "old password"
+	pool.credentials = func() bindCredentials { return bindCredentials{username: bindDistinguishedName, password: password} }
+
+	conn, err := pool.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	password = "new password"
+	conn.Close()
+	searchTwice(t, pool)
+
+	if dialer.dialled() != 1 {
+		t.Fatalf("Should've dialled once, dialled: %d", dialer.dialled())
+	}
+	if dialer.connections[0].binds != 1 {
+		t.Errorf("Connection should've been re-bound once, re-bound: %d", dialer.connections[0].binds)
+	}
+}
+
+func TestPooledClientShouldDiscardConnectionWhenBindRevalidationFails(t *testing.T) {
+	dialer := &mockDialer{}
+	clock := &mockClock{now: time.Now()}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1, BindRevalidationInterval: time.Minute})
+	pool.now = clock.Now
+
+	searchWith(t, pool)
+	dialer.connections[0].bindError = errors.New("invalid credentials")
+	clock.advance(time.Minute)
+	searchWith(t, pool)
+
+	if dialer.dialled() != 2 {
+		t.Fatalf("Should've dialled twice, dialled: %d", dialer.dialled())
+	}
+	if !dialer.connections[0].isClosed {
+		t.Error("Connection failing bind re-validation should have been closed")
+	}
+}
+
+func TestPooledClientShouldDiscardIdleConnectionsFailingHealthCheck(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1})
+
+	searchWith(t, pool)
+	dialer.connections[0].searchError = ldap.NewError(ldap.ErrorNetwork, errors.New("connection reset"))
+	searchWith(t, pool)
+
+	if dialer.dialled() != 2 {
+		t.Fatalf("Should've dialled twice, dialled: %d", dialer.dialled())
+	}
+	if !dialer.connections[0].isClosed {
+		t.Error("Unhealthy connection should have been closed")
+	}
+}
+
+func TestPooledClientShouldNotReturnBrokenConnectionsToThePool(t *testing.T) {
+	dialer := &mockDialer{searchError: ldap.NewError(ldap.ErrorNetwork, errors.New("connection reset"))}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1})
+
+	conn, _ := pool.Connect(context.Background())
+	_, err := conn.Search(context.Background(), SearchRequest{})
+	conn.Close()
+
+	if err == nil || !strings.Contains(err.Error(), "LDAP group error:") {
+		t.Fatalf("Error returned is wrong. Error: %v", err)
+	}
+	if !dialer.connections[0].isClosed {
+		t.Error("Broken connection should have been closed")
+	}
+	if len(pool.idle) != 0 {
+		t.Errorf("Pool should be empty, has %d idle connections", len(pool.idle))
+	}
+}
+
+func TestPooledClientShouldKeepConnectionsWhenSearchFailsWithLdapError(t *testing.T) {
+	dialer := &mockDialer{searchError: ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1})
+
+	conn, _ := pool.Connect(context.Background())
+	conn.Search(context.Background(), SearchRequest{})
+	conn.Close()
+
+	if dialer.connections[0].isClosed || len(pool.idle) != 1 {
+		t.Error("Connection should have been returned to the pool")
+	}
+}
+
+func TestPooledClientShouldReturnConnectError(t *testing.T) {
+	dialer := &mockDialer{connectError: errors.New("Cannot connect to LDAP: meh")}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxActive: 1})
+
+	_, err := pool.Connect(context.Background())
+
+	if err == nil || err.Error() != "Cannot connect to LDAP: meh" {
+		t.Fatalf("Error returned is wrong. Error: %v", err)
+	}
+	if len(pool.active) != 0 {
+		t.Error("Active slot should have been released")
+	}
+}
+
+func TestPooledClientShouldFillPoolToMinIdle(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MinIdle: 3, MaxIdle: 3})
+
+	if err := pool.fill(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	if dialer.dialled() != 3 || len(pool.idle) != 3 {
+		t.Errorf("Pool should have 3 idle connections, dialled: %d, idle: %d", dialer.dialled(), len(pool.idle))
+	}
+}
+
+func TestPooledClientShouldWaitWhenMaxActiveConnectionsAreInUse(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1, MaxActive: 1})
+	conn, _ := pool.get(context.Background())
+
+	checkedOut := make(chan *pooledConn)
+	go func() {
+		c, _ := pool.get(context.Background())
+		checkedOut <- c
+	}()
+
+	select {
+	case <-checkedOut:
+		t.Fatal("Second checkout should wait for the first connection to be returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.put(conn, true)
+	select {
+	case c := <-checkedOut:
+		if c.pooledConnection != conn.pooledConnection {
+			t.Error("Second checkout should reuse the returned connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Second checkout should have completed")
+	}
+}
+
+func TestPooledClientShouldHandleConcurrentSearches(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 5, MaxActive: 5})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := pool.Connect(context.Background())
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+				return
+			}
+			defer conn.Close()
+			if _, err := conn.Search(context.Background(), SearchRequest{}); err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if dialer.dialled() > 5 {
+		t.Errorf("Should've dialled at most 5 connections, dialled: %d", dialer.dialled())
+	}
+}
+
+func TestPooledClientShouldSearchLdapServer(t *testing.T) {
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	pool, err := NewPooledClient("corp", StaticCredentials(bindDistinguishedName, bindPassword), []string{testServer.url}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{}, PoolOptions{MinIdle: 1, MaxIdle: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	searchTwice(t, pool)
+}
+
+func TestPooledClientCloseShouldCloseIdleConnectionsAndRefuseNewOnes(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 2})
+	idle, _ := pool.Connect(context.Background())
+	inUse, _ := pool.Connect(context.Background())
+	idle.Close()
+
+	pool.Close()
+
+	if !dialer.connections[0].isClosed {
+		t.Error("Idle connection should have been closed")
+	}
+	if dialer.connections[1].isClosed {
+		t.Error("Connection in use should not have been closed")
+	}
+	inUse.Close()
+	if !dialer.connections[1].isClosed {
+		t.Error("Connection returned after the pool closed should have been closed")
+	}
+	if _, err := pool.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "connection pool is closed") {
+		t.Errorf("Expected pool closed error, got: %v", err)
+	}
+}
+
+func TestPooledClientConnShouldOnlyBeReturnedOnce(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 2, MaxActive: 2})
+	conn, _ := pool.Connect(context.Background())
+
+	conn.Close()
+	conn.Close()
+
+	if len(pool.idle) != 1 || len(pool.active) != 0 {
+		t.Errorf("Connection should have been returned once, idle: %d, active: %d", len(pool.idle), len(pool.active))
+	}
+}
+
+func TestNewPooledClientShouldReturnErrorIfMaxIdleLessThanMinIdle(t *testing.T) {
+	_, err := NewPooledClient("corp", StaticCredentials(bindDistinguishedName, bindPassword), []string{unusedUrl(t)}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{}, PoolOptions{MinIdle: 2, MaxIdle: 1})
+
+	if err == nil || !strings.Contains(err.Error(), "cannot be less than min idle") {
+		t.Errorf("Expected pool options error, got: %v", err)
+	}
+}
+
+func searchTwice(t *testing.T, client Client) {
+	searchWith(t, client)
+	searchWith(t, client)
+}
+
+func searchWith(t *testing.T, client Client) {
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer conn.Close()
+	if _, err := conn.Search(context.Background(), SearchRequest{BaseDn: "dc=testers,dc=testz", SearchFilter: "(cn=testy)"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+type mockDialer struct {
+	mu           sync.Mutex
+	connections  []*mockConnection
+	connectError error
+	searchError  error
+}
+
+func (d *mockDialer) connect(context.Context) (pooledConnection, error) {
+	if d.connectError != nil {
+		return nil, d.connectError
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conn := &mockConnection{searchError: d.searchError}
+	d.connections = append(d.connections, conn)
+	return conn, nil
+}
+
+func (d *mockDialer) bind(_ context.Context, conn pooledConnection) error {
+	return conn.Bind(bindDistinguishedName, bindPassword)
+}
+
+func (d *mockDialer) dialled() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.connections)
+}
+
+type mockConnection struct {
+	mu          sync.Mutex
+	searches    int
+	binds       int
+	isClosed    bool
+	searchError error
+	bindError   error
+}
+
+func (c *mockConnection) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.searches++
+	if c.searchError != nil {
+		return nil, c.searchError
+	}
+	return &ldap.SearchResult{}, nil
+}
+
+func (c *mockConnection) Modify(modifyRequest *ldap.ModifyRequest) error {
+	return nil
+}
+
+func (c *mockConnection) Bind(username, password string) error {
+	c.binds++
+	return c.bindError
+}
+
+func (c *mockConnection) Close() {
+	c.isClosed = true
+}
+
+type mockClock struct {
+	now time.Time
+}
+
+func (c *mockClock) Now() time.Time {
+	return c.now
+}
+
+func (c *mockClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
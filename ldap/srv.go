@@ -0,0 +1,164 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const srvScheme = "ldap-srv://"
+
+// Resolver looks up DNS SRV records, as net.Resolver does.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// srvTarget is a domain whose servers are found by looking up its '_ldap._tcp' SRV records. The records are cached
+// for SRVCacheTTL, as the TTLs of the records themselves are not available from the resolver.
+type srvTarget struct {
+	domain string
+	set    *serverSet
+
+	mu      sync.Mutex // held while looking up, so concurrent connects share a look up
+	records []*net.SRV
+	expires time.Time
+}
+
+// srvDomain returns the domain of an 'ldap-srv://domain' url.
+func srvDomain(ldapServerUrl string) (string, bool) {
+	if !strings.HasPrefix(ldapServerUrl, srvScheme) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(ldapServerUrl, srvScheme), "/"), true
+}
+
+func newSRVTarget(domain string, set *serverSet) (*srvTarget, error) {
+	if domain == "" || strings.ContainsAny(domain, ":/") {
+		return nil, fmt.Errorf("invalid LDAP SRV url %q, expected %sdomain", srvScheme+domain, srvScheme)
+	}
+	// checks the TLS options now rather than when the first server is looked up
+	if _, err := set.tlsOptions.tlsConfigFor(serverAddress{scheme: ldapScheme, address: net.JoinHostPort(domain, ldapPort)}); err != nil {
+		return nil, err
+	}
+	return &srvTarget{domain: domain, set: set}, nil
+}
+
+// servers returns the domain's servers, ordered by the priority and weight of their SRV records as RFC 2782 says, so
+// servers of the same priority share the load in proportion to their weights.
+func (t *srvTarget) servers(ctx context.Context) ([]*server, error) {
+	records, err := t.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []*server
+	for _, record := range orderSRV(records, t.set.intn) {
+		host := strings.TrimSuffix(record.Target, ".")
+		srv, err := t.set.serverFor(serverAddress{scheme: ldapScheme, address: net.JoinHostPort(host, fmt.Sprint(record.Port))})
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, srv)
+	}
+	return servers, nil
+}
+
+// lookup returns the cached records, looking them up again if they have expired. The expired records are used if
+// the look up fails, so a DNS outage doesn't take the directory with it.
+func (t *srvTarget) lookup(ctx context.Context) ([]*net.SRV, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.set.now()
+	if t.records != nil && now.Before(t.expires) {
+		return t.records, nil
+	}
+
+	_, records, err := t.set.options.Resolver.LookupSRV(ctx, "ldap", "tcp", t.domain)
+	records = available(records)
+	if err == nil && len(records) == 0 {
+		err = fmt.Errorf("no servers found")
+	}
+	if err != nil {
+		if t.records != nil {
+			t.expires = now.Add(t.set.options.SRVCacheTTL)
+			return t.records, nil
+		}
+		return nil, fmt.Errorf("Cannot connect to LDAP: cannot look up SRV records of %q: %v", t.domain, err)
+	}
+
+	t.records = records
+	t.expires = now.Add(t.set.options.SRVCacheTTL)
+	return records, nil
+}
+
+// available drops the '.' record, which means the service is not available in the domain.
+func available(records []*net.SRV) []*net.SRV {
+	var available []*net.SRV
+	for _, record := range records {
+		if record.Target != "." && record.Target != "" {
+			available = append(available, record)
+		}
+	}
+	return available
+}
+
+// orderSRV returns the records in priority order, those of the same priority in a random order weighted by their
+// weights.
+func orderSRV(records []*net.SRV, intn func(n int) int) []*net.SRV {
+	ordered := make([]*net.SRV, len(records))
+	copy(ordered, records)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Priority < ordered[j].Priority })
+
+	for i := 0; i < len(ordered); {
+		j := i + 1
+		for j < len(ordered) && ordered[j].Priority == ordered[i].Priority {
+			j++
+		}
+		shuffleByWeight(ordered[i:j], intn)
+		i = j
+	}
+	return ordered
+}
+
+// shuffleByWeight picks each record in turn with a probability in proportion to its weight, records with no weight
+// going last.
+func shuffleByWeight(records []*net.SRV, intn func(n int) int) {
+	sum := 0
+	for _, record := range records {
+		sum += int(record.Weight)
+	}
+	for sum > 0 && len(records) > 1 {
+		n := intn(sum)
+		running := 0
+		for i := range records {
+			running += int(records[i].Weight)
+			if running > n {
+				records[0], records[i] = records[i], records[0]
+				break
+			}
+		}
+		sum -= int(records[0].Weight)
+		records = records[1:]
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/ldap.v2"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSRVTargetShouldOrderServersByPriorityThenWeight(t *testing.T) {
+	resolver := &mockResolver{records: []*net.SRV{
+		{Target: "dc3.example.com.", Port: 389, Priority: 10, Weight: 100},
+		{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 10},
+		{Target: "dc2.example.com.", Port: 3268, Priority: 0, Weight: 90},
+	}}
+	servers := newSRVServerSet(t, resolver, time.Minute)
+	servers.intn = func(n int) int { return n - 1 } // i.e. the last of the weights is picked
+
+	listed, err := servers.list(context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if addresses := addressesOf(listed); !reflect.DeepEqual(addresses, []string{"dc2.example.com:3268", "dc1.example.com:389", "dc3.example.com:389"}) {
+		t.Errorf("Servers are wrong: %v", addresses)
+	}
+	if resolver.name != "example.com" || resolver.service != "ldap" || resolver.proto != "tcp" {
+		t.Errorf("Look up is wrong: _%s._%s.%s", resolver.service, resolver.proto, resolver.name)
+	}
+}
+
+func TestOrderSRVShouldPickRecordsInProportionToTheirWeight(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "a.", Weight: 0},
+		{Target: "b.", Weight: 10},
+		{Target: "c.", Weight: 30},
+	}
+	tests := []struct {
+		n     int
+		order []string
+	}{
+		{0, []string{"b.", "c.", "a."}},
+		{9, []string{"b.", "c.", "a."}},
+		{10, []string{"c.", "b.", "a."}},
+		{39, []string{"c.", "b.", "a."}},
+	}
+
+	for _, test := range tests {
+		first := true
+		ordered := orderSRV(records, func(sum int) int {
+			if first {
+				first = false
+				return test.n
+			}
+			return 0
+		})
+
+		var order []string
+		for _, record := range ordered {
+			order = append(order, record.Target)
+		}
+		if !reflect.DeepEqual(order, test.order) {
+			t.Errorf("Order for %d should be %v, is: %v", test.n, test.order, order)
+		}
+	}
+}
+
+func TestSRVTargetShouldCacheServersForTTL(t *testing.T) {
+	resolver := &mockResolver{records: []*net.SRV{{Target: "dc1.example.com.", Port: 389}}}
+	servers := newSRVServerSet(t, resolver, time.Minute)
+	clock := &mockClock{now: time.Now()}
+	servers.now = clock.Now
+
+	first, _ := servers.list(context.Background())
+	clock.advance(59 * time.Second)
+	second, _ := servers.list(context.Background())
+
+	if resolver.lookups != 1 {
+		t.Errorf("Should've looked up once, looked up: %d", resolver.lookups)
+	}
+	clock.advance(time.Second)
+	third, _ := servers.list(context.Background())
+
+	if resolver.lookups != 2 {
+		t.Errorf("Should've looked up again after a minute, looked up: %d", resolver.lookups)
+	}
+	if first[0] != second[0] || first[0] != third[0] {
+		t.Error("The same server should be returned by every look up, so its breaker state is kept")
+	}
+}
+
+func TestSRVTargetShouldKeepUsingExpiredServersIfLookupFails(t *testing.T) {
+	resolver := &mockResolver{records: []*net.SRV{{Target: "dc1.example.com.", Port: 389}}}
+	servers := newSRVServerSet(t, resolver, time.Minute)
+	clock := &mockClock{now: time.Now()}
+	servers.now = clock.Now
+	servers.list(context.Background())
+
+	resolver.err = errors.New("no such host")
+	clock.advance(time.Minute)
+	listed, err := servers.list(context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if addresses := addressesOf(listed); !reflect.DeepEqual(addresses, []string{"dc1.example.com:389"}) {
+		t.Errorf("Servers are wrong: %v", addresses)
+	}
+}
+
+func TestSRVTargetShouldReturnErrorIfLookupFindsNoServers(t *testing.T) {
+	tests := []struct {
+		resolver *mockResolver
+		err      string
+	}{
+		{&mockResolver{err: errors.New("no such host")}, `Cannot connect to LDAP: cannot look up SRV records of "example.com": no such host`},
+		{&mockResolver{records: []*net.SRV{{Target: "."}}}, `Cannot connect to LDAP: cannot look up SRV records of "example.com": no servers found`},
+	}
+
+	for _, test := range tests {
+		servers := newSRVServerSet(t, test.resolver, time.Minute)
+
+		_, err := servers.try(context.Background(), func(s *server) (*ldap.Conn, error) {
+			t.Fatal("Should not have tried to connect")
+			return nil, nil
+		})
+
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Error returned is wrong: %v", err)
+		}
+	}
+}
+
+func TestNewServerSetShouldRejectInvalidSRVUrl(t *testing.T) {
+	for _, url := range []string{"ldap-srv://", "ldap-srv://example.com:389"} {
+		_, err := newServerSet([]string{url}, TLSOptions{}, FailoverOptions{})
+
+		if err == nil {
+			t.Errorf("Expected error for %q!", url)
+		}
+	}
+}
+
+func TestConnectShouldConnectToServerFoundBySRVLookup(t *testing.T) {
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	host, port, _ := net.SplitHostPort(testServer.url)
+	p, _ := strconv.Atoi(port)
+	resolver := &mockResolver{records: []*net.SRV{{Target: host + ".", Port: uint16(p)}}}
+	client, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{"ldap-srv://example.com"}, TLSOptions{}, FailoverOptions{Resolver: resolver}, TimeoutOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	conn, err := client.Connect(context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	conn.Close()
+}
+
+func newSRVServerSet(t *testing.T, resolver Resolver, ttl time.Duration) *serverSet {
+	servers, err := newServerSet([]string{"ldap-srv://example.com"}, TLSOptions{}, FailoverOptions{Resolver: resolver, SRVCacheTTL: ttl})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return servers
+}
+
+type mockResolver struct {
+	records              []*net.SRV
+	err                  error
+	lookups              int
+	service, proto, name string
+}
+
+func (r *mockResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups++
+	r.service, r.proto, r.name = service, proto, name
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return "", r.records, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TimeoutOptions are the client-side deadlines of each step, enforced whatever the server's own search time limit.
+// 0 means no deadline, other than the caller's context.
+type TimeoutOptions struct {
+	Connect time.Duration // dialing a server and starting TLS, per server tried
+	Bind    time.Duration // binding as the service account or a user
+	Search  time.Duration // each search request, i.e. each page of a paged search, and each modify request
+}
+
+// TimeoutError is returned when an operation is given up on because its deadline passed, or its context was
+// cancelled, rather than because the server failed it.
+type TimeoutError struct {
+	Op  string // 'connect', 'bind', 'search' or 'modify'
+	Err error  // context.DeadlineExceeded or context.Canceled
+}
+
+func (e *TimeoutError) Error() string {
+	if errors.Is(e.Err, context.Canceled) {
+		return e.Op + " cancelled"
+	}
+	return e.Op + " timed out"
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the deadline passed, as opposed to the context being cancelled.
+func (e *TimeoutError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// withTimeout returns ctx with the deadline d from now, or ctx itself if d is 0.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// withContext runs f, returning a *TimeoutError if ctx is done before it returns. The LDAP library cannot cancel an
+// operation, so abort is called to make f give up, e.g. by closing its connection, which cannot be used afterwards.
+func withContext(ctx context.Context, op string, abort func(), f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return &TimeoutError{Op: op, Err: err}
+	}
+	if ctx.Done() == nil {
+		return f()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		abort()
+		return &TimeoutError{Op: op, Err: ctx.Err()}
+	}
+}
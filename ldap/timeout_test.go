@@ -0,0 +1,222 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/ldap.v2"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientShouldTimeOutBindToUnresponsiveServer(t *testing.T) {
+	address := hungServer(t)
+	client, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{address}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{Bind: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	_, err = client.Connect(context.Background())
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Op != "bind" || !timeoutErr.Timeout() {
+		t.Fatalf("Should've returned a bind timeout, returned: %v", err)
+	}
+	if err.Error() != "Cannot bind to LDAP: bind timed out" {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestClientShouldTimeOutTLSHandshakeWithUnresponsiveServer(t *testing.T) {
+	address := hungServer(t)
+	client, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{"ldaps://" + address}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{Connect: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	_, err = client.Connect(context.Background())
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Op != "connect" {
+		t.Fatalf("Should've returned a connect timeout, returned: %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "Cannot connect to LDAP: ") {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestClientShouldStopWhenContextIsCancelled(t *testing.T) {
+	address := hungServer(t)
+	client, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{address}, TLSOptions{}, FailoverOptions{}, TimeoutOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err = client.Connect(ctx)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout() || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Should've returned a cancellation, returned: %v", err)
+	}
+	if err.Error() != "Cannot bind to LDAP: bind cancelled" {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestSearchShouldTimeOutAndCloseConnection(t *testing.T) {
+	conn := &blockingSearcher{closed: make(chan struct{})}
+
+	_, err := search(context.Background(), conn, SearchRequest{}, 50*time.Millisecond)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Op != "search" {
+		t.Fatalf("Should've returned a search timeout, returned: %v", err)
+	}
+	if err.Error() != "LDAP group error: search timed out" {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+	if !isConnectionError(err) {
+		t.Error("Timed out connection should be treated as broken")
+	}
+}
+
+func TestModifyShouldTimeOutAndCloseConnection(t *testing.T) {
+	conn := &blockingSearcher{closed: make(chan struct{})}
+
+	err := modify(context.Background(), conn, ldap.NewModifyRequest("cn=group"), 50*time.Millisecond)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Op != "modify" {
+		t.Fatalf("Should've returned a modify timeout, returned: %v", err)
+	}
+	if !isConnectionError(err) {
+		t.Error("Timed out connection should be treated as broken")
+	}
+}
+
+func TestSearchShouldNotTimeOutWithoutDeadline(t *testing.T) {
+	conn := &blockingSearcher{closed: make(chan struct{}), delay: 50 * time.Millisecond}
+
+	if _, err := search(context.Background(), conn, SearchRequest{}, 0); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestServerSetShouldNotCountCancellationAsServerFailure(t *testing.T) {
+	servers := newTestServerSet(t, FailoverOptions{FailureThreshold: 1, RetryAfter: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tried := 0
+	_, err := servers.try(ctx, func(s *server) (*ldap.Conn, error) {
+		tried++
+		cancel()
+		return nil, &TimeoutError{Op: "connect", Err: ctx.Err()}
+	})
+
+	if tried != 1 {
+		t.Errorf("Should've stopped trying servers once cancelled, tried: %d", tried)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+	listed, _ := servers.list(context.Background())
+	if !listed[0].available(servers.now()) {
+		t.Error("Server should not have been skipped because the caller gave up")
+	}
+}
+
+func TestPooledClientShouldStopWaitingForActiveConnectionWhenContextIsDone(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1, MaxActive: 1})
+	conn, _ := pool.Connect(context.Background())
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := pool.Connect(ctx)
+
+	if err == nil || err.Error() != "Cannot connect to LDAP: connect timed out" {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+}
+
+func TestPooledClientShouldKeepIdleConnectionsWhenContextIsDone(t *testing.T) {
+	dialer := &mockDialer{}
+	pool := newPooledClient(dialer.connect, dialer.bind, PoolOptions{MaxIdle: 1})
+	conn, _ := pool.Connect(context.Background())
+	conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := pool.Connect(ctx)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Error returned is wrong: %v", err)
+	}
+	if dialer.connections[0].isClosed || len(pool.idle) != 1 {
+		t.Error("Idle connection should have been kept")
+	}
+}
+
+// hungServer accepts connections but never answers, like a server that has stopped responding.
+func hungServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// blockingSearcher answers after delay, or never if delay is 0, until it is closed.
+type blockingSearcher struct {
+	delay  time.Duration
+	closed chan struct{}
+}
+
+func (s *blockingSearcher) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+		return &ldap.SearchResult{}, nil
+	}
+	<-s.closed
+	return nil, ldap.NewError(ldap.ErrorNetwork, errors.New("ldap: connection closed"))
+}
+
+func (s *blockingSearcher) Modify(modifyRequest *ldap.ModifyRequest) error {
+	_, err := s.Search(nil)
+	return err
+}
+
+func (s *blockingSearcher) Close() {
+	close(s.closed)
+}
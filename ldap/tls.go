@@ -0,0 +1,129 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	ldapScheme  = "ldap"
+	ldapsScheme = "ldaps"
+	ldapPort    = "389"
+	ldapsPort   = "636"
+)
+
+type TLSOptions struct {
+	StartTLS       bool   // upgrade a plain 'ldap://' connection with the StartTLS extended operation
+	CACertFile     string // PEM bundle used to verify the server certificate, the system pool is used if empty
+	ClientCertFile string // optional PEM certificate presented to the server
+	ClientKeyFile  string // the key for ClientCertFile
+	ServerName     string // overrides the host name the server certificate is verified against
+}
+
+type serverAddress struct {
+	scheme  string
+	address string // i.e. host:port
+}
+
+func (a serverAddress) isLDAPS() bool {
+	return a.scheme == ldapsScheme
+}
+
+// parseServerUrl accepts 'ldap://host[:port]', 'ldaps://host[:port]' or a bare 'host:port', which is treated as
+// 'ldap://host:port' so existing LDAP_URL values keep working.
+func parseServerUrl(ldapServerUrl string) (serverAddress, error) {
+	if !strings.Contains(ldapServerUrl, "://") {
+		return serverAddress{scheme: ldapScheme, address: ldapServerUrl}, nil
+	}
+
+	u, err := url.Parse(ldapServerUrl)
+	if err != nil {
+		return serverAddress{}, fmt.Errorf("invalid LDAP url %q: %v", ldapServerUrl, err)
+	}
+	if u.Hostname() == "" {
+		return serverAddress{}, fmt.Errorf("invalid LDAP url %q: no host", ldapServerUrl)
+	}
+
+	var defaultPort string
+	switch strings.ToLower(u.Scheme) {
+	case ldapScheme:
+		defaultPort = ldapPort
+	case ldapsScheme:
+		defaultPort = ldapsPort
+	default:
+		return serverAddress{}, fmt.Errorf("invalid LDAP url %q: unsupported scheme %q", ldapServerUrl, u.Scheme)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return serverAddress{scheme: strings.ToLower(u.Scheme), address: net.JoinHostPort(u.Hostname(), port)}, nil
+}
+
+// tlsConfigFor builds the tls config used to secure the connection to the server, returning nil if the connection
+// is not to be secured at all.
+func (o TLSOptions) tlsConfigFor(server serverAddress) (*tls.Config, error) {
+	if server.isLDAPS() && o.StartTLS {
+		return nil, errors.New("StartTLS cannot be used with an 'ldaps://' url")
+	}
+	if !server.isLDAPS() && !o.StartTLS {
+		return nil, nil
+	}
+
+	config := &tls.Config{ServerName: o.ServerName}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(server.address)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine TLS server name from %q: %v", server.address, err)
+		}
+		config.ServerName = host
+	}
+
+	if o.CACertFile != "" {
+		pem, err := ioutil.ReadFile(o.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificate file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA certificate file %q", o.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if o.ClientCertFile != "" || o.ClientKeyFile != "" {
+		if o.ClientCertFile == "" || o.ClientKeyFile == "" {
+			return nil, errors.New("both a client certificate and a client key file must be provided")
+		}
+		cert, err := tls.LoadX509KeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,351 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"gopkg.in/asn1-ber.v1"
+	"gopkg.in/ldap.v2"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	startTLSOid    = "1.3.6.1.4.1.1466.20037"
+	testServerName = "localhost"
+)
+
+// test the url parsing
+
+func TestParseServerUrlShouldTreatHostAndPortAsPlainLdap(t *testing.T) {
+	server, err := parseServerUrl("my.ldap.com:123")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: '%s'.", err.Error())
+	}
+	if server.scheme != "ldap" || server.address != "my.ldap.com:123" {
+		t.Errorf("Server address is wrong: %+v", server)
+	}
+}
+
+func TestParseServerUrlShouldApplyDefaultPortsForSchemes(t *testing.T) {
+	tests := []struct {
+		url     string
+		scheme  string
+		address string
+	}{
+		{url: "ldap://my.ldap.com", scheme: "ldap", address: "my.ldap.com:389"},
+		{url: "ldaps://my.ldap.com", scheme: "ldaps", address: "my.ldap.com:636"},
+		{url: "LDAPS://my.ldap.com:3269", scheme: "ldaps", address: "my.ldap.com:3269"},
+	}
+
+	for _, test := range tests {
+		server, err := parseServerUrl(test.url)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: '%s'.", test.url, err.Error())
+		}
+		if server.scheme != test.scheme || server.address != test.address {
+			t.Errorf("Server address for %q is wrong. Expected: %s %s, actual: %+v", test.url, test.scheme, test.address, server)
+		}
+	}
+}
+
+func TestParseServerUrlShouldReturnErrorForUnsupportedScheme(t *testing.T) {
+	_, err := parseServerUrl("http://my.ldap.com")
+
+	if err == nil || !strings.Contains(err.Error(), "unsupported scheme") {
+		t.Errorf("Expected unsupported scheme error, got: %v", err)
+	}
+}
+
+// test the tls config
+
+func TestNewClientShouldReturnErrorWhenStartTLSUsedWithLdapsUrl(t *testing.T) {
+	_, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{"ldaps://my.ldap.com:636"}, TLSOptions{StartTLS: true}, FailoverOptions{}, TimeoutOptions{})
+
+	if err == nil || !strings.Contains(err.Error(), "StartTLS cannot be used") {
+		t.Errorf("Expected StartTLS error, got: %v", err)
+	}
+}
+
+func TestNewClientShouldReturnErrorWhenCACertFileHasNoCertificates(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, []byte("not a certificate"))
+
+	_, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{"ldaps://my.ldap.com:636"}, TLSOptions{CACertFile: caFile}, FailoverOptions{}, TimeoutOptions{})
+
+	if err == nil || !strings.Contains(err.Error(), "no PEM certificates found") {
+		t.Errorf("Expected CA certificate error, got: %v", err)
+	}
+}
+
+func TestNewClientShouldReturnErrorWhenOnlyClientCertProvided(t *testing.T) {
+	_, err := NewClient(StaticCredentials(bindDistinguishedName, bindPassword), []string{"ldaps://my.ldap.com:636"}, TLSOptions{ClientCertFile: "client.pem"}, FailoverOptions{}, TimeoutOptions{})
+
+	if err == nil || !strings.Contains(err.Error(), "both a client certificate and a client key") {
+		t.Errorf("Expected client certificate error, got: %v", err)
+	}
+}
+
+func TestTLSConfigShouldDefaultServerNameToHostAndAllowOverride(t *testing.T) {
+	server := serverAddress{scheme: "ldaps", address: "dc1.example.com:636"}
+
+	config, err := TLSOptions{}.tlsConfigFor(server)
+	if err != nil {
+		t.Fatalf("Unexpected error: '%s'.", err.Error())
+	}
+	if config.ServerName != "dc1.example.com" {
+		t.Errorf("Server name should be 'dc1.example.com', is: %q", config.ServerName)
+	}
+
+	config, err = TLSOptions{ServerName: "example.com"}.tlsConfigFor(server)
+	if err != nil {
+		t.Fatalf("Unexpected error: '%s'.", err.Error())
+	}
+	if config.ServerName != "example.com" {
+		t.Errorf("Server name should be 'example.com', is: %q", config.ServerName)
+	}
+}
+
+func TestTLSConfigShouldBeNilForPlainConnections(t *testing.T) {
+	config, err := TLSOptions{CACertFile: "ignored.pem"}.tlsConfigFor(serverAddress{scheme: "ldap", address: "my.ldap.com:389"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: '%s'.", err.Error())
+	}
+	if config != nil {
+		t.Errorf("TLS config should be nil, is: %+v", config)
+	}
+}
+
+// test the secured connections
+
+func TestConnectShouldConnectToLDAPSServer(t *testing.T) {
+	certs := newTestCertificates(t)
+	defer os.RemoveAll(certs.dir)
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	proxyUrl, stopProxy := startTLSProxy(t, testServer.url, certs.serverCert, false)
+	defer stopProxy()
+	client := newTestClient(t, "ldaps://"+proxyUrl, TLSOptions{CACertFile: certs.caFile})
+
+	conn, err := client.Connect(context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: '%s'.", err.Error())
+	}
+	conn.Close()
+}
+
+func TestConnectShouldConnectToLDAPServerWithStartTLS(t *testing.T) {
+	certs := newTestCertificates(t)
+	defer os.RemoveAll(certs.dir)
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	proxyUrl, stopProxy := startTLSProxy(t, testServer.url, certs.serverCert, true)
+	defer stopProxy()
+	client := newTestClient(t, "ldap://"+proxyUrl, TLSOptions{StartTLS: true, CACertFile: certs.caFile})
+
+	conn, err := client.Connect(context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: '%s'.", err.Error())
+	}
+	conn.Close()
+}
+
+func TestConnectShouldReturnErrorIfLDAPSServerCertificateIsNotTrusted(t *testing.T) {
+	certs := newTestCertificates(t)
+	defer os.RemoveAll(certs.dir)
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	proxyUrl, stopProxy := startTLSProxy(t, testServer.url, certs.serverCert, false)
+	defer stopProxy()
+	client := newTestClient(t, "ldaps://"+proxyUrl, TLSOptions{})
+
+	conn, err := client.Connect(context.Background())
+
+	if err == nil {
+		conn.Close()
+		t.Fatal("Should've returned error due to untrusted certificate.")
+	}
+	if !strings.Contains(err.Error(), "Cannot connect to LDAP:") {
+		t.Errorf("Error returned is wrong. Error: %s", err.Error())
+	}
+}
+
+func TestConnectShouldReturnErrorIfStartTLSServerNameDoesNotMatch(t *testing.T) {
+	certs := newTestCertificates(t)
+	defer os.RemoveAll(certs.dir)
+	testServer := startLdapServer(t, shouldBind)
+	defer testServer.stop()
+	proxyUrl, stopProxy := startTLSProxy(t, testServer.url, certs.serverCert, true)
+	defer stopProxy()
+	client := newTestClient(t, "ldap://"+proxyUrl, TLSOptions{StartTLS: true, CACertFile: certs.caFile, ServerName: "other.example.com"})
+
+	conn, err := client.Connect(context.Background())
+
+	if err == nil {
+		conn.Close()
+		t.Fatal("Should've returned error due to server name mismatch.")
+	}
+	if !strings.Contains(err.Error(), "Cannot start TLS with LDAP:") {
+		t.Errorf("Error returned is wrong. Error: %s", err.Error())
+	}
+}
+
+// startTLSProxy terminates TLS on a free local port, returning its url, and forwards the plain traffic to the test
+// ldap server at backendUrl, which has no TLS support of its own. With startTLS set the proxy answers the StartTLS
+// extended operation before the handshake. The stop function returns once the proxy has stopped listening.
+func startTLSProxy(t *testing.T, backendUrl string, cert tls.Certificate, startTLS bool) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot start TLS proxy: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go proxyConnection(conn, backendUrl, config, startTLS)
+		}
+	}()
+
+	return ln.Addr().String(), func() {
+		ln.Close()
+		<-stopped
+	}
+}
+
+func proxyConnection(conn net.Conn, backendUrl string, config *tls.Config, startTLS bool) {
+	if startTLS {
+		if err := answerStartTLS(conn); err != nil {
+			conn.Close()
+			return
+		}
+	}
+	client := tls.Server(conn, config)
+	defer client.Close()
+
+	backend, err := net.Dial("tcp", backendUrl)
+	if err != nil {
+		return
+	}
+	defer backend.Close()
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(backend, client); done <- struct{}{} }()
+	go func() { io.Copy(client, backend); done <- struct{}{} }()
+	<-done
+}
+
+func answerStartTLS(conn net.Conn) error {
+	packet, err := ber.ReadPacket(conn)
+	if err != nil {
+		return err
+	}
+	request := packet.Children[1]
+	if request.Tag != ldap.ApplicationExtendedRequest || string(request.Children[0].Data.Bytes()) != startTLSOid {
+		return io.ErrUnexpectedEOF
+	}
+
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, packet.Children[0].Value, "MessageID"))
+	extendedResponse := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationExtendedResponse, nil, "Extended Response")
+	extendedResponse.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, ldap.LDAPResultSuccess, "resultCode"))
+	extendedResponse.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	extendedResponse.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	response.AppendChild(extendedResponse)
+
+	_, err = conn.Write(response.Bytes())
+	return err
+}
+
+type testCertificates struct {
+	dir        string
+	caFile     string
+	serverCert tls.Certificate
+}
+
+// newTestCertificates creates a self-signed certificate for 'localhost' and writes it out as the CA bundle.
+func newTestCertificates(t *testing.T) testCertificates {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: testServerName},
+		DNSNames:              []string{testServerName},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+
+	dir := tempDir(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	return testCertificates{
+		dir:        dir,
+		caFile:     caFile,
+		serverCert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "flyte-ldap")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %v", err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatalf("Cannot write %s: %v", name, err)
+	}
+}
@@ -17,76 +17,61 @@ limitations under the License.
 package main
 
 import (
+	"flag"
 	"github.com/ExpediaGroup/flyte-ldap/command"
-	"github.com/ExpediaGroup/flyte-ldap/group"
-	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"github.com/ExpediaGroup/flyte-ldap/config"
+	"github.com/ExpediaGroup/flyte-ldap/health"
 	"github.com/HotelsDotCom/flyte-client/client"
 	"github.com/HotelsDotCom/flyte-client/flyte"
 	"github.com/HotelsDotCom/go-logger"
 	"net/url"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
-var env environment = &osEnvironment{}
-
-type environment interface {
-	getValueFor(name string) string
-}
-
-type osEnvironment struct{}
-
-func (o *osEnvironment) getValueFor(name string) string {
-	return os.Getenv(name)
-}
-
 func main() {
-	searchTimeout, err := strconv.Atoi(optionalConfigVal("SEARCH_TIMEOUT_IN_SECONDS", "20"))
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON config file, environment variables override its values")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile, os.Getenv)
 	if err != nil {
-		logger.Fatalf("LDAP group timeout '%v' not convertible to an integer. Error: %v", configVal("SEARCH_TIMEOUT_IN_SECONDS"), err)
+		logger.Fatal(err)
 	}
+	directories := newDirectories(cfg)
 
-	lc := ldap.NewClient(configVal("BIND_USERNAME"), configVal("BIND_PASSWORD"), configVal("LDAP_URL"))
-	searcher := group.NewSearcher(lc)
-	searchDetails := &group.SearchDetails{
-		Attributes:     strings.Split(configVal("ATTRIBUTES"), ","),
-		BaseDn:         configVal("BASE_DN"),
-		SearchFilter:   configVal("SEARCH_FILTER"),
-		SearchTimeout:  searchTimeout,
-		GroupAttribute: configVal("GROUP_ATTRIBUTE"),
+	registration := &health.Registration{}
+	prober := health.NewProber(directories, cfg.ReadinessInterval)
+	stopProbing := make(chan struct{})
+	if cfg.HealthAddress != "" {
+		prober.Start(stopProbing)
 	}
+	serveHTTP(cfg, registration, prober)
 
 	packDef := flyte.PackDef{
 		Name: "ldap",
 		Commands: []flyte.Command{
-			command.GetGroupsCommand(searcher, searchDetails),
+			command.GetGroupsCommand(directories),
+			command.IsMemberOfCommand(directories),
+			command.GetGroupMembersCommand(directories),
+			command.GetUserCommand(directories),
+			command.AuthenticateCommand(directories),
+			command.AddUserToGroupCommand(directories, cfg.DryRun),
+			command.RemoveUserFromGroupCommand(directories, cfg.DryRun),
 		},
 		HelpURL: createURL("https://github.com/ExpediaGroup/flyte-ldap/blob/master/README.md"),
 	}
 
-	pack := flyte.NewPack(packDef, client.NewClient(createURL(configVal("FLYTE_API_URL")), 10*time.Second))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
 
-	pack.Start()
+	flyteClient := newDrainingClient(registration.Client(client.NewClient(cfg.FlyteAPIURL, 10*time.Second)))
+	pack := flyte.NewPack(packDef, flyteClient)
 
-	blockForever()
-}
+	go pack.Start() // it blocks until the pack is registered, which should not stop the pack being shut down
 
-func configVal(k string) string {
-	v := env.getValueFor(k)
-	if v == "" {
-		logger.Fatalf("Config value %q must be set", k)
-	}
-	return v
-}
-
-func optionalConfigVal(k string, defaultVal string) string {
-	v := env.getValueFor(k)
-	if v == "" {
-		return defaultVal
-	}
-	return v
+	shutdown(<-signals, flyteClient, cfg.ShutdownGracePeriod, stopProbing, directories)
 }
 
 func createURL(u string) *url.URL {
@@ -96,7 +81,3 @@ func createURL(u string) *url.URL {
 	}
 	return url
 }
-
-func blockForever() {
-	select {}
-}
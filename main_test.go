@@ -24,59 +24,6 @@ import (
 	"testing"
 )
 
-func TestConfigVal_shouldReturnEnvironmentConfigValue(t *testing.T) {
-	env = &mockEnvironment{
-		values: map[string]string{
-			"LDAP_URL": "my.ldap.com:123",
-		},
-	}
-
-	ldapUrl := configVal("LDAP_URL")
-
-	if ldapUrl != "my.ldap.com:123" {
-		t.Errorf("Value returned wrong. Expect: '%s'. Actual '%s'", "my.ldap.com:123", ldapUrl)
-	}
-}
-
-func TestConfigVal_shouldLogFatalIfConfigValueNotSet(t *testing.T) {
-	loggertest.Init(loggertest.LogLevelInfo)
-	defer loggertest.Reset()
-
-	defer func() {
-		if r := recover(); r != nil {
-			logMessages := loggertest.GetLogMessages()
-			require.Len(t, logMessages, 1)
-			assert.Contains(t, logMessages[0].RawMessage, "Config value \"LDAP_URL\" must be set")
-		}
-	}()
-
-	configVal("LDAP_URL")
-}
-
-func TestOptionalConfigVal_shouldReturnEnvironmentConfigValue(t *testing.T) {
-	env = &mockEnvironment{
-		values: map[string]string{
-			"LDAP_URL": "my.ldap.com:123",
-		},
-	}
-
-	ldapUrl := optionalConfigVal("LDAP_URL", "ldap.default.com:1234")
-
-	if ldapUrl != "my.ldap.com:123" {
-		t.Errorf("Value returned wrong. Expect: '%s'. Actual '%s'", "my.ldap.com:123", ldapUrl)
-	}
-}
-
-func TestOptionalConfigVal_shouldReturnDefaultConfigValueWhenEnvironmentConfigNotSet(t *testing.T) {
-	setEmptyEnvironment()
-
-	ldapUrl := optionalConfigVal("LDAP_URL", "ldap.default.com:1234")
-
-	if ldapUrl != "ldap.default.com:1234" {
-		t.Errorf("Value returned wrong. Expect: '%s'. Actual '%s'", "ldap.default.com:1234", ldapUrl)
-	}
-}
-
 func TestCreateUrl_shouldCreateUrlFromStringRepresentation(t *testing.T) {
 	strUrl := "http://www.something.com"
 	var url *url.URL
@@ -105,15 +52,3 @@ func TestCreateUrl_shouldLogFatalIfStringUrlCannotBeParsed(t *testing.T) {
 
 	createURL("://hello")
 }
-
-func setEmptyEnvironment() {
-	env = &mockEnvironment{}
-}
-
-type mockEnvironment struct {
-	values map[string]string
-}
-
-func (m *mockEnvironment) getValueFor(name string) string {
-	return m.values[name]
-}
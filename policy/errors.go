@@ -0,0 +1,42 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeniedError is returned when the policy denies a request, naming the rule that denied it, or DefaultRule.
+type DeniedError struct {
+	Operation string
+	Target    string
+	Rule      string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%s on %q denied by policy rule %q", e.Operation, e.Target, e.Rule)
+}
+
+// RulesError lists every problem found with a policy's rules, rather than just the first.
+type RulesError struct {
+	Problems []string
+}
+
+func (e *RulesError) Error() string {
+	return "Invalid policy rules: " + strings.Join(e.Problems, ", ")
+}
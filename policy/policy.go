@@ -0,0 +1,292 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"regexp"
+	"strings"
+)
+
+// DefaultRule names the decision made when no rule matches a request, which is denied.
+const DefaultRule = "default-deny"
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Rule allows or denies the requests it matches. A request matches if it matches every condition the rule sets, a
+// condition with no values matching any request. Patterns match ignoring case, '*' matching any characters, though in
+// group patterns only within a single RDN value, so 'CN=app-*,OU=Groups,DC=com' does not match groups in OUs below.
+type Rule struct {
+	Name       string
+	Effect     Effect
+	Operations []string          // the commands, e.g. 'AddUserToGroup'
+	Groups     []string          // patterns of the DN of the group to be modified, e.g. 'CN=app-*,OU=Groups,DC=com'
+	Subtrees   []string          // DNs the group to be modified must be in, e.g. 'OU=Access,OU=Groups,DC=com'
+	Attributes []string          // allow rules match requests modifying only these, deny rules any of them
+	Flow       map[string]string // patterns of the requesting flow's metadata, e.g. 'name': 'access-request-*'
+}
+
+// Request is an operation about to modify the directory.
+type Request struct {
+	Operation  string
+	Target     string            // the DN of the entry to be modified
+	Attributes []string          // the attributes to be modified, e.g. 'member'
+	Flow       map[string]string // the metadata the requesting flow gave in the command input
+}
+
+// Decision is whether a request is allowed, and the rule that decided it.
+type Decision struct {
+	Allowed bool
+	Rule    string
+}
+
+// Policy decides which requests to modify the directory are allowed. A request is denied if any deny rule matches
+// it, otherwise it is allowed by the first allow rule that matches it, and denied if none does. A nil Policy denies
+// every request.
+type Policy struct {
+	rules []*rule
+}
+
+type rule struct {
+	Rule
+	groups   []dnPattern
+	subtrees []group.DN
+	flow     map[string]*regexp.Regexp
+}
+
+// New checks and compiles the rules, returning every problem found with them in a *RulesError.
+func New(rules []Rule) (*Policy, error) {
+	p := &Policy{}
+	var problems []string
+	names := map[string]bool{}
+	for i, r := range rules {
+		compiled, err := compile(r)
+		switch {
+		case r.Name == "":
+			problems = append(problems, fmt.Sprintf("rule %d has no name", i+1))
+		case names[r.Name]:
+			problems = append(problems, fmt.Sprintf("rule %q is defined more than once", r.Name))
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("rule %q %v", r.Name, err))
+		}
+		names[r.Name] = true
+		p.rules = append(p.rules, compiled)
+	}
+	if len(problems) > 0 {
+		return nil, &RulesError{Problems: problems}
+	}
+	return p, nil
+}
+
+func compile(r Rule) (*rule, error) {
+	if r.Effect != Allow && r.Effect != Deny {
+		return nil, fmt.Errorf("has effect %q rather than %q or %q", r.Effect, Allow, Deny)
+	}
+	compiled := &rule{Rule: r, flow: map[string]*regexp.Regexp{}}
+	for _, pattern := range r.Groups {
+		dn, err := group.ParseDN(pattern)
+		if err != nil || len(dn) == 0 {
+			return nil, fmt.Errorf("has group pattern %q that is not a DN", pattern)
+		}
+		compiled.groups = append(compiled.groups, compileDNPattern(dn))
+	}
+	for _, subtree := range r.Subtrees {
+		dn, err := group.ParseDN(subtree)
+		if err != nil || len(dn) == 0 {
+			return nil, fmt.Errorf("has subtree %q that is not a DN", subtree)
+		}
+		compiled.subtrees = append(compiled.subtrees, dn)
+	}
+	for key, pattern := range r.Flow {
+		compiled.flow[strings.ToLower(key)] = patternRegexp(pattern)
+	}
+	return compiled, nil
+}
+
+// patternRegexp matches the whole of a value ignoring case, '*' in the pattern matching any characters.
+func patternRegexp(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("(?i)^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$")
+}
+
+// dnPattern matches DNs with as many RDNs, each of the same attribute types, with values matching its patterns.
+type dnPattern []rdnPattern
+
+type rdnPattern []atvPattern
+
+type atvPattern struct {
+	attributeType string
+	value         *regexp.Regexp
+}
+
+func compileDNPattern(dn group.DN) dnPattern {
+	pattern := make(dnPattern, len(dn))
+	for i, rdn := range dn {
+		for _, atv := range rdn {
+			pattern[i] = append(pattern[i], atvPattern{attributeType: atv.Type, value: patternRegexp(atv.Value)})
+		}
+	}
+	return pattern
+}
+
+func (p dnPattern) matches(dn group.DN) bool {
+	if len(p) != len(dn) {
+		return false
+	}
+	for i, rdn := range p {
+		if !rdn.matches(dn[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p rdnPattern) matches(rdn group.RDN) bool {
+	if len(p) != len(rdn) {
+		return false
+	}
+	for _, pattern := range p {
+		found := false
+		for _, atv := range rdn {
+			if strings.EqualFold(pattern.attributeType, atv.Type) && pattern.value.MatchString(atv.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate decides whether the request is allowed.
+func (p *Policy) Evaluate(request Request) Decision {
+	if p == nil {
+		return Decision{Rule: DefaultRule}
+	}
+
+	target, err := group.ParseDN(request.Target)
+	if err != nil || len(target) == 0 {
+		return Decision{Rule: DefaultRule}
+	}
+	flow := map[string]string{}
+	for key, value := range request.Flow {
+		flow[strings.ToLower(key)] = value
+	}
+
+	var allowedBy *rule
+	for _, r := range p.rules {
+		if !r.matches(request, target, flow) {
+			continue
+		}
+		if r.Effect == Deny {
+			return Decision{Rule: r.Name}
+		}
+		if allowedBy == nil {
+			allowedBy = r
+		}
+	}
+	if allowedBy == nil {
+		return Decision{Rule: DefaultRule}
+	}
+	return Decision{Allowed: true, Rule: allowedBy.Name}
+}
+
+// Authorize decides whether the request is allowed, returning a *DeniedError too unless it is.
+func (p *Policy) Authorize(request Request) (Decision, error) {
+	decision := p.Evaluate(request)
+	if !decision.Allowed {
+		return decision, &DeniedError{Operation: request.Operation, Target: request.Target, Rule: decision.Rule}
+	}
+	return decision, nil
+}
+
+func (r *rule) matches(request Request, target group.DN, flow map[string]string) bool {
+	return r.matchesOperation(request.Operation) &&
+		r.matchesGroup(target) &&
+		r.matchesSubtree(target) &&
+		r.matchesAttributes(request.Attributes) &&
+		r.matchesFlow(flow)
+}
+
+func (r *rule) matchesOperation(operation string) bool {
+	for _, o := range r.Operations {
+		if strings.EqualFold(o, operation) {
+			return true
+		}
+	}
+	return len(r.Operations) == 0
+}
+
+func (r *rule) matchesGroup(target group.DN) bool {
+	for _, pattern := range r.groups {
+		if pattern.matches(target) {
+			return true
+		}
+	}
+	return len(r.groups) == 0
+}
+
+func (r *rule) matchesSubtree(target group.DN) bool {
+	for _, subtree := range r.subtrees {
+		if target.Within(subtree) {
+			return true
+		}
+	}
+	return len(r.subtrees) == 0
+}
+
+// matchesAttributes matches an allow rule if every attribute is one of the rule's, so it allows nothing more than
+// it names, and a deny rule if any is.
+func (r *rule) matchesAttributes(attributes []string) bool {
+	if len(r.Attributes) == 0 {
+		return true
+	}
+	for _, attribute := range attributes {
+		listed := false
+		for _, a := range r.Attributes {
+			if strings.EqualFold(a, attribute) {
+				listed = true
+				break
+			}
+		}
+		if listed && r.Effect == Deny {
+			return true
+		}
+		if !listed && r.Effect == Allow {
+			return false
+		}
+	}
+	return r.Effect == Allow && len(attributes) > 0
+}
+
+// matchesFlow matches if the flow gave every key of the rule's metadata, with a value matching its pattern.
+func (r *rule) matchesFlow(flow map[string]string) bool {
+	for key, pattern := range r.flow {
+		value, ok := flow[key]
+		if !ok || !pattern.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateShouldDenyByDefault(t *testing.T) {
+	var nilPolicy *Policy
+	empty, _ := New(nil)
+	onlyOthers, _ := New([]Rule{{Name: "other-groups", Effect: Allow, Subtrees: []string{"OU=Other,DC=com"}}})
+
+	for _, p := range []*Policy{nilPolicy, empty, onlyOthers} {
+		if decision := p.Evaluate(someRequest()); decision != (Decision{Rule: DefaultRule}) {
+			t.Errorf("Request should have been denied by default, decision: %+v", decision)
+		}
+	}
+}
+
+func TestEvaluateShouldAllowByFirstMatchingAllowRule(t *testing.T) {
+	p, _ := New([]Rule{
+		{Name: "other-groups", Effect: Allow, Groups: []string{"CN=other,OU=Groups,DC=com"}},
+		{Name: "app-groups", Effect: Allow, Groups: []string{"cn=APP-*, ou=groups, dc=com"}},
+		{Name: "access-groups", Effect: Allow, Subtrees: []string{"OU=Groups,DC=com"}},
+	})
+
+	if decision := p.Evaluate(someRequest()); decision != (Decision{Allowed: true, Rule: "app-groups"}) {
+		t.Errorf("Decision is wrong: %+v", decision)
+	}
+}
+
+func TestEvaluateShouldMatchGroupPatternsWithinASingleRDN(t *testing.T) {
+	p, _ := New([]Rule{{Name: "app-groups", Effect: Allow, Groups: []string{"CN=app-*,OU=Groups,DC=com", "CN=*,OU=Access,DC=com"}}})
+
+	for _, target := range []string{
+		"CN=app-admins,OU=Privileged,OU=Groups,DC=com",
+		"CN=team,OU=Nested,OU=Access,DC=com",
+		"CN=app-x+UID=admins,OU=Groups,DC=com",
+	} {
+		request := someRequest()
+		request.Target = target
+		if decision := p.Evaluate(request); decision.Allowed {
+			t.Errorf("Should not have allowed %q: %+v", target, decision)
+		}
+	}
+	request := someRequest()
+	request.Target = "CN=app-admins\\,OU=Privileged,OU=Groups,DC=com"
+	if decision := p.Evaluate(request); !decision.Allowed {
+		t.Errorf("Should have allowed a value containing an escaped comma: %+v", decision)
+	}
+}
+
+func TestEvaluateShouldDenyIfAnyDenyRuleMatches(t *testing.T) {
+	p, _ := New([]Rule{
+		{Name: "access-groups", Effect: Allow, Subtrees: []string{"OU=Groups,DC=com"}},
+		{Name: "no-admins", Effect: Deny, Groups: []string{"CN=*admin*,OU=Groups,DC=com"}},
+		{Name: "no-app-groups", Effect: Deny, Groups: []string{"CN=app-*,OU=Groups,DC=com"}},
+	})
+
+	if decision := p.Evaluate(someRequest()); decision != (Decision{Rule: "no-app-groups"}) {
+		t.Errorf("Decision is wrong: %+v", decision)
+	}
+}
+
+func TestEvaluateShouldMatchOperationsAndFlowMetadata(t *testing.T) {
+	p, _ := New([]Rule{{
+		Name:       "access-requests",
+		Effect:     Allow,
+		Operations: []string{"AddUserToGroup"},
+		Flow:       map[string]string{"Name": "access-request-*", "approved": "true"},
+	}})
+	tests := map[string]struct {
+		operation string
+		flow      map[string]string
+		allowed   bool
+	}{
+		"matching":         {operation: "AddUserToGroup", flow: map[string]string{"name": "access-request-london", "approved": "TRUE"}, allowed: true},
+		"other operation":  {operation: "RemoveUserFromGroup", flow: map[string]string{"name": "access-request-london", "approved": "true"}},
+		"other flow":       {operation: "AddUserToGroup", flow: map[string]string{"name": "cleanup", "approved": "true"}},
+		"missing metadata": {operation: "AddUserToGroup", flow: map[string]string{"name": "access-request-london"}},
+		"no metadata":      {operation: "AddUserToGroup"},
+	}
+
+	for name, test := range tests {
+		request := someRequest()
+		request.Operation, request.Flow = test.operation, test.flow
+		if decision := p.Evaluate(request); decision.Allowed != test.allowed {
+			t.Errorf("%s: decision is wrong: %+v", name, decision)
+		}
+	}
+}
+
+func TestEvaluateShouldAllowOnlyTheAttributesNamedAndDenyAnyOfThem(t *testing.T) {
+	allow, _ := New([]Rule{{Name: "members", Effect: Allow, Attributes: []string{"Member"}}})
+	deny, _ := New([]Rule{
+		{Name: "all", Effect: Allow},
+		{Name: "no-descriptions", Effect: Deny, Attributes: []string{"description"}},
+	})
+	tests := []struct {
+		policy     *Policy
+		attributes []string
+		allowed    bool
+	}{
+		{policy: allow, attributes: []string{"member"}, allowed: true},
+		{policy: allow, attributes: []string{"member", "description"}},
+		{policy: allow},
+		{policy: deny, attributes: []string{"member"}, allowed: true},
+		{policy: deny, attributes: []string{"member", "description"}},
+	}
+
+	for _, test := range tests {
+		request := someRequest()
+		request.Attributes = test.attributes
+		if decision := test.policy.Evaluate(request); decision.Allowed != test.allowed {
+			t.Errorf("Decision for %v is wrong: %+v", test.attributes, decision)
+		}
+	}
+}
+
+func TestAuthorizeShouldReturnDeniedErrorNamingTheRule(t *testing.T) {
+	p, _ := New([]Rule{{Name: "no-app-groups", Effect: Deny, Subtrees: []string{"OU=Groups,DC=com"}}})
+
+	_, err := p.Authorize(someRequest())
+
+	var denied *DeniedError
+	if !errors.As(err, &denied) || denied.Rule != "no-app-groups" {
+		t.Fatalf("Error returned is wrong: %v", err)
+	}
+	if err.Error() != `AddUserToGroup on "CN=app-london,OU=Groups,DC=com" denied by policy rule "no-app-groups"` {
+		t.Errorf("Error message is wrong: %v", err)
+	}
+}
+
+func TestNewShouldReturnEveryProblemWithTheRules(t *testing.T) {
+	_, err := New([]Rule{
+		{Effect: Allow},
+		{Name: "maybe", Effect: "perhaps"},
+		{Name: "groups", Effect: Allow, Groups: []string{"not a DN"}},
+		{Name: "subtrees", Effect: Deny, Subtrees: []string{""}},
+		{Name: "groups", Effect: Allow},
+	})
+
+	var rulesErr *RulesError
+	if !errors.As(err, &rulesErr) {
+		t.Fatalf("Error returned is wrong: %v", err)
+	}
+	expected := []string{
+		"rule 1 has no name",
+		`rule "maybe" has effect "perhaps" rather than "allow" or "deny"`,
+		`rule "groups" has group pattern "not a DN" that is not a DN`,
+		`rule "subtrees" has subtree "" that is not a DN`,
+		`rule "groups" is defined more than once`,
+	}
+	if !reflect.DeepEqual(rulesErr.Problems, expected) {
+		t.Errorf("Problems are wrong: %q", rulesErr.Problems)
+	}
+}
+
+func someRequest() Request {
+	return Request{
+		Operation:  "AddUserToGroup",
+		Target:     "CN=app-london,OU=Groups,DC=com",
+		Attributes: []string{"member"},
+	}
+}
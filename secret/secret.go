@@ -0,0 +1,124 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"fmt"
+	"github.com/HotelsDotCom/go-logger"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Value is a secret, e.g. a password, that may change while the pack is running.
+type Value interface {
+	Get() string
+}
+
+// Static is a secret that never changes, e.g. one read from an environment variable.
+type Static string
+
+func (s Static) Get() string {
+	return string(s)
+}
+
+// File is a secret read from a file, e.g. a mounted Kubernetes secret, which is re-read periodically so the secret
+// can be rotated without restarting the pack.
+type File struct {
+	path string
+	stop chan struct{}
+	once sync.Once
+
+	mu    sync.RWMutex
+	value string
+}
+
+// NewFile reads the secret in the file at path, re-reading it every interval until the File is closed. It is never
+// re-read if interval is 0. Trailing newlines, which editors and 'echo' tend to add, are not part of the secret. An
+// empty secret is an error, as binding with an empty password is an unauthenticated bind that most servers allow.
+func NewFile(path string, interval time.Duration) (*File, error) {
+	value, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{path: path, stop: make(chan struct{}), value: value}
+	if interval > 0 {
+		go f.watch(interval)
+	}
+	return f, nil
+}
+
+// Get returns the secret as it was when the file was last read.
+func (f *File) Get() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.value
+}
+
+// Close stops re-reading the file.
+func (f *File) Close() {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+}
+
+func (f *File) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.reload()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// reload re-reads the file, keeping the current secret if it cannot be read or is empty, e.g. while the secret is
+// being updated.
+func (f *File) reload() {
+	value, err := readFile(f.path)
+	if err != nil {
+		logger.Errorf("%v, keeping the current secret", err)
+		return
+	}
+
+	f.mu.Lock()
+	changed := value != f.value
+	f.value = value
+	f.mu.Unlock()
+
+	if changed {
+		logger.Infof("Secret file %q has changed", f.path)
+	}
+}
+
+func readFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Cannot read secret file: %v", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("Secret file %q is empty", path)
+	}
+	return value, nil
+}
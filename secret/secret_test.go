@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewFileShouldReadSecretWithoutTrailingNewlines(t *testing.T) {
+	path := writeSecret(t, "", "s3cr3t\r\n")
+
+	f, err := NewFile(path, 0)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if f.Get() != "s3cr3t" {
+		t.Errorf("Secret is wrong: %q", f.Get())
+	}
+}
+
+func TestNewFileShouldReturnErrorIfFileCannotBeRead(t *testing.T) {
+	_, err := NewFile(filepath.Join(os.TempDir(), "no-such-secret"), 0)
+
+	if err == nil {
+		t.Fatal("Expected error!")
+	}
+}
+
+func TestNewFileShouldReturnErrorIfSecretIsEmpty(t *testing.T) {
+	path := writeSecret(t, "", "\n")
+
+	_, err := NewFile(path, 0)
+
+	if err == nil {
+		t.Fatal("Expected error!")
+	}
+}
+
+func TestFileShouldPickUpChangedSecret(t *testing.T) {
+	path := writeSecret(t, "", "old")
+	f, err := NewFile(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer f.Close()
+
+	writeSecret(t, path, "new")
+
+	for deadline := time.Now().Add(2 * time.Second); f.Get() != "new" && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if f.Get() != "new" {
+		t.Errorf("Secret should have changed, is: %q", f.Get())
+	}
+}
+
+func TestFileShouldKeepSecretIfFileCannotBeReRead(t *testing.T) {
+	path := writeSecret(t, "", "old")
+	f, err := NewFile(path, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	os.Remove(path)
+	f.reload()
+
+	if f.Get() != "old" {
+		t.Errorf("Secret should not have changed, is: %q", f.Get())
+	}
+}
+
+func TestFileShouldKeepSecretIfFileIsEmptied(t *testing.T) {
+	path := writeSecret(t, "", "old")
+	f, err := NewFile(path, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	writeSecret(t, path, "")
+	f.reload()
+
+	if f.Get() != "old" {
+		t.Errorf("Secret should not have changed, is: %q", f.Get())
+	}
+}
+
+// writeSecret writes the secret to path, or a new file if path is empty, returning the path.
+func writeSecret(t *testing.T, path, secret string) string {
+	if path == "" {
+		dir, err := ioutil.TempDir("", "flyte-ldap-secret")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		path = filepath.Join(dir, "password")
+	}
+	if err := ioutil.WriteFile(path, []byte(secret), 0600); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return path
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/ExpediaGroup/flyte-ldap/directory"
+	"github.com/HotelsDotCom/flyte-client/client"
+	"github.com/HotelsDotCom/go-logger"
+	"os"
+	"sync"
+	"time"
+)
+
+// drainingClient counts the actions taken from Flyte until they are completed, so shutting down can wait for the
+// commands in flight, and takes no more once draining.
+type drainingClient struct {
+	client.Client
+
+	mu       sync.Mutex
+	inFlight int // actions taken, or being taken, and not yet completed
+	draining bool
+	drained  chan struct{} // closed once draining with no actions in flight
+}
+
+func newDrainingClient(c client.Client) *drainingClient {
+	return &drainingClient{Client: c, drained: make(chan struct{})}
+}
+
+// TakeAction returns no action once draining, which the pack treats as there being none to take.
+func (c *drainingClient) TakeAction() (*client.Action, error) {
+	c.mu.Lock()
+	if c.draining {
+		c.mu.Unlock()
+		return nil, nil
+	}
+	c.inFlight++ // before taking it, so draining waits for an action being taken
+	c.mu.Unlock()
+
+	action, err := c.Client.TakeAction()
+	if action == nil || err != nil {
+		c.done()
+	}
+	return action, err
+}
+
+func (c *drainingClient) CompleteAction(action client.Action, event client.Event) error {
+	defer c.done()
+	return c.Client.CompleteAction(action, event)
+}
+
+func (c *drainingClient) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	if c.draining && c.inFlight == 0 {
+		close(c.drained)
+	}
+}
+
+// drain stops taking actions and waits for those in flight to be completed, for up to gracePeriod. It returns the
+// number still in flight when it gave up waiting.
+func (c *drainingClient) drain(gracePeriod time.Duration) int {
+	c.mu.Lock()
+	if !c.draining {
+		c.draining = true
+		if c.inFlight == 0 {
+			close(c.drained)
+		}
+	}
+	c.mu.Unlock()
+
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-c.drained:
+		return 0
+	case <-timer.C:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.inFlight
+	}
+}
+
+// shutdown drains the commands in flight when sig is received, then stops probing the directories and closes their
+// connections. Metrics are scraped rather than pushed, and logs are written unbuffered, so neither needs flushing.
+func shutdown(sig os.Signal, flyteClient *drainingClient, gracePeriod time.Duration, stopProbing chan struct{}, directories *directory.Registry) {
+	logger.Infof("Received %v, waiting up to %v for commands in flight to complete", sig, gracePeriod)
+	if inFlight := flyteClient.drain(gracePeriod); inFlight > 0 {
+		logger.Errorf("Shutting down with %d commands still in flight", inFlight)
+	}
+	close(stopProbing)
+	directories.Close()
+	logger.Infof("Shut down")
+}
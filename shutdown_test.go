@@ -0,0 +1,100 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/HotelsDotCom/flyte-client/client"
+	"testing"
+	"time"
+)
+
+func TestDrainingClient_shouldTakeNoActionsOnceDraining(t *testing.T) {
+	flyteClient := &mockFlyteClient{}
+	c := newDrainingClient(flyteClient)
+
+	if inFlight := c.drain(time.Second); inFlight != 0 {
+		t.Fatalf("Expected no actions in flight, got %d", inFlight)
+	}
+	action, err := c.TakeAction()
+
+	if action != nil || err != nil {
+		t.Errorf("Expected no action, got %v, %v", action, err)
+	}
+	if flyteClient.taken != 0 {
+		t.Errorf("Expected no actions to be taken from Flyte, got %d", flyteClient.taken)
+	}
+}
+
+func TestDrainingClient_shouldWaitForActionsInFlightToComplete(t *testing.T) {
+	c := newDrainingClient(&mockFlyteClient{action: &client.Action{}})
+	action, _ := c.TakeAction()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c.CompleteAction(*action, client.Event{})
+	}()
+	start := time.Now()
+	inFlight := c.drain(5 * time.Second)
+
+	if inFlight != 0 {
+		t.Errorf("Expected no actions in flight, got %d", inFlight)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Expected drain to wait for the action to complete")
+	}
+}
+
+func TestDrainingClient_shouldGiveUpWaitingAfterGracePeriod(t *testing.T) {
+	c := newDrainingClient(&mockFlyteClient{action: &client.Action{}})
+	c.TakeAction()
+	c.TakeAction()
+
+	inFlight := c.drain(50 * time.Millisecond)
+
+	if inFlight != 2 {
+		t.Errorf("Expected 2 actions in flight, got %d", inFlight)
+	}
+}
+
+func TestDrainingClient_shouldNotCountFailedOrEmptyTakes(t *testing.T) {
+	flyteClient := &mockFlyteClient{err: errors.New("Flyte is unavailable")}
+	c := newDrainingClient(flyteClient)
+	c.TakeAction()
+	flyteClient.err = nil
+	c.TakeAction()
+
+	if inFlight := c.drain(50 * time.Millisecond); inFlight != 0 {
+		t.Errorf("Expected no actions in flight, got %d", inFlight)
+	}
+}
+
+type mockFlyteClient struct {
+	client.Client
+	action *client.Action
+	err    error
+	taken  int
+}
+
+func (c *mockFlyteClient) TakeAction() (*client.Action, error) {
+	c.taken++
+	return c.action, c.err
+}
+
+func (c *mockFlyteClient) CompleteAction(client.Action, client.Event) error {
+	return nil
+}
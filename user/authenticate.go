@@ -0,0 +1,66 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+)
+
+// Authenticator checks users' passwords. It is safe for concurrent use.
+type Authenticator interface {
+	// Authenticate finds the user the search details' SearchFilter finds, as the service account, then binds as them
+	// with the password. A rejected password is an *ldap.AuthenticationError, and a username that finds no user, or
+	// several, is a group.UserNotFoundError or group.AmbiguousUserError.
+	Authenticate(ctx context.Context, sd *group.SearchDetails, username, password string) error
+}
+
+type authenticator struct {
+	client ldap.Client
+}
+
+func NewAuthenticator(client ldap.Client) Authenticator {
+	return &authenticator{client: client}
+}
+
+func (a *authenticator) Authenticate(ctx context.Context, sd *group.SearchDetails, username, password string) error {
+	if err := group.ValidateUsername(username, sd.MaxUsernameLength); err != nil {
+		return err
+	}
+
+	userDN, err := a.findUserDN(ctx, sd, username)
+	if err != nil {
+		return err
+	}
+	return a.client.Authenticate(ctx, userDN, password)
+}
+
+// findUserDN returns the user's DN, giving up the service account's connection before the user is bound.
+func (a *authenticator) findUserDN(ctx context.Context, sd *group.SearchDetails, username string) (string, error) {
+	conn, err := a.client.Connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	entry, err := group.FindUser(ctx, conn, sd, username, []string{ldap.NoAttributes})
+	if err != nil {
+		return "", err
+	}
+	return entry.DN, nil
+}
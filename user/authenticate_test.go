@@ -0,0 +1,99 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"testing"
+)
+
+func TestAuthenticateShouldBindAsTheUserFound(t *testing.T) {
+	var searchRequest ldap.SearchRequest
+	var boundDN, boundPassword string
+	client := &mockClient{search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		searchRequest = sr
+		return userResult(nil), nil
+	}}
+	client.authenticate = func(userDN, password string) error {
+		if client.connected {
+			t.Error("The service account's connection should have been closed before binding as the user")
+		}
+		boundDN, boundPassword = userDN, password
+		return nil
+	}
+
+	err := NewAuthenticator(client).Authenticate(context.Background(), someSearchDetails(), "dave-jones", "s3cr3t")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if searchRequest.SearchFilter != "(mailNickname=dave-jones)" {
+		t.Errorf("Search filter is wrong: %s", searchRequest.SearchFilter)
+	}
+	if boundDN != "CN=Dave Jones,OU=Users,DC=com" || boundPassword != "s3cr3t" {
+		t.Errorf("Bind was not as the user found: %s", boundDN)
+	}
+}
+
+func TestAuthenticateShouldReturnAuthenticationError(t *testing.T) {
+	client := &mockClient{
+		search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+			return userResult(nil), nil
+		},
+		authenticate: func(userDN, password string) error {
+			return &ldap.AuthenticationError{Code: "775", Reason: "account locked"}
+		},
+	}
+
+	err := NewAuthenticator(client).Authenticate(context.Background(), someSearchDetails(), "dave-jones", "s3cr3t")
+
+	var authErr *ldap.AuthenticationError
+	if !errors.As(err, &authErr) || authErr.Code != "775" {
+		t.Errorf("Expected account locked error, got: %v", err)
+	}
+}
+
+func TestAuthenticateShouldNotBindIfUserIsNotFound(t *testing.T) {
+	client := &mockClient{
+		search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+			return &ldapClient.SearchResult{}, nil
+		},
+		authenticate: func(userDN, password string) error {
+			t.Error("Authenticate should not have been called")
+			return nil
+		},
+	}
+
+	err := NewAuthenticator(client).Authenticate(context.Background(), someSearchDetails(), "dave-jones", "s3cr3t")
+
+	var notFound *group.UserNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("Expected user not found error, got: %v", err)
+	}
+}
+
+func TestAuthenticateShouldRejectInvalidUsernameWithoutConnecting(t *testing.T) {
+	err := NewAuthenticator(&mockClient{}).Authenticate(context.Background(), someSearchDetails(), "dave\x00", "s3cr3t")
+
+	if err == nil {
+		t.Error("Expected an invalid username error")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"fmt"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	"strings"
+)
+
+// User is a directory user, with the attributes read from their entry.
+type User struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Searcher is safe for concurrent use, every search is made on a connection of its own.
+type Searcher interface {
+	// GetUser returns the user the search details' SearchFilter finds, or a group.UserNotFoundError or
+	// group.AmbiguousUserError. Only the UserAttributes may be requested, all of them are returned if attributes is
+	// empty.
+	GetUser(ctx context.Context, sd *group.SearchDetails, username string, attributes []string) (*User, error)
+}
+
+type searcher struct {
+	client ldap.Client
+}
+
+func NewSearcher(client ldap.Client) Searcher {
+	return &searcher{client: client}
+}
+
+func (searcher *searcher) GetUser(ctx context.Context, sd *group.SearchDetails, username string, attributes []string) (*User, error) {
+	if err := group.ValidateUsername(username, sd.MaxUsernameLength); err != nil {
+		return nil, err
+	}
+	attributes, err := allowedAttributes(attributes, sd.UserAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := searcher.client.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	searchAttributes := attributes
+	if len(searchAttributes) == 0 {
+		searchAttributes = []string{ldap.NoAttributes}
+	}
+	entry, err := group.FindUser(ctx, conn, sd, username, searchAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{DN: entry.DN, Attributes: map[string][]string{}}
+	for _, attr := range entry.Attributes {
+		for _, attribute := range attributes {
+			if strings.EqualFold(attr.Name, attribute) && len(attr.Values) > 0 {
+				user.Attributes[attribute] = attr.Values
+			}
+		}
+	}
+	return user, nil
+}
+
+// allowedAttributes checks the requested attributes are all allowed, returning them with the case they are allowed
+// in, or all the allowed attributes if none were requested.
+func allowedAttributes(requested, allowed []string) ([]string, error) {
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	attributes := make([]string, len(requested))
+	for i, attribute := range requested {
+		found := false
+		for _, a := range allowed {
+			if strings.EqualFold(attribute, a) {
+				attributes[i], found = a, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Attribute %q is not allowed", attribute)
+		}
+	}
+	return attributes, nil
+}
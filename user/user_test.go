@@ -0,0 +1,204 @@
+/*
+Copyright (C) 2018 Expedia Group.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/ExpediaGroup/flyte-ldap/group"
+	"github.com/ExpediaGroup/flyte-ldap/ldap"
+	ldapClient "gopkg.in/ldap.v2"
+	"reflect"
+	"testing"
+)
+
+func TestGetUserShouldReturnRequestedAttributes(t *testing.T) {
+	var searchRequest ldap.SearchRequest
+	searcher := NewSearcher(&mockClient{search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		searchRequest = sr
+		return userResult(map[string][]string{"MAIL": {"dave@example.com"}, "displayName": {"Dave Jones"}}), nil
+	}})
+
+	user, err := searcher.GetUser(context.Background(), someSearchDetails(), "dave-jones", []string{"mail", "DISPLAYNAME"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if searchRequest.SearchFilter != "(mailNickname=dave-jones)" || searchRequest.BaseDn != "DC=com" {
+		t.Errorf("Search request is wrong: %+v", searchRequest)
+	}
+	if !reflect.DeepEqual(searchRequest.Attributes, []string{"mail", "displayName"}) {
+		t.Errorf("Attributes requested are wrong: %v", searchRequest.Attributes)
+	}
+	expected := &User{
+		DN:         "CN=Dave Jones,OU=Users,DC=com",
+		Attributes: map[string][]string{"mail": {"dave@example.com"}, "displayName": {"Dave Jones"}},
+	}
+	if !reflect.DeepEqual(user, expected) {
+		t.Errorf("User is wrong: %+v", user)
+	}
+}
+
+func TestGetUserShouldRequestAllAllowedAttributesIfNoneAreGiven(t *testing.T) {
+	var attributes []string
+	searcher := NewSearcher(&mockClient{search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		attributes = sr.Attributes
+		return userResult(nil), nil
+	}})
+
+	if _, err := searcher.GetUser(context.Background(), someSearchDetails(), "dave-jones", nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(attributes, someSearchDetails().UserAttributes) {
+		t.Errorf("Attributes requested are wrong: %v", attributes)
+	}
+}
+
+func TestGetUserShouldRequestNoAttributesIfNoneAreAllowed(t *testing.T) {
+	var attributes []string
+	searcher := NewSearcher(&mockClient{search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		attributes = sr.Attributes
+		return userResult(map[string][]string{"mail": {"dave@example.com"}}), nil
+	}})
+	searchDetails := someSearchDetails()
+	searchDetails.UserAttributes = nil
+
+	user, err := searcher.GetUser(context.Background(), searchDetails, "dave-jones", nil)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(attributes, []string{ldap.NoAttributes}) || len(user.Attributes) != 0 {
+		t.Errorf("No attributes should have been requested or returned: %v, %v", attributes, user.Attributes)
+	}
+}
+
+func TestGetUserShouldRejectAttributesNotAllowedWithoutConnecting(t *testing.T) {
+	searcher := NewSearcher(&mockClient{})
+
+	_, err := searcher.GetUser(context.Background(), someSearchDetails(), "dave-jones", []string{"mail", "userPassword"})
+
+	if err == nil || err.Error() != `Attribute "userPassword" is not allowed` {
+		t.Errorf("Expected attribute not allowed error, got: %v", err)
+	}
+}
+
+func TestGetUserShouldRejectInvalidUsernameWithoutConnecting(t *testing.T) {
+	searcher := NewSearcher(&mockClient{})
+
+	_, err := searcher.GetUser(context.Background(), someSearchDetails(), "dave\n", nil)
+
+	if err == nil {
+		t.Error("Expected an invalid username error")
+	}
+}
+
+func TestGetUserShouldReturnUserNotFoundError(t *testing.T) {
+	searcher := NewSearcher(&mockClient{search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		return &ldapClient.SearchResult{}, nil
+	}})
+
+	user, err := searcher.GetUser(context.Background(), someSearchDetails(), "dave-jones", nil)
+
+	var notFound *group.UserNotFoundError
+	if !errors.As(err, &notFound) || user != nil {
+		t.Errorf("Expected no user and a user not found error, got: %v, %v", user, err)
+	}
+}
+
+func TestGetUserShouldReturnSearchAndConnectErrors(t *testing.T) {
+	searchError := &mockClient{search: func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+		return nil, errors.New("Search went wrong!!")
+	}}
+	connectError := &mockClient{connectErr: errors.New("Cannot connect")}
+
+	for expected, client := range map[string]*mockClient{"Search went wrong!!": searchError, "Cannot connect": connectError} {
+		_, err := NewSearcher(client).GetUser(context.Background(), someSearchDetails(), "dave-jones", nil)
+
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got: %v", expected, err)
+		}
+	}
+}
+
+func someSearchDetails() *group.SearchDetails {
+	return &group.SearchDetails{
+		BaseDn:            "DC=com",
+		SearchFilter:      "(mailNickname={username})",
+		SearchTimeout:     20,
+		MaxUsernameLength: 20,
+		UserAttributes:    []string{"mail", "displayName", "manager"},
+	}
+}
+
+func userResult(attributes map[string][]string) *ldapClient.SearchResult {
+	return &ldapClient.SearchResult{Entries: []*ldapClient.Entry{ldapClient.NewEntry("CN=Dave Jones,OU=Users,DC=com", attributes)}}
+}
+
+type mockClient struct {
+	connectErr   error
+	search       func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error)
+	authenticate func(userDN, password string) error
+	connected    bool // whether a connection is checked out
+}
+
+func (c *mockClient) Connect(context.Context) (ldap.Conn, error) {
+	if c.connectErr != nil {
+		return nil, c.connectErr
+	}
+	if c.search == nil {
+		panic("unexpected connect")
+	}
+	c.connected = true
+	return &mockConn{search: c.search, close: func() { c.connected = false }}, nil
+}
+
+func (c *mockClient) Authenticate(_ context.Context, userDN, password string) error {
+	return c.authenticate(userDN, password)
+}
+
+func (c *mockClient) Close() {}
+
+type mockConn struct {
+	search func(sr ldap.SearchRequest) (*ldapClient.SearchResult, error)
+	close  func()
+}
+
+func (c *mockConn) Search(_ context.Context, sr ldap.SearchRequest) (*ldapClient.SearchResult, error) {
+	return c.search(sr)
+}
+
+func (c *mockConn) Modify(context.Context, *ldapClient.ModifyRequest) error {
+	return nil
+}
+
+func (c *mockConn) SearchPaged(_ context.Context, sr ldap.SearchRequest, handle func(*ldapClient.Entry) error) error {
+	searchResults, err := c.search(sr)
+	if err != nil {
+		return err
+	}
+	for _, entry := range searchResults.Entries {
+		if err := handle(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *mockConn) Close() {
+	c.close()
+}